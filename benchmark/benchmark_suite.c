@@ -1,670 +1,9199 @@
-/*
- * SonicSV Benchmark Suite
- *
- * A comprehensive, fair comparison between SonicSV and libcsv parsers.
- * Generates test data, runs identical workloads, and produces detailed reports.
- *
- * Build: gcc -O3 -march=native -o benchmark_suite benchmark_suite.c -lcsv -lpthread -lm
- * Usage: ./benchmark_suite [--iterations N] [--warmup N] [--output FILE]
- */
-
-#define _POSIX_C_SOURCE 200809L
-
-#include <stdio.h>
-#include <stdlib.h>
-#include <string.h>
-#include <stdint.h>
-#include <stdbool.h>
-#include <time.h>
-#include <math.h>
-#include <errno.h>
-#include <getopt.h>
-#include <sys/stat.h>
-#include <unistd.h>
-#include <sys/mman.h>
-#include <fcntl.h>
-
-/* Include libcsv first to avoid conflicts */
-#include <csv.h>
-
-/* Now include SonicSV with renamed internal struct */
-#define csv_parser sonicsv_parser_internal
-/* SONICSV_IMPLEMENTATION is passed via Makefile -D flag */
-#include "../sonicsv.h"
-#undef csv_parser
-
-/*
- * Configuration
- */
-#define DEFAULT_ITERATIONS    5
-#define DEFAULT_WARMUP        2
-#define MAX_FIELD_SIZE        1024
-#define MAX_FIELDS_PER_ROW    100
-#define TEMP_DIR              "/tmp/sonicsv_bench"
-
-/*
- * Test configurations
- */
-typedef struct {
-    const char *name;
-    size_t rows;
-    size_t fields_per_row;
-    size_t avg_field_size;
-    bool has_quotes;
-    bool has_newlines_in_fields;
-    bool has_commas_in_fields;
-} test_config_t;
-
-static const test_config_t test_configs[] = {
-    /* Simple tests - no special characters */
-    {"tiny_simple",      1000,     5,   10, false, false, false},
-    {"small_simple",    10000,     5,   10, false, false, false},
-    {"medium_simple",  100000,     5,   10, false, false, false},
-    {"large_simple",   500000,     5,   10, false, false, false},
-
-    /* Varying field counts */
-    {"wide_10cols",    100000,    10,   10, false, false, false},
-    {"wide_25cols",    100000,    25,   10, false, false, false},
-    {"wide_50cols",    100000,    50,   10, false, false, false},
-
-    /* Varying field sizes */
-    {"long_fields",    100000,     5,   50, false, false, false},
-    {"very_long",       50000,     5,  200, false, false, false},
-
-    /* Complex tests - with quoted fields */
-    {"quoted_simple",  100000,     5,   10, true,  false, false},
-    {"quoted_commas",  100000,     5,   20, true,  false, true },
-    {"quoted_newlines", 50000,     5,   30, true,  true,  false},
-    {"quoted_mixed",    50000,     5,   30, true,  true,  true },
+/*
+ * SonicSV Benchmark Suite
+ *
+ * A comprehensive, fair comparison between SonicSV and libcsv parsers.
+ * Generates test data, runs identical workloads, and produces detailed reports.
+ *
+ * Build: gcc -O3 -march=native -o benchmark_suite benchmark_suite.c -lcsv -lpthread -lm
+ * Usage: ./benchmark_suite [options]   (see --help for the full list)
+ */
+
+#define _POSIX_C_SOURCE 200809L
+#ifdef __linux__
+#define _GNU_SOURCE  /* sched_setaffinity / cpu_set_t */
+#endif
+
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <strings.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <stddef.h>
+#include <ctype.h>
+#include <time.h>
+#include <math.h>
+#include <errno.h>
+#include <getopt.h>
+#include <sys/stat.h>
+#include <limits.h>
+#include <dirent.h>
+#include <fnmatch.h>
+#include <unistd.h>
+#include <sys/mman.h>
+#include <sys/utsname.h>
+#include <sys/wait.h>
+#include <sys/resource.h>
+#include <sys/statvfs.h>
+#include <fcntl.h>
+#include <signal.h>
+#include <locale.h>
+#include <pthread.h>
+#ifdef __linux__
+#include <sched.h>
+#include <sys/vfs.h>
+#include <sys/sysmacros.h>
+#endif
+#ifdef __APPLE__
+#include <sys/mount.h>
+#include <sys/sysctl.h>
+#include <mach/mach.h>
+#include <mach-o/dyld.h>
+#include <pthread/qos.h>
+#endif
+
+/* ASan builds (make benchmark-asan) also measure what each parse leaks */
+#if defined(__SANITIZE_ADDRESS__)
+#define BENCH_ASAN 1
+#elif defined(__has_feature)
+#if __has_feature(address_sanitizer)
+#define BENCH_ASAN 1
+#endif
+#endif
+#ifdef BENCH_ASAN
+/* From <sanitizer/allocator_interface.h>, which not every toolchain installs */
+size_t __sanitizer_get_current_allocated_bytes(void);
+#endif
+
+/* Include libcsv first to avoid conflicts */
+#include <csv.h>
+
+/* Now include SonicSV with renamed internal struct */
+#define csv_parser sonicsv_parser_internal
+/* SONICSV_IMPLEMENTATION is passed via Makefile -D flag */
+#include "../sonicsv.h"
+#undef csv_parser
+
+/*
+ * Configuration
+ */
+#define DEFAULT_ITERATIONS    5
+#define DEFAULT_WARMUP        2
+#define MAX_FIELD_SIZE        1024
+#define MAX_FIELDS_PER_ROW    100
+#define TEMP_DIR              "/tmp/sonicsv_bench"
+#define WORK_DIR_NAME         "sonicsv_bench"  /* created inside --workdir */
+#define WORK_DIR_MIN_FREE     (256.0 * 1024 * 1024)  /* without --size */
+#define GEN_FLUSH_SIZE        (1 << 20)
+#define REPEAT_MAX_FILE_SIZE  (1024 * 1024)  /* --repeat applies below this size */
+#define OVERHEAD_SAMPLES      51     /* Empty-file runs used to estimate fixed cost */
+#define STABILITY_CV_MAX      5.0    /* Coefficient of variation (%) flagged as erratic */
+#define SCALING_STEPS         4      /* --scaling sizes: base, 2x, 4x, 8x */
+#define SCALING_EXPONENT_MAX  1.15   /* Fitted exponents above this are flagged */
+
+/*
+ * Exit status - CI scripts branch on the class of outcome instead of
+ * parsing the report. 1 remains the catch-all for bad arguments and
+ * unreadable inputs. When a run hits several classes the highest wins,
+ * so a wrong answer is never hidden behind a slow one.
+ */
+#define EXIT_BUILD_FAILURE    2  /* This binary can't run the suite as built */
+#define EXIT_BENCH_FAILURE    3  /* A test could not be generated or a parse failed */
+#define EXIT_REGRESSION       4  /* --regression-budget exceeded or an --assert failed */
+#define EXIT_MISMATCH         5  /* Parsers disagreed with the expected counts */
+
+#ifndef M_PI
+#define M_PI 3.14159265358979323846
+#endif
+
+/*
+ * Source revision of the SonicSV tree the suite was built from, passed in
+ * by the Makefile. A describe ending in "-dirty" means uncommitted
+ * changes, so the numbers can't be tied to a commit.
+ */
+#ifndef SONICSV_GIT_COMMIT
+#define SONICSV_GIT_COMMIT "unknown"
+#endif
+#ifndef SONICSV_GIT_DESCRIBE
+#define SONICSV_GIT_DESCRIBE "unknown"
+#endif
+
+/* SHA-256 of the sonicsv.h compiled into this binary, also from the Makefile */
+#ifndef SONICSV_SOURCE_SHA256
+#define SONICSV_SOURCE_SHA256 "unknown"
+#endif
+
+/* Compiler command line and output of this build, runs/<id>/build/<name>.log */
+#ifndef SONICSV_BUILD_LOG
+#define SONICSV_BUILD_LOG "unknown"
+#endif
+
+static bool source_tree_dirty(void) {
+    const char *describe = SONICSV_GIT_DESCRIBE;
+    size_t len = strlen(describe);
+    return len >= 6 && strcmp(describe + len - 6, "-dirty") == 0;
+}
+
+/*
+ * Field length distributions. LEN_JITTER (the default) keeps lengths
+ * within +/-25% of the average; the others model real data where line
+ * length varies enough to change how full each SIMD block is. A test
+ * sets one for all its fields; a schema's text columns can override it.
+ */
+typedef enum {
+    LEN_JITTER = 0,  /* avg +/- 25% */
+    LEN_UNIFORM,     /* uniform over 1 .. 2*avg */
+    LEN_GAUSSIAN,    /* normal around avg, stddev avg/3 */
+    LEN_ZIPF         /* heavy-tailed Pareto (alpha 1.5) with the same mean */
+} length_dist_t;
+
+static const char *const length_dist_names[] = {"jitter", "uniform", "gaussian", "zipf"};
+
+/*
+ * File shapes. SHAPE_TABLE is a header plus rows built from the fields
+ * above; the others are worst-case inputs with no header:
+ *   SHAPE_SINGLE_ROW    one row of fields_per_row fields, no newline until the end
+ *   SHAPE_HUGE_QUOTED   one quoted field of avg_field_size bytes full of separators
+ *   SHAPE_QUOTE_DELIM   rows of empty quoted fields - "","","" - alternating
+ *                       quote and delimiter bytes
+ *   SHAPE_ESCAPES       quoted fields made entirely of escaped quotes
+ *   SHAPE_NO_FINAL_EOL  rows of plain fields whose last row ends in a quoted
+ *                       field and no newline, so the final row is only
+ *                       delivered at end of input
+ *   SHAPE_GIANT_LINE    one row of fields_per_row fields with no newline at all
+ */
+typedef enum {
+    SHAPE_TABLE = 0,
+    SHAPE_SINGLE_ROW,
+    SHAPE_HUGE_QUOTED,
+    SHAPE_QUOTE_DELIM,
+    SHAPE_ESCAPES,
+    SHAPE_NO_FINAL_EOL,
+    SHAPE_GIANT_LINE
+} file_shape_t;
+
+/*
+ * Test configurations. note, expect_rows and expect_fields are optional:
+ * the note is printed under SCENARIO NOTES, and declared counts (header
+ * row included) are what the generator and both parsers must produce at
+ * the configured size, so a scenario doubles as a regression test.
+ */
+typedef struct {
+    const char *name;
+    size_t rows;
+    size_t fields_per_row;
+    size_t avg_field_size;
+    bool has_quotes;
+    bool has_newlines_in_fields;
+    bool has_commas_in_fields;
+    char delimiter;              /* Field separator handed to both parsers */
+    length_dist_t length_dist;
+    const char *schema;          /* Per-column types (see parse_schema), NULL for uniform text */
+    file_shape_t shape;
+    const char *note;            /* NULL = no note */
+    size_t expect_rows;          /* 0 = not declared */
+    size_t expect_fields;
+} test_config_t;
+
+/* Fills note, expect_rows and expect_fields of a scenario without them */
+#define NO_NOTE NULL, 0, 0
+
+static const test_config_t test_configs[] = {
+    /* Simple tests - no special characters */
+    {"tiny_simple",      1000,     5,   10, false, false, false, ',',  LEN_JITTER, NULL, SHAPE_TABLE,
+        "Small enough that per-parse setup shows in the result", 1001, 5005},
+    {"small_simple",    10000,     5,   10, false, false, false, ',',  LEN_JITTER, NULL, SHAPE_TABLE, NO_NOTE},
+    {"medium_simple",  100000,     5,   10, false, false, false, ',',  LEN_JITTER, NULL, SHAPE_TABLE, NO_NOTE},
+    {"large_simple",   500000,     5,   10, false, false, false, ',',  LEN_JITTER, NULL, SHAPE_TABLE, NO_NOTE},
+
+    /* Varying field counts */
+    {"wide_10cols",    100000,    10,   10, false, false, false, ',',  LEN_JITTER, NULL, SHAPE_TABLE, NO_NOTE},
+    {"wide_25cols",    100000,    25,   10, false, false, false, ',',  LEN_JITTER, NULL, SHAPE_TABLE, NO_NOTE},
+    {"wide_50cols",    100000,    50,   10, false, false, false, ',',  LEN_JITTER, NULL, SHAPE_TABLE, NO_NOTE},
+
+    /* Varying field sizes */
+    {"long_fields",    100000,     5,   50, false, false, false, ',',  LEN_JITTER, NULL, SHAPE_TABLE, NO_NOTE},
+    {"very_long",       50000,     5,  200, false, false, false, ',',  LEN_JITTER, NULL, SHAPE_TABLE, NO_NOTE},
+
+    /* Complex tests - with quoted fields */
+    {"quoted_simple",  100000,     5,   10, true,  false, false, ',',  LEN_JITTER, NULL, SHAPE_TABLE, NO_NOTE},
+    {"quoted_commas",  100000,     5,   20, true,  false, true , ',',  LEN_JITTER, NULL, SHAPE_TABLE, NO_NOTE},
+    {"quoted_newlines", 50000,     5,   30, true,  true,  false, ',',  LEN_JITTER, NULL, SHAPE_TABLE,
+        "Line breaks inside quotes: splitting on newlines first overcounts rows", 50001, 250005},
+    {"quoted_mixed",    50000,     5,   30, true,  true,  true , ',',  LEN_JITTER, NULL, SHAPE_TABLE, NO_NOTE},
 
     /* Larger workloads - reduce fixed overhead and timer noise */
-    {"huge_simple",   2000000,     5,   10, false, false, false},
-    {"huge_wide_25",   500000,    25,   10, false, false, false},
-    {"huge_long",      250000,     5,  200, false, false, false},
-    {"huge_quoted_mix",500000,     5,   30, true,  true,  true },
+    {"huge_simple",   2000000,     5,   10, false, false, false, ',',  LEN_JITTER, NULL, SHAPE_TABLE, NO_NOTE},
+    {"huge_wide_25",   500000,    25,   10, false, false, false, ',',  LEN_JITTER, NULL, SHAPE_TABLE, NO_NOTE},
+    {"huge_long",      250000,     5,  200, false, false, false, ',',  LEN_JITTER, NULL, SHAPE_TABLE, NO_NOTE},
+    {"huge_quoted_mix",500000,     5,   30, true,  true,  true , ',',  LEN_JITTER, NULL, SHAPE_TABLE, NO_NOTE},
+
+    /* Alternate delimiters - both parsers are configured with the same separator */
+    {"tsv_simple",     100000,     5,   10, false, false, false, '\t', LEN_JITTER, NULL, SHAPE_TABLE, NO_NOTE},
+    {"tsv_quoted",      50000,     5,   30, true,  true,  true , '\t', LEN_JITTER, NULL, SHAPE_TABLE, NO_NOTE},
+    {"semicolon",      100000,     5,   10, true,  false, true , ';',  LEN_JITTER, NULL, SHAPE_TABLE, NO_NOTE},
+    {"pipe_wide",      100000,    25,   10, false, false, false, '|',  LEN_JITTER, NULL, SHAPE_TABLE, NO_NOTE},
+
+    /* Variable field lengths - same mean, different spread */
+    {"len_uniform",    100000,     5,   20, false, false, false, ',',  LEN_UNIFORM, NULL, SHAPE_TABLE, NO_NOTE},
+    {"len_gaussian",   100000,     5,   20, false, false, false, ',',  LEN_GAUSSIAN, NULL, SHAPE_TABLE, NO_NOTE},
+    {"len_zipf",       100000,     5,   20, false, false, false, ',',  LEN_ZIPF, NULL, SHAPE_TABLE, NO_NOTE},
+    {"len_zipf_quoted", 50000,     5,   30, true,  true,  true , ',',  LEN_ZIPF, NULL, SHAPE_TABLE, NO_NOTE},
+
+    /* Mixed-type columns - avg_field_size only feeds the --size row estimate */
+    {"schema_mixed",   100000,     6,    9, false, false, false, ',',  LEN_JITTER,
+        "int32,utf8(20),float,enum(5),date,bool", SHAPE_TABLE, NO_NOTE},
+    {"schema_quoted",   50000,     5,   12, true,  true,  true , ',',  LEN_JITTER,
+        "int64,str(30),float,str(10),date", SHAPE_TABLE, NO_NOTE},
+    {"schema_lengths", 100000,     5,   14, false, false, false, ',',  LEN_JITTER,
+        "int32,str(8),str(20:zipf),utf8(10:gaussian),str(15:uniform)", SHAPE_TABLE, NO_NOTE},
+
+    /* Adversarial inputs - compared against each parser's own average */
+    {"adv_single_row",       1, 1000000, 20, false, false, false, ',',  LEN_JITTER, NULL,
+        SHAPE_SINGLE_ROW, "A million fields before the first newline", 1, 1000000},
+    {"adv_huge_quoted",      1,     1, 8000000, true, true, true, ',',  LEN_JITTER, NULL,
+        SHAPE_HUGE_QUOTED, "One 8 MB quoted field full of delimiters and newlines", 1, 1},
+    {"adv_quote_delim",  200000,    50,    0, true,  false, false, ',',  LEN_JITTER, NULL,
+        SHAPE_QUOTE_DELIM, "Empty quoted fields: a quote or delimiter every byte", 200000, 10000000},
+    {"adv_escapes",      100000,     5,   40, true,  false, false, ',',  LEN_JITTER, NULL,
+        SHAPE_ESCAPES, "Fields made only of escaped quotes", 100000, 500000},
+    {"adv_no_final_eol", 100000,     5,   10, true,  false, false, ',',  LEN_JITTER, NULL,
+        SHAPE_NO_FINAL_EOL, "The last row ends in a quoted field at end of input", 100000, 500000},
+    {"adv_giant_line",       1, 100000, 80, false, false, false, ',',  LEN_JITTER, NULL,
+        SHAPE_GIANT_LINE, "One line with no newline at all", 1, 100000},
+};
+
+#define NUM_TESTS (sizeof(test_configs) / sizeof(test_configs[0]))
+
+/*
+ * Scenario validation - results, benchstat lines, baselines and temp
+ * files are all keyed by test name, so two entries sharing a name would
+ * silently overwrite each other. Names are compared ignoring case, as the
+ * temp files collide on case-insensitive filesystems. A repeated name
+ * with a different configuration is ambiguous and stops the run; an
+ * entry identical to an earlier one under any name only costs time, so
+ * the later copy is skipped.
+ */
+static int g_duplicate_of[NUM_TESTS];  /* index of the identical earlier entry, or -1 */
+
+static bool same_test_config(const test_config_t *a, const test_config_t *b) {
+    bool same_schema = (a->schema == NULL || b->schema == NULL)
+        ? a->schema == b->schema
+        : strcmp(a->schema, b->schema) == 0;
+    return a->rows == b->rows && a->fields_per_row == b->fields_per_row &&
+           a->avg_field_size == b->avg_field_size && a->has_quotes == b->has_quotes &&
+           a->has_newlines_in_fields == b->has_newlines_in_fields &&
+           a->has_commas_in_fields == b->has_commas_in_fields &&
+           a->delimiter == b->delimiter && a->length_dist == b->length_dist &&
+           a->shape == b->shape && same_schema;
+}
+
+static bool validate_test_configs(void) {
+    bool ok = true;
+    for (size_t t = 0; t < NUM_TESTS; t++) {
+        g_duplicate_of[t] = -1;
+        for (size_t u = 0; u < t; u++) {
+            bool same = same_test_config(&test_configs[u], &test_configs[t]);
+            if (strcasecmp(test_configs[u].name, test_configs[t].name) == 0 && !same) {
+                fprintf(stderr, "Error: tests %zu and %zu are both named %s but differ\n",
+                        u + 1, t + 1, test_configs[t].name);
+                ok = false;
+            } else if (same && g_duplicate_of[t] < 0) {
+                g_duplicate_of[t] = (int)u;
+            }
+        }
+    }
+    return ok;
+}
+
+/*
+ * Timing utilities - samples are kept as integer nanoseconds from the
+ * monotonic clock all the way into the stats and benchstat lines, so
+ * sub-millisecond parses don't lose digits to float rounding. Only the
+ * derived mean and stddev are converted to seconds.
+ */
+typedef struct {
+    uint64_t min;
+    uint64_t max;
+    uint64_t sum;
+    double sum_sq;    /* ns^2 overflows 64 bits past ~4 s samples */
+    size_t count;
+} timing_stats_t;
+
+static inline uint64_t get_time_ns(void) {
+    struct timespec ts;
+    clock_gettime(CLOCK_MONOTONIC, &ts);
+    return (uint64_t)ts.tv_sec * 1000000000ULL + ts.tv_nsec;
+}
+
+static void stats_init(timing_stats_t *s) {
+    s->min = UINT64_MAX;
+    s->max = 0;
+    s->sum = 0;
+    s->sum_sq = 0;
+    s->count = 0;
+}
+
+static void stats_add(timing_stats_t *s, uint64_t ns) {
+    if (ns < s->min) s->min = ns;
+    if (ns > s->max) s->max = ns;
+    s->sum += ns;
+    s->sum_sq += (double)ns * (double)ns;
+    s->count++;
+}
+
+/* Mean and stddev in seconds */
+static double stats_mean(const timing_stats_t *s) {
+    return s->count > 0 ? (double)s->sum / s->count / 1e9 : 0;
+}
+
+static double stats_stddev(const timing_stats_t *s) {
+    if (s->count < 2) return 0;
+    double mean = (double)s->sum / s->count;
+    double variance = (s->sum_sq / s->count) - (mean * mean);
+    return variance > 0 ? sqrt(variance) / 1e9 : 0;
+}
+
+/*
+ * Units for the human-readable tables (--units). mib is 2^20 bytes, the
+ * suite's historical "MB"; mb is 10^6, matching the benchstat lines;
+ * auto is mb but switches to GB/s (10^9) from 1000 MB/s up. Sizes use
+ * MiB under mib and MB otherwise. The benchstat lines ignore --units and
+ * carry raw ns/op and bytes/op, so tools never have to undo a rounding.
+ */
+typedef enum { UNITS_MIB, UNITS_MB, UNITS_AUTO } units_t;
+
+static units_t g_units = UNITS_MIB;
+
+static bool parse_units(const char *text, units_t *units) {
+    if (strcasecmp(text, "mib") == 0) *units = UNITS_MIB;
+    else if (strcasecmp(text, "mb") == 0) *units = UNITS_MB;
+    else if (strcasecmp(text, "auto") == 0 || strcasecmp(text, "gb") == 0) *units = UNITS_AUTO;
+    else return false;
+    return true;
+}
+
+static const char *format_size(char *buf, size_t size, double bytes) {
+    if (g_units == UNITS_MIB) snprintf(buf, size, "%.1fMiB", bytes / (1024.0 * 1024.0));
+    else snprintf(buf, size, "%.1fMB", bytes / 1e6);
+    return buf;
+}
+
+static const char *format_rate(char *buf, size_t size, double bytes, double seconds) {
+    double rate = seconds > 0 ? bytes / seconds : 0;
+    if (g_units == UNITS_MIB) snprintf(buf, size, "%.1fMiB/s", rate / (1024.0 * 1024.0));
+    else if (g_units == UNITS_AUTO && rate >= 1e9) snprintf(buf, size, "%.2fGB/s", rate / 1e9);
+    else snprintf(buf, size, "%.1fMB/s", rate / 1e6);
+    return buf;
+}
+
+/*
+ * Data generation
+ *
+ * Rows are assembled in a reusable chunk buffer that is written out once
+ * it passes GEN_FLUSH_SIZE, and field content comes from an xorshift64*
+ * generator - no per-field allocation, and one draw covers eight bytes.
+ */
+static uint64_t g_rng_state = 12345;
+
+static inline uint64_t rng_next64(void) {
+    g_rng_state ^= g_rng_state >> 12;
+    g_rng_state ^= g_rng_state << 25;
+    g_rng_state ^= g_rng_state >> 27;
+    return g_rng_state * 0x2545F4914F6CDD1DULL;
+}
+
+static inline uint32_t rng_next(void) {
+    return (uint32_t)(rng_next64() >> 32);
+}
+
+static void rng_seed(uint64_t seed) {
+    g_rng_state = seed ? seed : 0x9E3779B97F4A7C15ULL;  /* xorshift state must be non-zero */
+}
+
+/* Every generated file starts from this seed, so runs are reproducible */
+#define GEN_SEED 42
+static uint64_t g_gen_seed = GEN_SEED;  /* moved only by --reshuffle, see reshuffle_input() */
+
+/*
+ * Column schemas - a comma-separated list of column types:
+ *   int32, int64, float, bool, date   fixed-format values
+ *   str(N)                            charset text, average length N
+ *   utf8(N)                           text mixing 1-3 byte UTF-8 characters
+ *   enum(K)                           one of K short labels
+ * str and utf8 take an optional length distribution, as in str(20:zipf),
+ * for that column alone; without one they use the test's. Only str()
+ * columns can contain delimiters or newlines, so only they are ever quoted.
+ */
+typedef enum {
+    COL_INT32,
+    COL_INT64,
+    COL_FLOAT,
+    COL_BOOL,
+    COL_DATE,
+    COL_STR,
+    COL_UTF8,
+    COL_ENUM
+} column_type_t;
+
+typedef struct {
+    column_type_t type;
+    size_t param;         /* Length for str/utf8, cardinality for enum */
+    bool has_dist;        /* str/utf8 only: dist overrides the test's */
+    length_dist_t dist;
+} column_spec_t;
+
+/* Returns the number of columns parsed, or 0 if the schema is malformed */
+static size_t parse_schema(const char *schema, column_spec_t *cols, size_t max_cols) {
+    static const struct {
+        const char *name;
+        column_type_t type;
+        bool has_param, has_dist;
+    } types[] = {
+        {"int32", COL_INT32, false, false}, {"int64", COL_INT64, false, false},
+        {"float", COL_FLOAT, false, false}, {"bool",  COL_BOOL,  false, false},
+        {"date",  COL_DATE,  false, false}, {"str",   COL_STR,   true,  true },
+        {"utf8",  COL_UTF8,  true,  true }, {"enum",  COL_ENUM,  true,  false},
+    };
+
+    size_t count = 0;
+    const char *p = schema;
+    while (*p) {
+        if (count == max_cols) return 0;
+
+        size_t name_len = strcspn(p, "(,");
+        bool matched = false;
+        for (size_t t = 0; t < sizeof(types) / sizeof(types[0]); t++) {
+            if (strlen(types[t].name) != name_len || strncmp(p, types[t].name, name_len) != 0) {
+                continue;
+            }
+            cols[count].type = types[t].type;
+            cols[count].param = 0;
+            cols[count].has_dist = false;
+            cols[count].dist = LEN_JITTER;
+            p += name_len;
+            if (types[t].has_param) {
+                char *end;
+                if (*p != '(') return 0;
+                unsigned long v = strtoul(p + 1, &end, 10);
+                if (end == p + 1 || v == 0) return 0;
+                cols[count].param = v;
+                if (*end == ':' && types[t].has_dist) {
+                    const char *dist = end + 1;
+                    size_t dist_len = strcspn(dist, ")");
+                    size_t d = 0;
+                    while (d < sizeof(length_dist_names) / sizeof(length_dist_names[0]) &&
+                           (strlen(length_dist_names[d]) != dist_len ||
+                            strncmp(dist, length_dist_names[d], dist_len) != 0)) {
+                        d++;
+                    }
+                    if (d == sizeof(length_dist_names) / sizeof(length_dist_names[0])) return 0;
+                    cols[count].has_dist = true;
+                    cols[count].dist = (length_dist_t)d;
+                    end = (char *)dist + dist_len;
+                }
+                if (*end != ')') return 0;
+                p = end + 1;
+            } else if (*p == '(') {
+                return 0;
+            }
+            matched = true;
+            break;
+        }
+        if (!matched) return 0;
+
+        count++;
+        if (*p == ',') {
+            p++;
+            if (*p == '\0') return 0;
+        } else if (*p != '\0') {
+            return 0;
+        }
+    }
+    return count;
+}
+
+/*
+ * Maps a random byte to an output character. Roughly 3% of entries are the
+ * delimiter and 2% newlines when those are allowed; the rest cycle through
+ * the alphanumeric charset. A table lets every field use the same
+ * eight-characters-per-draw loop whatever its content mix.
+ */
+static void build_char_table(char table[256], bool allow_delim, bool allow_newline, char delim) {
+    static const char charset[] = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 ";
+    for (int i = 0; i < 256; i++) {
+        int pct = i * 100 / 256;
+        if (allow_delim && pct < 3) {
+            table[i] = delim;
+        } else if (allow_newline && pct < 5) {
+            table[i] = '\n';
+        } else {
+            table[i] = charset[i % (sizeof(charset) - 1)];
+        }
+    }
+}
+
+static double rng_unit(void) {
+    return (rng_next64() >> 11) * (1.0 / 9007199254740992.0);  /* [0, 1) */
+}
+
+static size_t field_length(size_t target_len, length_dist_t dist) {
+    double len;
+    switch (dist) {
+        case LEN_UNIFORM:
+            len = 1 + (double)(((uint64_t)rng_next() * (2 * target_len)) >> 32);
+            break;
+        case LEN_GAUSSIAN: {
+            /* Box-Muller; 1 - u keeps log() away from zero */
+            double u1 = 1.0 - rng_unit(), u2 = rng_unit();
+            double z = sqrt(-2.0 * log(u1)) * cos(2.0 * M_PI * u2);
+            len = target_len + z * (target_len / 3.0);
+            break;
+        }
+        case LEN_ZIPF: {
+            /* Pareto with scale avg/3 has mean avg when alpha is 1.5 */
+            double u = 1.0 - rng_unit();
+            len = (target_len / 3.0) / pow(u, 1.0 / 1.5);
+            break;
+        }
+        case LEN_JITTER:
+        default: {
+            size_t spread = target_len / 2 + 1;
+            len = (double)(target_len + (size_t)(((uint64_t)rng_next() * spread) >> 32) - target_len / 4);
+            break;
+        }
+    }
+    return len < 1 ? 1 : (len > (double)SIZE_MAX / 2 ? SIZE_MAX / 2 : (size_t)len);
+}
+
+/*
+ * Fills buf with a random field and returns its length (buf is not terminated).
+ * Characters are written eight at a time, so buf needs 7 bytes of slack past
+ * the returned length.
+ */
+static size_t generate_field(char *buf, size_t max_len, size_t target_len,
+                             length_dist_t dist, const char table[256]) {
+    size_t len = field_length(target_len, dist);
+    if (len >= max_len) len = max_len - 1;
+
+    for (size_t i = 0; i < len; i += 8) {
+        uint64_t r = rng_next64();
+        char *p = buf + i;
+        p[0] = table[r & 0xFF];
+        p[1] = table[(r >> 8) & 0xFF];
+        p[2] = table[(r >> 16) & 0xFF];
+        p[3] = table[(r >> 24) & 0xFF];
+        p[4] = table[(r >> 32) & 0xFF];
+        p[5] = table[(r >> 40) & 0xFF];
+        p[6] = table[(r >> 48) & 0xFF];
+        p[7] = table[r >> 56];
+    }
+    return len;
+}
+
+/* Appends field to dst, quoting and escaping only when the content requires it */
+static size_t append_field(char *dst, const char *field, size_t len, bool allow_quotes, char delim) {
+    bool needs_quotes = false;
+    if (allow_quotes) {
+        for (size_t i = 0; i < len; i++) {
+            char c = field[i];
+            if (c == delim || c == '\n' || c == '\r' || c == '"') {
+                needs_quotes = true;
+                break;
+            }
+        }
+    }
+
+    if (!needs_quotes) {
+        memcpy(dst, field, len);
+        return len;
+    }
+
+    size_t n = 0;
+    dst[n++] = '"';
+    for (size_t i = 0; i < len; i++) {
+        if (field[i] == '"') dst[n++] = '"';
+        dst[n++] = field[i];
+    }
+    dst[n++] = '"';
+    return n;
+}
+
+/*
+ * Number locales - --number-locale writes int and float columns the way a
+ * spreadsheet export in that locale would, with thousands separators and
+ * a decimal comma. With a ',' delimiter those fields must be quoted, so a
+ * parser, or a harness, that assumes '.' and a bare number breaks.
+ */
+typedef struct {
+    const char *name;
+    const char *group;  /* thousands separator */
+    char decimal;
+} number_locale_t;
+
+static const number_locale_t number_locales[] = {
+    {"de", ".", ','},             /* 1.234.567,8900 */
+    {"fr", "\xe2\x80\xaf", ','},  /* narrow no-break space: 1 234 567,8900 */
+    {"ch", "'", '.'},             /* 1'234'567.8900 */
+};
+
+static const number_locale_t *g_gen_number_locale;  /* NULL = C formatting */
+
+static const number_locale_t *find_number_locale(const char *name) {
+    for (size_t i = 0; i < sizeof(number_locales) / sizeof(number_locales[0]); i++) {
+        if (strcmp(number_locales[i].name, name) == 0) return &number_locales[i];
+    }
+    return NULL;
+}
+
+/* Rewrites the C-formatted number in buf for --number-locale; returns its new length */
+static size_t localize_number(char *buf, size_t len, size_t max_len) {
+    const number_locale_t *loc = g_gen_number_locale;
+    char out[96];
+    if (!loc || len > 32) return len;
+
+    const size_t group_len = strlen(loc->group);
+    size_t i = 0, n = 0;
+    if (buf[0] == '-') out[n++] = buf[i++];
+    size_t digits = 0;
+    while (i + digits < len && buf[i + digits] >= '0' && buf[i + digits] <= '9') digits++;
+    for (size_t d = 0; d < digits; d++) {
+        if (d > 0 && (digits - d) % 3 == 0) {
+            memcpy(out + n, loc->group, group_len);
+            n += group_len;
+        }
+        out[n++] = buf[i + d];
+    }
+    for (i += digits; i < len; i++) out[n++] = buf[i] == '.' ? loc->decimal : buf[i];
+    if (n > max_len) return len;
+    memcpy(buf, out, n);
+    return n;
+}
+
+/* Writes one value of a schema column to buf and returns its length */
+static size_t generate_typed_field(char *buf, size_t max_len, const column_spec_t *col,
+                                   length_dist_t dist, const char table[256]) {
+    static const char *const glyphs[] = {
+        "a", "e", "t", "o", "n", "R", "S", "7", " ",           /* 1 byte */
+        "\xc3\xa9", "\xc3\xbc", "\xc3\x9f", "\xd0\xb6", "\xd1\x8f",  /* 2 bytes */
+        "\xe6\x97\xa5", "\xe6\x9c\xac", "\xe2\x82\xac",              /* 3 bytes */
+    };
+    int n;
+
+    switch (col->type) {
+        case COL_INT32:
+            n = snprintf(buf, max_len, "%d", (int)(int32_t)rng_next());
+            return n > 0 ? localize_number(buf, (size_t)n, max_len) : 0;
+        case COL_INT64:
+            n = snprintf(buf, max_len, "%lld", (long long)(int64_t)rng_next64());
+            return n > 0 ? localize_number(buf, (size_t)n, max_len) : 0;
+        case COL_FLOAT:
+            n = snprintf(buf, max_len, "%.4f", (rng_unit() - 0.5) * 2e6);
+            return n > 0 ? localize_number(buf, (size_t)n, max_len) : 0;
+        case COL_BOOL:
+            n = snprintf(buf, max_len, "%s", (rng_next() & 1) ? "true" : "false");
+            break;
+        case COL_DATE: {
+            uint32_t r = rng_next();
+            n = snprintf(buf, max_len, "%04u-%02u-%02u",
+                         1970 + r % 68, 1 + (r >> 8) % 12, 1 + (r >> 16) % 28);
+            break;
+        }
+        case COL_ENUM:
+            n = snprintf(buf, max_len, "cat%zu", (size_t)rng_next() % col->param);
+            break;
+        case COL_UTF8: {
+            if (col->has_dist) dist = col->dist;
+            size_t chars = field_length(col->param, dist);
+            size_t len = 0;
+            for (size_t c = 0; c < chars && len + 4 < max_len; c++) {
+                const char *g = glyphs[rng_next() % (sizeof(glyphs) / sizeof(glyphs[0]))];
+                size_t glen = strlen(g);
+                memcpy(buf + len, g, glen);
+                len += glen;
+            }
+            return len;
+        }
+        case COL_STR:
+        default:
+            if (col->has_dist) dist = col->dist;
+            return generate_field(buf, max_len, col->param, dist, table);
+    }
+    return n > 0 ? (size_t)n : 0;
+}
+
+/*
+ * SHA-256 (FIPS 180-4), used by --hash to fingerprint each generated file
+ * as its chunks are written, so no second read pass is needed.
+ */
+typedef struct {
+    uint32_t state[8];
+    uint64_t length;      /* bytes hashed so far */
+    uint8_t block[64];
+    size_t block_len;
+} sha256_t;
+
+static const uint32_t sha256_k[64] = {
+    0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+    0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+    0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+    0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+    0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+    0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+    0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+    0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2,
+};
+
+#define SHA256_ROTR(x, n) (((x) >> (n)) | ((x) << (32 - (n))))
+
+static void sha256_init(sha256_t *h) {
+    static const uint32_t initial[8] = {
+        0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a, 0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19,
+    };
+    memcpy(h->state, initial, sizeof(initial));
+    h->length = 0;
+    h->block_len = 0;
+}
+
+static void sha256_compress(uint32_t state[8], const uint8_t *block) {
+    uint32_t w[64];
+    for (int i = 0; i < 16; i++) {
+        w[i] = (uint32_t)block[4 * i] << 24 | (uint32_t)block[4 * i + 1] << 16 |
+               (uint32_t)block[4 * i + 2] << 8 | block[4 * i + 3];
+    }
+    for (int i = 16; i < 64; i++) {
+        uint32_t s0 = SHA256_ROTR(w[i - 15], 7) ^ SHA256_ROTR(w[i - 15], 18) ^ (w[i - 15] >> 3);
+        uint32_t s1 = SHA256_ROTR(w[i - 2], 17) ^ SHA256_ROTR(w[i - 2], 19) ^ (w[i - 2] >> 10);
+        w[i] = w[i - 16] + s0 + w[i - 7] + s1;
+    }
+
+    uint32_t a = state[0], b = state[1], c = state[2], d = state[3];
+    uint32_t e = state[4], f = state[5], g = state[6], h = state[7];
+    for (int i = 0; i < 64; i++) {
+        uint32_t t1 = h + (SHA256_ROTR(e, 6) ^ SHA256_ROTR(e, 11) ^ SHA256_ROTR(e, 25)) +
+                      ((e & f) ^ (~e & g)) + sha256_k[i] + w[i];
+        uint32_t t2 = (SHA256_ROTR(a, 2) ^ SHA256_ROTR(a, 13) ^ SHA256_ROTR(a, 22)) +
+                      ((a & b) ^ (a & c) ^ (b & c));
+        h = g; g = f; f = e; e = d + t1;
+        d = c; c = b; b = a; a = t1 + t2;
+    }
+    state[0] += a; state[1] += b; state[2] += c; state[3] += d;
+    state[4] += e; state[5] += f; state[6] += g; state[7] += h;
+}
+
+static void sha256_update(sha256_t *h, const void *data, size_t len) {
+    const uint8_t *p = data;
+    h->length += len;
+    if (h->block_len > 0) {
+        size_t take = 64 - h->block_len < len ? 64 - h->block_len : len;
+        memcpy(h->block + h->block_len, p, take);
+        h->block_len += take;
+        p += take;
+        len -= take;
+        if (h->block_len < 64) return;
+        sha256_compress(h->state, h->block);
+        h->block_len = 0;
+    }
+    for (; len >= 64; p += 64, len -= 64) sha256_compress(h->state, p);
+    memcpy(h->block, p, len);
+    h->block_len = len;
+}
+
+/* Writes the digest as 64 hex digits plus a terminator */
+static void sha256_final(sha256_t *h, char hex[65]) {
+    uint64_t bits = h->length * 8;
+    uint8_t pad[72] = {0x80};
+    size_t pad_len = (h->block_len < 56 ? 56 : 120) - h->block_len;
+    for (int i = 0; i < 8; i++) pad[pad_len + i] = (uint8_t)(bits >> (56 - 8 * i));
+    sha256_update(h, pad, pad_len + 8);
+    for (int i = 0; i < 8; i++) snprintf(hex + 8 * i, 9, "%08x", h->state[i]);
+}
+
+/* Records a correct parser should report for a generated file */
+typedef struct {
+    size_t rows;
+    size_t fields;
+    char sha256[65];  /* hex digest with --hash, otherwise empty */
+} gen_counts_t;
+
+/*
+ * Generator output - chunks go either through stdio or, with --gen-mmap,
+ * into a file preallocated up front (posix_fallocate on Linux) and mapped
+ * into memory, which skips the write() syscalls and keeps multi-GB test
+ * files contiguous on disk. The mapping grows by doubling if the size
+ * hint was short, and the file is truncated to its real size on close.
+ */
+static bool g_gen_mmap;
+static bool g_gen_hash;
+static double g_gen_nul_rate;  /* --nul-rate: share of text fields given a NUL byte */
+
+/* With --nul-rate, overwrites one random byte of the field with NUL */
+static void sprinkle_nul(char *field, size_t len) {
+    if (g_gen_nul_rate <= 0 || len == 0 || rng_unit() >= g_gen_nul_rate) return;
+    field[rng_next() % len] = '\0';
+}
+
+/*
+ * Spreadsheet formulas - with --formula-rate that share of text fields is
+ * replaced by a value a spreadsheet would evaluate (the CSV injection
+ * prefixes = @ + -). None holds a delimiter, quote or newline, so the
+ * row and field counts are unchanged; a parser has to hand them over
+ * byte for byte, which print_formula_behavior() checks.
+ */
+static double g_gen_formula_rate;
+
+static const char *const formula_values[] = {
+    "=SUM(A1:A9)", "@SUM(1+1)", "+1+1", "-2+3", "=HYPERLINK(A1)", "=1+1",
+};
+
+/* Returns the new field length */
+static size_t sprinkle_formula(char *field, size_t len) {
+    if (g_gen_formula_rate <= 0 || rng_unit() >= g_gen_formula_rate) return len;
+    const char *value = formula_values[rng_next() % (sizeof(formula_values) / sizeof(formula_values[0]))];
+    size_t n = strlen(value);
+    memcpy(field, value, n);
+    return n;
+}
+
+typedef struct {
+    FILE *f;          /* stdio mode */
+    int fd;           /* mmap mode */
+    char *map;
+    size_t capacity;  /* bytes allocated and mapped */
+    size_t total;     /* bytes written so far */
+    sha256_t hash;    /* fed every chunk when g_gen_hash is set */
+} gen_out_t;
+
+static bool gen_out_reserve(gen_out_t *o, size_t capacity) {
+    if (o->map && munmap(o->map, o->capacity) != 0) return false;
+    o->map = NULL;
+#ifdef __linux__
+    if (posix_fallocate(o->fd, 0, (off_t)capacity) != 0 &&
+        ftruncate(o->fd, (off_t)capacity) != 0) return false;
+#else
+    if (ftruncate(o->fd, (off_t)capacity) != 0) return false;
+#endif
+    void *map = mmap(NULL, capacity, PROT_READ | PROT_WRITE, MAP_SHARED, o->fd, 0);
+    if (map == MAP_FAILED) return false;
+    o->map = map;
+    o->capacity = capacity;
+    return true;
+}
+
+static bool gen_open(gen_out_t *o, const char *path, size_t size_hint) {
+    memset(o, 0, sizeof(*o));
+    o->fd = -1;
+    if (g_gen_hash) sha256_init(&o->hash);
+    if (!g_gen_mmap) {
+        o->f = fopen(path, "wb");
+        return o->f != NULL;
+    }
+    o->fd = open(path, O_RDWR | O_CREAT | O_TRUNC, 0644);
+    if (o->fd < 0) return false;
+    if (!gen_out_reserve(o, size_hint > GEN_FLUSH_SIZE ? size_hint : GEN_FLUSH_SIZE)) {
+        close(o->fd);
+        return false;
+    }
+    return true;
+}
+
+static bool gen_flush(gen_out_t *o, char *buf, size_t *n) {
+    if (*n == 0) return true;
+    if (o->f) {
+        if (fwrite(buf, 1, *n, o->f) != *n) return false;
+    } else {
+        if (o->total + *n > o->capacity) {
+            size_t capacity = o->capacity * 2;
+            if (capacity < o->total + *n) capacity = o->total + *n;
+            if (!gen_out_reserve(o, capacity)) return false;
+        }
+        memcpy(o->map + o->total, buf, *n);
+    }
+    if (g_gen_hash) sha256_update(&o->hash, buf, *n);
+    o->total += *n;
+    *n = 0;
+    return true;
+}
+
+/* Returns false if anything failed since gen_open(), including ok == false */
+static bool gen_close(gen_out_t *o, bool ok, char sha256[65]) {
+    sha256[0] = '\0';
+    if (g_gen_hash && ok) sha256_final(&o->hash, sha256);
+    if (o->f) return fclose(o->f) == 0 && ok;
+    if (o->map && munmap(o->map, o->capacity) != 0) ok = false;
+    if (ftruncate(o->fd, (off_t)o->total) != 0) ok = false;
+    return close(o->fd) == 0 && ok;
+}
+
+/*
+ * Writes one of the adversarial shapes. With a non-zero target_bytes the
+ * dimension that makes the shape hard - row width, field length or row
+ * count - is scaled to reach it.
+ */
+static size_t generate_adversarial_file(const test_config_t *config, const char *filepath,
+                                        size_t target_bytes, gen_counts_t *counts) {
+    size_t rows = config->rows;
+    size_t fields = config->fields_per_row;
+    size_t field_len = config->avg_field_size;
+    const char delim = config->delimiter;
+
+    if (target_bytes > 0) {
+        switch (config->shape) {
+            case SHAPE_SINGLE_ROW:
+            case SHAPE_GIANT_LINE:  fields = target_bytes / (field_len + 1); break;
+            case SHAPE_HUGE_QUOTED: field_len = target_bytes; break;
+            case SHAPE_QUOTE_DELIM: rows = target_bytes / (fields * 3); break;
+            case SHAPE_ESCAPES:     rows = target_bytes / (fields * (field_len + 3)); break;
+            case SHAPE_NO_FINAL_EOL: rows = target_bytes / (fields * (field_len + 1)); break;
+            case SHAPE_TABLE:       break;
+        }
+        if (rows == 0) rows = 1;
+        if (fields == 0) fields = 1;
+    }
+
+    gen_out_t out;
+    if (!gen_open(&out, filepath, target_bytes)) {
+        fprintf(stderr, "Error: Cannot create file %s: %s\n", filepath, strerror(errno));
+        return 0;
+    }
+    /* Room for one flush chunk plus the largest single unit appended after it */
+    char *buf = malloc(GEN_FLUSH_SIZE + 2 * MAX_FIELD_SIZE + 16);
+    if (!buf) {
+        gen_close(&out, false, counts->sha256);
+        return 0;
+    }
+
+    rng_seed(g_gen_seed);
+    char table[256];
+    build_char_table(table, true, true, delim);
+
+    size_t n = 0;
+    bool ok = true;
+
+    switch (config->shape) {
+        case SHAPE_SINGLE_ROW:
+        case SHAPE_GIANT_LINE: {
+            char plain[256];
+            build_char_table(plain, false, false, delim);
+            for (size_t i = 0; i < fields && ok; i++) {
+                if (i > 0) buf[n++] = delim;
+                n += generate_field(buf + n, MAX_FIELD_SIZE, field_len, config->length_dist, plain);
+                if (n >= GEN_FLUSH_SIZE) ok = gen_flush(&out, buf, &n);
+            }
+            if (config->shape == SHAPE_SINGLE_ROW) buf[n++] = '\n';
+            rows = 1;
+            break;
+        }
+        case SHAPE_NO_FINAL_EOL: {
+            char plain[256];
+            build_char_table(plain, false, false, delim);
+            for (size_t r = 0; r < rows && ok; r++) {
+                if (r > 0) buf[n++] = '\n';
+                for (size_t i = 0; i < fields; i++) {
+                    if (i > 0) buf[n++] = delim;
+                    bool last = r == rows - 1 && i == fields - 1;
+                    if (last) buf[n++] = '"';
+                    n += generate_field(buf + n, MAX_FIELD_SIZE, field_len, config->length_dist, plain);
+                    if (last) buf[n++] = '"';
+                }
+                if (n >= GEN_FLUSH_SIZE) ok = gen_flush(&out, buf, &n);
+            }
+            break;
+        }
+        case SHAPE_HUGE_QUOTED: {
+            /* Content is drawn from a table without quotes, so no escaping is needed */
+            buf[n++] = '"';
+            size_t remaining = field_len;
+            while (remaining > 0 && ok) {
+                size_t chunk = remaining < GEN_FLUSH_SIZE ? remaining : GEN_FLUSH_SIZE;
+                for (size_t i = 0; i < chunk; i += 8) {
+                    uint64_t r = rng_next64();
+                    for (int k = 0; k < 8; k++, r >>= 8) buf[n + i + k] = table[r & 0xFF];
+                }
+                n += chunk;
+                remaining -= chunk;
+                ok = gen_flush(&out, buf, &n);
+            }
+            buf[n++] = '"';
+            buf[n++] = '\n';
+            rows = 1;
+            fields = 1;
+            break;
+        }
+        case SHAPE_QUOTE_DELIM:
+            for (size_t r = 0; r < rows && ok; r++) {
+                for (size_t i = 0; i < fields; i++) {
+                    if (i > 0) buf[n++] = delim;
+                    buf[n++] = '"';
+                    buf[n++] = '"';
+                    if (n >= GEN_FLUSH_SIZE) ok = ok && gen_flush(&out, buf, &n);
+                }
+                buf[n++] = '\n';
+            }
+            break;
+        case SHAPE_ESCAPES: {
+            size_t pairs = field_len / 2 > 0 ? field_len / 2 : 1;
+            if (pairs > MAX_FIELD_SIZE / 2) pairs = MAX_FIELD_SIZE / 2;
+            for (size_t r = 0; r < rows && ok; r++) {
+                for (size_t i = 0; i < fields; i++) {
+                    if (i > 0) buf[n++] = delim;
+                    buf[n++] = '"';
+                    memset(buf + n, '"', 2 * pairs);
+                    n += 2 * pairs;
+                    buf[n++] = '"';
+                    if (n >= GEN_FLUSH_SIZE) ok = ok && gen_flush(&out, buf, &n);
+                }
+                buf[n++] = '\n';
+            }
+            break;
+        }
+        case SHAPE_TABLE:
+            break;
+    }
+    if (ok) ok = gen_flush(&out, buf, &n);
+
+    free(buf);
+    if (!gen_close(&out, ok, counts->sha256)) {
+        fprintf(stderr, "Error: Cannot write file %s: %s\n", filepath, strerror(errno));
+        return 0;
+    }
+
+    counts->rows = rows;
+    counts->fields = rows * fields;
+    return out.total;
+}
+
+/*
+ * Row estimate for a target file size, before any bytes have been written.
+ * Each field costs its average length plus a separator; quoting and length
+ * jitter are left to the feedback loop in generate_test_file().
+ */
+static size_t estimate_rows_for_size(const test_config_t *config, size_t target_bytes) {
+    size_t row_bytes = config->fields_per_row * (config->avg_field_size + 1);
+    size_t rows = target_bytes / (row_bytes ? row_bytes : 1);
+    return rows > 0 ? rows : 1;
+}
+
+/*
+ * Writes the test file and returns its size in bytes (0 on failure). With a
+ * non-zero target_bytes the row count is derived from the target instead of
+ * config->rows: after 1% of the estimate has been written, and again at
+ * every doubling, the remaining rows are recomputed from the measured
+ * bytes per row. The rows and fields a correct parser reports, header
+ * included, go to *counts.
+ */
+static size_t generate_test_file(const test_config_t *config, const char *filepath,
+                                 size_t target_bytes, gen_counts_t *counts) {
+    if (config->shape != SHAPE_TABLE) {
+        return generate_adversarial_file(config, filepath, target_bytes, counts);
+    }
+
+    size_t size_hint = target_bytes > 0 ? target_bytes
+                     : config->rows * config->fields_per_row * (config->avg_field_size + 1);
+    gen_out_t out;
+    if (!gen_open(&out, filepath, size_hint)) {
+        fprintf(stderr, "Error: Cannot create file %s: %s\n", filepath, strerror(errno));
+        return 0;
+    }
+
+    /* Worst case per field: every byte doubled, two quotes and a separator */
+    size_t row_cap = config->fields_per_row * (2 * MAX_FIELD_SIZE + 3) + 1;
+    size_t buf_cap = GEN_FLUSH_SIZE + row_cap;
+    char *buf = malloc(buf_cap);
+    if (!buf) {
+        gen_close(&out, false, counts->sha256);
+        return 0;
+    }
+
+    rng_seed(g_gen_seed);  /* Deterministic for reproducibility */
+
+    char field_buf[MAX_FIELD_SIZE + 8];
+    bool ok = true;
+    const char delim = config->delimiter;
+    const bool special_chars = config->has_commas_in_fields || config->has_newlines_in_fields;
+    char table[256];
+    build_char_table(table, config->has_commas_in_fields, config->has_newlines_in_fields, delim);
+
+    column_spec_t cols[MAX_FIELDS_PER_ROW];
+    if (config->schema) {
+        size_t n_cols = parse_schema(config->schema, cols, MAX_FIELDS_PER_ROW);
+        if (n_cols != config->fields_per_row) {
+            fprintf(stderr, "Error: Schema \"%s\" for %s must describe exactly %zu columns\n",
+                    config->schema, config->name, config->fields_per_row);
+            free(buf);
+            gen_close(&out, false, counts->sha256);
+            unlink(filepath);
+            return 0;
+        }
+    }
+
+    /* Generate header row */
+    size_t n = 0;
+    for (size_t col = 0; col < config->fields_per_row; col++) {
+        if (col > 0) buf[n++] = delim;
+        n += (size_t)snprintf(buf + n, buf_cap - n, "col%zu", col);
+    }
+    buf[n++] = '\n';
+
+    size_t rows = config->rows;
+    size_t checkpoint = SIZE_MAX;
+    if (target_bytes > 0) {
+        rows = estimate_rows_for_size(config, target_bytes);
+        checkpoint = rows / 100 > 16 ? rows / 100 : 16;
+    }
+
+    /* Generate data rows, flushing whole chunks rather than individual rows */
+    size_t row = 0;
+    for (; row < rows && ok; row++) {
+        if (row == checkpoint) {
+            size_t written = out.total + n;
+            double bytes_per_row = (double)written / (double)row;
+            rows = written >= target_bytes ? row
+                 : row + (size_t)((double)(target_bytes - written) / bytes_per_row + 0.5);
+            checkpoint *= 2;
+            if (row >= rows) break;
+        }
+
+        for (size_t col = 0; col < config->fields_per_row; col++) {
+            if (col > 0) buf[n++] = delim;
+
+            if (config->schema) {
+                size_t len = generate_typed_field(field_buf, MAX_FIELD_SIZE, &cols[col],
+                                                  config->length_dist, table);
+                /* A decimal comma has to be quoted even in an otherwise unquoted test */
+                n += append_field(buf + n, field_buf, len,
+                                  config->has_quotes || g_gen_number_locale != NULL, delim);
+                continue;
+            }
+
+            if (!special_chars) {
+                /* Charset-only content never needs quoting - write it in place */
+                size_t len = generate_field(buf + n, MAX_FIELD_SIZE, config->avg_field_size,
+                                            config->length_dist, table);
+                len = sprinkle_formula(buf + n, len);
+                sprinkle_nul(buf + n, len);
+                n += len;
+                continue;
+            }
+
+            size_t len = generate_field(field_buf, MAX_FIELD_SIZE, config->avg_field_size,
+                                        config->length_dist, table);
+            len = sprinkle_formula(field_buf, len);
+            sprinkle_nul(field_buf, len);
+            n += append_field(buf + n, field_buf, len, config->has_quotes, delim);
+        }
+        buf[n++] = '\n';
+
+        if (n >= GEN_FLUSH_SIZE) ok = gen_flush(&out, buf, &n);
+    }
+    if (ok) ok = gen_flush(&out, buf, &n);
+    counts->rows = row + 1;  /* +1 for header row */
+    counts->fields = (row + 1) * config->fields_per_row;
+
+    free(buf);
+    if (!gen_close(&out, ok, counts->sha256)) {
+        fprintf(stderr, "Error: Cannot write file %s: %s\n", filepath, strerror(errno));
+        return 0;
+    }
+    return out.total;
+}
+
+/*
+ * Benchmark state - identical for both parsers
+ */
+typedef struct {
+    uint64_t rows_parsed;
+    uint64_t fields_parsed;
+    uint64_t bytes_processed;
+    uint64_t read_ns;            /* Time inside read calls; 0 when the runner can't split it out */
+    volatile uint64_t checksum;  /* Prevent optimizer from removing work */
+} bench_state_t;
+
+/*
+ * SonicSV callback
+ */
+static void sonicsv_row_callback(const csv_row_t *row, void *user_data) {
+    bench_state_t *state = (bench_state_t *)user_data;
+    state->rows_parsed++;
+    state->fields_parsed += row->num_fields;
+
+    /* Compute checksum to ensure we actually process data */
+    for (size_t i = 0; i < row->num_fields; i++) {
+        const csv_field_t *field = csv_get_field(row, i);
+        if (field && field->data && field->size > 0) {
+            state->checksum += (uint64_t)field->data[0];
+        }
+    }
+}
+
+/*
+ * libcsv callbacks
+ */
+static void libcsv_field_callback(void *data, size_t len, void *user_data) {
+    bench_state_t *state = (bench_state_t *)user_data;
+    state->fields_parsed++;
+    if (len > 0) {
+        state->checksum += (uint64_t)((char *)data)[0];
+    }
+}
+
+static void libcsv_row_callback(int delim, void *user_data) {
+    (void)delim;
+    bench_state_t *state = (bench_state_t *)user_data;
+    state->rows_parsed++;
+}
+
+/*
+ * Benchmark runners
+ */
+static int64_t run_sonicsv_benchmark(const char *filepath, size_t file_size, char delim,
+                                     bench_state_t *state) {
+    memset(state, 0, sizeof(*state));
+
+    csv_parse_options_t options = csv_default_options();
+    options.delimiter = delim;
+
+    csv_parser_t *parser = csv_parser_create(&options);
+    if (!parser) {
+        fprintf(stderr, "Error: Failed to create SonicSV parser\n");
+        return -1;
+    }
+
+    csv_parser_set_row_callback(parser, sonicsv_row_callback, state);
+
+    /* csv_parse_file maps the file, so reads are page faults inside the parse: read_ns stays 0 */
+    uint64_t start = get_time_ns();
+    csv_error_t result = csv_parse_file(parser, filepath);
+    uint64_t end = get_time_ns();
+
+    if (result != CSV_OK) {
+        fprintf(stderr, "Error: SonicSV parse failed: %s\n", csv_error_string(result));
+        csv_parser_destroy(parser);
+        return -1;
+    }
+
+    state->bytes_processed = file_size;
+    csv_parser_destroy(parser);
+
+    return (int64_t)(end - start);
+}
+
+static int64_t run_libcsv_benchmark(const char *filepath, size_t file_size, char delim,
+                                    bench_state_t *state) {
+    memset(state, 0, sizeof(*state));
+
+    struct csv_parser parser;
+    if (csv_init(&parser, CSV_STRICT) != 0) {
+        fprintf(stderr, "Error: Failed to create libcsv parser\n");
+        return -1;
+    }
+    csv_set_delim(&parser, (unsigned char)delim);
+
+    FILE *f = fopen(filepath, "rb");
+    if (!f) {
+        fprintf(stderr, "Error: Cannot open file %s\n", filepath);
+        csv_free(&parser);
+        return -1;
+    }
+
+    char *buffer = malloc(65536);
+    if (!buffer) {
+        fclose(f);
+        csv_free(&parser);
+        return -1;
+    }
+
+    uint64_t start = get_time_ns();
+
+    size_t bytes_read;
+    for (;;) {
+        uint64_t read_start = get_time_ns();
+        bytes_read = fread(buffer, 1, 65536, f);
+        state->read_ns += get_time_ns() - read_start;
+        if (bytes_read == 0) break;
+        if (csv_parse(&parser, buffer, bytes_read,
+                      libcsv_field_callback, libcsv_row_callback, state) != bytes_read) {
+            fprintf(stderr, "Error: libcsv parse error: %s\n", csv_strerror(csv_error(&parser)));
+            break;
+        }
+    }
+    csv_fini(&parser, libcsv_field_callback, libcsv_row_callback, state);
+
+    uint64_t end = get_time_ns();
+
+    fclose(f);
+    free(buffer);
+    csv_free(&parser);
+
+    state->bytes_processed = file_size;
+    return (int64_t)(end - start);
+}
+
+/*
+ * Reference parser - a plain RFC 4180 state machine with the same
+ * counting and checksum rules as the callbacks above. It is too simple
+ * to be fast, but simple enough to trust, so --selftest checks both real
+ * parsers against it.
+ */
+static int64_t run_reference_parser(const char *filepath, size_t file_size, char delim,
+                                    bench_state_t *state) {
+    memset(state, 0, sizeof(*state));
+    FILE *f = fopen(filepath, "rb");
+    if (!f) return -1;
+
+    enum { FIELD_START, UNQUOTED, QUOTED, QUOTE_IN_QUOTED } st = FIELD_START;
+    size_t field_len = 0, row_fields = 0;
+    char buf[1 << 16];
+    size_t n;
+    uint64_t start = get_time_ns();
+
+#define REF_END_FIELD() do { row_fields++; state->fields_parsed++; field_len = 0; } while (0)
+#define REF_END_ROW() do { REF_END_FIELD(); state->rows_parsed++; row_fields = 0; } while (0)
+#define REF_ADD(ch) do { if (field_len++ == 0) state->checksum += (uint64_t)(unsigned char)(ch); } while (0)
+    while ((n = fread(buf, 1, sizeof(buf), f)) > 0) {
+        for (size_t i = 0; i < n; i++) {
+            char c = buf[i];
+            if (st == QUOTED) {
+                if (c == '"') st = QUOTE_IN_QUOTED;
+                else REF_ADD(c);
+                continue;
+            }
+            if (st == QUOTE_IN_QUOTED && c == '"') {
+                REF_ADD(c);
+                st = QUOTED;
+                continue;
+            }
+            if (c == '"' && st == FIELD_START) {
+                st = QUOTED;
+            } else if (c == delim) {
+                REF_END_FIELD();
+                st = FIELD_START;
+            } else if (c == '\n') {
+                if (st != FIELD_START || row_fields > 0) REF_END_ROW();
+                st = FIELD_START;
+            } else if (c != '\r') {
+                REF_ADD(c);
+                st = UNQUOTED;
+            }
+        }
+    }
+    if (st != FIELD_START || row_fields > 0) REF_END_ROW();
+#undef REF_ADD
+#undef REF_END_ROW
+#undef REF_END_FIELD
+
+    uint64_t end = get_time_ns();
+    bool ok = !ferror(f);
+    fclose(f);
+    state->bytes_processed = file_size;
+    return ok ? (int64_t)(end - start) : -1;
+}
+
+/* Returns the parse time in nanoseconds, or -1 on failure */
+typedef int64_t (*bench_runner_t)(const char *filepath, size_t file_size, char delim,
+                                  bench_state_t *state);
+
+/*
+ * Scan baselines - not parsers, but the floor under them. read(2) through
+ * a 64 KiB buffer is the same I/O the libcsv runner does with nothing
+ * else, so its throughput is the ceiling the harness allows; every test
+ * reports both parsers as a share of it. memchr adds the cheapest useful
+ * work (wc -l), and mmap reads every byte of a mapping with no copy.
+ */
+static int64_t run_read_baseline(const char *filepath, size_t file_size, char delim,
+                                 bench_state_t *state) {
+    (void)delim;
+    memset(state, 0, sizeof(*state));
+    char *buffer = malloc(65536);
+    if (!buffer) return -1;
+
+    uint64_t start = get_time_ns();
+    int fd = open(filepath, O_RDONLY);
+    if (fd < 0) {
+        free(buffer);
+        return -1;
+    }
+    ssize_t n;
+    while ((n = read(fd, buffer, 65536)) > 0) {
+        state->checksum += (uint64_t)(unsigned char)buffer[0];
+    }
+    close(fd);
+    uint64_t end = get_time_ns();
+
+    free(buffer);
+    state->bytes_processed = file_size;
+    return n == 0 ? (int64_t)(end - start) : -1;
+}
+
+static int64_t run_memchr_baseline(const char *filepath, size_t file_size, char delim,
+                                   bench_state_t *state) {
+    (void)delim;
+    memset(state, 0, sizeof(*state));
+    char *buffer = malloc(65536);
+    if (!buffer) return -1;
+
+    uint64_t start = get_time_ns();
+    int fd = open(filepath, O_RDONLY);
+    if (fd < 0) {
+        free(buffer);
+        return -1;
+    }
+    ssize_t n;
+    while ((n = read(fd, buffer, 65536)) > 0) {
+        const char *p = buffer, *end = buffer + n;
+        while ((p = memchr(p, '\n', (size_t)(end - p))) != NULL) {
+            state->rows_parsed++;
+            p++;
+        }
+    }
+    close(fd);
+    uint64_t end = get_time_ns();
+
+    free(buffer);
+    state->bytes_processed = file_size;
+    return n == 0 ? (int64_t)(end - start) : -1;
+}
+
+static int64_t run_mmap_baseline(const char *filepath, size_t file_size, char delim,
+                                 bench_state_t *state) {
+    (void)delim;
+    memset(state, 0, sizeof(*state));
+
+    uint64_t start = get_time_ns();
+    int fd = open(filepath, O_RDONLY);
+    if (fd < 0) return -1;
+    if (file_size > 0) {
+        const unsigned char *map = mmap(NULL, file_size, PROT_READ, MAP_PRIVATE, fd, 0);
+        if (map == MAP_FAILED) {
+            close(fd);
+            return -1;
+        }
+        uint64_t sum = 0;
+        size_t i = 0;
+        for (; i + sizeof(uint64_t) <= file_size; i += sizeof(uint64_t)) {
+            uint64_t word;
+            memcpy(&word, map + i, sizeof(word));
+            sum += word;
+        }
+        for (; i < file_size; i++) sum += map[i];
+        state->checksum += sum;
+        munmap((void *)map, file_size);
+    }
+    close(fd);
+    uint64_t end = get_time_ns();
+
+    state->bytes_processed = file_size;
+    return (int64_t)(end - start);
+}
+
+enum { SCAN_READ, SCAN_MEMCHR, SCAN_MMAP, NUM_SCAN_BASELINES };
+
+static const struct {
+    const char *name;     /* benchstat name and report column */
+    bench_runner_t run;
+} scan_baselines[NUM_SCAN_BASELINES] = {
+    [SCAN_READ] = {"read", run_read_baseline},
+    [SCAN_MEMCHR] = {"memchr", run_memchr_baseline},
+    [SCAN_MMAP] = {"mmap", run_mmap_baseline},
+};
+
+/*
+ * Parser capabilities - what each parser supports as this suite drives
+ * it, so a missing result can be told apart from a failed one. Keep in
+ * step with the runners above when either library grows a feature.
+ */
+enum {
+    CAP_CUSTOM_DELIM   = 1 << 0,  /* delimiter other than ',' */
+    CAP_QUOTES         = 1 << 1,  /* quoted fields */
+    CAP_ESCAPED_QUOTES = 1 << 2,  /* "" inside quoted fields */
+    CAP_MULTILINE      = 1 << 3,  /* newlines inside quoted fields */
+    CAP_CUSTOM_QUOTE   = 1 << 4,  /* quote character other than '"' */
+    CAP_TRIM           = 1 << 5,  /* whitespace trimming */
+    CAP_COMMENTS       = 1 << 6,  /* comment lines */
+    CAP_STREAMING      = 1 << 7,  /* input fed in chunks */
+    CAP_MMAP           = 1 << 8,  /* memory-mapped file input */
+    CAP_MULTITHREAD    = 1 << 9,  /* parses one file on several threads */
+};
+
+static const struct {
+    unsigned cap;
+    const char *label;
+} cap_labels[] = {
+    {CAP_CUSTOM_DELIM,   "custom delimiter"},
+    {CAP_QUOTES,         "quoted fields"},
+    {CAP_ESCAPED_QUOTES, "escaped quotes"},
+    {CAP_MULTILINE,      "multi-line fields"},
+    {CAP_CUSTOM_QUOTE,   "custom quote char"},
+    {CAP_TRIM,           "whitespace trim"},
+    {CAP_COMMENTS,       "comment lines"},
+    {CAP_STREAMING,      "chunked input"},
+    {CAP_MMAP,           "mmap input"},
+    {CAP_MULTITHREAD,    "multithreaded"},
+};
+
+/*
+ * The parser manifest. threads is how many the runner actually uses, for
+ * MB/s-per-core; license and url are cited in the report's attribution
+ * section, which published comparisons of third-party libraries need.
+ * Parsers run in-process, so a new one also needs a runner above and
+ * its own fields in test_result_t.
+ */
+static const struct {
+    const char *name;
+    unsigned caps;
+    int threads;
+    const char *license;
+    const char *url;
+} parser_caps[] = {
+    {"SonicSV", CAP_CUSTOM_DELIM | CAP_QUOTES | CAP_ESCAPED_QUOTES | CAP_MULTILINE |
+                CAP_CUSTOM_QUOTE | CAP_TRIM | CAP_STREAMING | CAP_MMAP, 1,
+     "MIT", "https://github.com/vitruves/SonicSV"},
+    {"libcsv",  CAP_CUSTOM_DELIM | CAP_QUOTES | CAP_ESCAPED_QUOTES | CAP_MULTILINE |
+                CAP_CUSTOM_QUOTE | CAP_TRIM | CAP_STREAMING, 1,
+     "LGPL-2.1", "https://github.com/rgamble/libcsv"},
+};
+
+#define NUM_PARSERS (sizeof(parser_caps) / sizeof(parser_caps[0]))
+
+static unsigned parser_capabilities(const char *name) {
+    for (size_t p = 0; p < NUM_PARSERS; p++) {
+        if (strcasecmp(parser_caps[p].name, name) == 0) return parser_caps[p].caps;
+    }
+    return 0;
+}
+
+/* Features a parser needs to parse this test's file correctly */
+static unsigned test_requirements(const test_config_t *config) {
+    unsigned need = 0;
+    if (config->delimiter != ',') need |= CAP_CUSTOM_DELIM;
+    if (config->has_quotes) need |= CAP_QUOTES;
+    if (config->has_quotes && config->has_newlines_in_fields) need |= CAP_MULTILINE;
+    switch (config->shape) {
+        case SHAPE_HUGE_QUOTED:
+        case SHAPE_QUOTE_DELIM: need |= CAP_QUOTES; break;
+        case SHAPE_ESCAPES:     need |= CAP_QUOTES | CAP_ESCAPED_QUOTES; break;
+        case SHAPE_NO_FINAL_EOL: need |= CAP_QUOTES; break;
+        case SHAPE_SINGLE_ROW:
+        case SHAPE_GIANT_LINE:
+        case SHAPE_TABLE:       break;
+    }
+    return need;
+}
+
+static void print_attribution(FILE *out) {
+    fprintf(out, "\nATTRIBUTION\n");
+    for (size_t p = 0; p < NUM_PARSERS; p++) {
+        fprintf(out, "%-10s %-10s %s\n", parser_caps[p].name, parser_caps[p].license,
+                parser_caps[p].url);
+    }
+}
+
+static void print_capability_matrix(FILE *out) {
+    fprintf(out, "\nPARSER CAPABILITIES\n");
+    fprintf(out, "%-23s", "Feature");
+    for (size_t p = 0; p < NUM_PARSERS; p++) fprintf(out, " %10s", parser_caps[p].name);
+    fprintf(out, "\n-----------------------");
+    for (size_t p = 0; p < NUM_PARSERS; p++) fprintf(out, " ----------");
+    fprintf(out, "\n");
+    for (size_t c = 0; c < sizeof(cap_labels) / sizeof(cap_labels[0]); c++) {
+        fprintf(out, "%-23s", cap_labels[c].label);
+        for (size_t p = 0; p < NUM_PARSERS; p++) {
+            fprintf(out, " %10s", (parser_caps[p].caps & cap_labels[c].cap) ? "yes" : "-");
+        }
+        fprintf(out, "\n");
+    }
+
+    bool all_single = true;
+    fprintf(out, "%-23s", "threads used");
+    for (size_t p = 0; p < NUM_PARSERS; p++) {
+        fprintf(out, " %10d", parser_caps[p].threads);
+        if (parser_caps[p].threads > 1) all_single = false;
+    }
+    fprintf(out, "\n");
+    if (all_single) {
+        fprintf(out, "Every parser ran on one thread, so MB/s above is also MB/s per core.\n");
+    } else {
+        fprintf(out, "Divide a parser's MB/s by its thread count for MB/s per core.\n");
+    }
+}
+
+static int compare_ns(const void *a, const void *b) {
+    int64_t x = *(const int64_t *)a, y = *(const int64_t *)b;
+    return (x > y) - (x < y);
+}
+
+/*
+ * Resource usage - deltas around every timed sample, summed per parser
+ * and test. CPU time over wall time tells a parser that is waiting on I/O
+ * (well under 100%) from one saturating its core; context switches and
+ * page faults show when a slow result came from the scheduler or from
+ * paging rather than from the parser itself.
+ *
+ * usage_snapshot_*() are the only platform-specific part: getrusage() covers
+ * CPU time, switches and faults everywhere, and resident memory comes
+ * from /proc/self/statm on Linux, task_info() on macOS, or is reported as
+ * unknown elsewhere. Open descriptors (/proc/self/fd, /dev/fd on macOS)
+ * and mapped regions (/proc/self/maps, Linux only) are counted the same
+ * way: a count that keeps climbing across samples is a parser leaking
+ * them, which a long-running service embedding it runs out of. Where
+ * Linux exposes RAPL (powercap intel-rapl:0, also used for AMD) and it
+ * is readable, package energy is summed too, for MB per joule.
+ */
+typedef struct {
+    uint64_t wall_ns;
+    uint64_t cpu_ns;  /* user + system */
+    long vol_switches;
+    long invol_switches;
+    long major_faults;
+    long minor_faults;
+    size_t peak_rss;  /* largest resident set seen after a sample; 0 = unknown */
+    int samples;
+    int peak_fds;     /* most descriptors / mappings open after a sample; -1 = unknown */
+    int peak_maps;
+    int fd_growth;    /* summed across samples: what they left open */
+    int map_growth;
+    double energy_j;  /* package energy over the samples */
+    bool energy_unknown;  /* set once any sample lacked a reading */
+} usage_totals_t;
+
+typedef struct {
+    uint64_t wall_ns;
+    uint64_t cpu_ns;
+    struct rusage ru;
+    size_t rss;       /* bytes, 0 if the platform doesn't tell */
+    int fds;          /* -1 if the platform doesn't tell */
+    int maps;
+    int64_t energy_uj;  /* RAPL package counter, -1 if unavailable */
+} usage_snapshot_t;
+
+static size_t current_rss_bytes(void) {
+#if defined(__linux__)
+    long pages_total, pages_resident;
+    FILE *f = fopen("/proc/self/statm", "r");
+    if (!f) return 0;
+    int n = fscanf(f, "%ld %ld", &pages_total, &pages_resident);
+    fclose(f);
+    return n == 2 ? (size_t)pages_resident * (size_t)sysconf(_SC_PAGESIZE) : 0;
+#elif defined(__APPLE__)
+    mach_task_basic_info_data_t info;
+    mach_msg_type_number_t count = MACH_TASK_BASIC_INFO_COUNT;
+    if (task_info(mach_task_self(), MACH_TASK_BASIC_INFO, (task_info_t)&info, &count) != KERN_SUCCESS) {
+        return 0;
+    }
+    return (size_t)info.resident_size;
+#else
+    return 0;
+#endif
+}
+
+static int count_open_fds(void) {
+#if defined(__linux__) || defined(__APPLE__)
+#ifdef __linux__
+    DIR *d = opendir("/proc/self/fd");
+#else
+    DIR *d = opendir("/dev/fd");
+#endif
+    if (!d) return -1;
+    int n = 0;
+    struct dirent *e;
+    while ((e = readdir(d)) != NULL) n += e->d_name[0] != '.';
+    closedir(d);
+    return n - 1;  /* the directory stream's own descriptor */
+#else
+    return -1;
+#endif
+}
+
+static int count_mappings(void) {
+#ifdef __linux__
+    FILE *f = fopen("/proc/self/maps", "r");
+    if (!f) return -1;
+    int n = 0, c;
+    while ((c = getc(f)) != EOF) n += c == '\n';
+    fclose(f);
+    return n;
+#else
+    return -1;
+#endif
+}
+
+#define RAPL_DIR "/sys/class/powercap/intel-rapl:0"
+
+static int64_t read_sysfs_int64(const char *path) {
+    FILE *f = fopen(path, "r");
+    if (!f) return -1;
+    long long v;
+    int n = fscanf(f, "%lld", &v);
+    fclose(f);
+    return n == 1 ? (int64_t)v : -1;
+}
+
+/* Recent kernels make energy_uj root-only; then every reading is -1 */
+static int64_t rapl_energy_uj(void) {
+#ifdef __linux__
+    return read_sysfs_int64(RAPL_DIR "/energy_uj");
+#else
+    return -1;
+#endif
+}
+
+static void usage_read_clocks(usage_snapshot_t *snap) {
+    struct timespec ts;
+    getrusage(RUSAGE_SELF, &snap->ru);
+    /* Nanosecond process CPU time where available, else rusage's microseconds */
+    if (clock_gettime(CLOCK_PROCESS_CPUTIME_ID, &ts) == 0) {
+        snap->cpu_ns = (uint64_t)ts.tv_sec * 1000000000ULL + ts.tv_nsec;
+    } else {
+        snap->cpu_ns = ((uint64_t)snap->ru.ru_utime.tv_sec + snap->ru.ru_stime.tv_sec) * 1000000000ULL +
+                       ((uint64_t)snap->ru.ru_utime.tv_usec + snap->ru.ru_stime.tv_usec) * 1000ULL;
+    }
+}
+
+/*
+ * Reading statm, walking the fd directory and parsing the whole maps file
+ * costs far more than a small parse, so it stays outside the window: the
+ * start snapshot reads those counters first and the clocks last, the end
+ * snapshot the clocks first. Energy sits next to the clocks for the same
+ * reason.
+ */
+static void usage_snapshot_start(usage_snapshot_t *snap) {
+    snap->rss = current_rss_bytes();
+    snap->fds = count_open_fds();
+    snap->maps = count_mappings();
+    snap->energy_uj = rapl_energy_uj();
+    usage_read_clocks(snap);
+    snap->wall_ns = get_time_ns();
+}
+
+static void usage_snapshot_end(usage_snapshot_t *snap) {
+    snap->wall_ns = get_time_ns();
+    usage_read_clocks(snap);
+    snap->energy_uj = rapl_energy_uj();
+    snap->rss = current_rss_bytes();
+    snap->fds = count_open_fds();
+    snap->maps = count_mappings();
+}
+
+/* Package energy between two snapshots in joules, -1 if either lacks a reading */
+static double usage_energy_j(const usage_snapshot_t *before, const usage_snapshot_t *after) {
+    if (before->energy_uj < 0 || after->energy_uj < 0) return -1;
+    int64_t delta = after->energy_uj - before->energy_uj;
+    if (delta < 0) {  /* the counter wrapped */
+        static int64_t range = 0;
+        if (range == 0) range = read_sysfs_int64(RAPL_DIR "/max_energy_range_uj");
+        delta += range > 0 ? range : 0;
+    }
+    return delta / 1e6;
+}
+
+static void usage_add(usage_totals_t *u, const usage_snapshot_t *before, const usage_snapshot_t *after) {
+    u->wall_ns += after->wall_ns - before->wall_ns;
+    u->cpu_ns += after->cpu_ns - before->cpu_ns;
+    u->vol_switches += after->ru.ru_nvcsw - before->ru.ru_nvcsw;
+    u->invol_switches += after->ru.ru_nivcsw - before->ru.ru_nivcsw;
+    u->major_faults += after->ru.ru_majflt - before->ru.ru_majflt;
+    u->minor_faults += after->ru.ru_minflt - before->ru.ru_minflt;
+    if (after->rss > u->peak_rss) u->peak_rss = after->rss;
+
+    if (u->samples++ == 0) {
+        u->peak_fds = u->peak_maps = -1;
+        u->fd_growth = u->map_growth = 0;
+    }
+    if (before->fds >= 0 && after->fds >= 0) {
+        if (after->fds > u->peak_fds) u->peak_fds = after->fds;
+        u->fd_growth += after->fds - before->fds;
+    }
+    if (before->maps >= 0 && after->maps >= 0) {
+        if (after->maps > u->peak_maps) u->peak_maps = after->maps;
+        u->map_growth += after->maps - before->maps;
+    }
+
+    double energy_j = usage_energy_j(before, after);
+    if (energy_j < 0) u->energy_unknown = true;
+    else u->energy_j += energy_j;
+}
+
+/*
+ * RSS trend - the resident-set change each sample leaves behind, summed
+ * over repeated parses of one input (one parser on one test file, or a
+ * soak's fixed file set). The least-squares slope of that running total
+ * against parses is the memory kept per parse. Different inputs leave
+ * different amounts resident, so a series never spans two of them. The
+ * first sample pays for one-time setup; after it a healthy parser is at
+ * steady state, so RSS rising after every later sample is monotonic
+ * growth, a probable leak. Leaks under a page per sample don't move RSS
+ * reliably; ASan builds catch those. Deltas rather than absolute readings
+ * keep the other parser's and the generator's memory out of it.
+ */
+typedef struct {
+    size_t samples;
+    size_t rises;        /* samples after the first that left RSS higher */
+    double parses;       /* x: parses so far */
+    double level;        /* y: summed RSS deltas, bytes */
+    double first_level;  /* level after the first sample */
+    double sum_x, sum_y, sum_xy, sum_xx;
+} rss_trend_t;
+
+static void rss_trend_add(rss_trend_t *t, size_t parses, size_t rss_before, size_t rss_after) {
+    if (rss_before == 0 || rss_after == 0) return;  /* platform doesn't report RSS */
+    double delta = (double)rss_after - (double)rss_before;
+    t->parses += (double)parses;
+    t->level += delta;
+    if (t->samples++ == 0) t->first_level = t->level;
+    else if (delta > 0) t->rises++;
+    t->sum_x += t->parses;
+    t->sum_y += t->level;
+    t->sum_xy += t->parses * t->level;
+    t->sum_xx += t->parses * t->parses;
+}
+
+/* Bytes kept per parse; 0 with fewer than three samples */
+static double rss_trend_slope(const rss_trend_t *t) {
+    if (t->samples < 3) return 0;
+    double n = (double)t->samples;
+    double denom = n * t->sum_xx - t->sum_x * t->sum_x;
+    return denom > 0 ? (n * t->sum_xy - t->sum_x * t->sum_y) / denom : 0;
+}
+
+static bool rss_trend_leaking(const rss_trend_t *t) {
+    return t->samples >= 3 && t->rises == t->samples - 1;
+}
+
+/* "+12.3 KiB/1k parses (monotonic, probable leak)" or "n/a" */
+static void format_rss_trend(char *buf, size_t size, const rss_trend_t *t) {
+    if (t->samples < 3) {
+        snprintf(buf, size, "n/a");
+        return;
+    }
+    snprintf(buf, size, "%+.1f KiB/1k parses, %+.1f MiB net%s", rss_trend_slope(t) * 1000 / 1024,
+             (t->level - t->first_level) / (1024.0 * 1024.0),
+             rss_trend_leaking(t) ? " (rose every sample, probable leak)" : "");
+}
+
+/*
+ * MB (10^6 bytes, as in benchstat) per joule: bytes parsed in `seconds`
+ * over the average package watts during the samples; 0 without energy data
+ */
+static double usage_mb_per_joule(const usage_totals_t *u, size_t bytes, double seconds) {
+    if (u->samples == 0 || u->energy_unknown || u->energy_j <= 0 || u->wall_ns == 0) return 0;
+    if (seconds <= 0) return 0;
+    double watts = u->energy_j / (u->wall_ns / 1e9);
+    return bytes / 1e6 / seconds / watts;
+}
+
+static double usage_cpu_percent(const usage_totals_t *u) {
+    return u->wall_ns > 0 ? 100.0 * (double)u->cpu_ns / (double)u->wall_ns : 0;
+}
+
+/*
+ * One timed sample: the mean of `repeat` back-to-back parses. Sub-millisecond
+ * parses of small files sit close to timer resolution and scheduler noise;
+ * repeating them inside a sample averages that out. Returns -1 on failure.
+ */
+static int64_t run_sample(bench_runner_t run, const char *filepath, size_t file_size, char delim,
+                          int repeat, bench_state_t *state) {
+    int64_t total = 0;
+    uint64_t read_total = 0;
+    for (int r = 0; r < repeat; r++) {
+        int64_t elapsed = run(filepath, file_size, delim, state);
+        if (elapsed < 0) return -1;
+        total += elapsed;
+        read_total += state->read_ns;
+    }
+    state->read_ns = read_total / (uint64_t)repeat;
+    return total / repeat;
+}
+
+/*
+ * Fixed per-parse cost - the median time to parse an empty file. This is
+ * parser setup and I/O bookkeeping rather than parsing, and it dominates
+ * the smallest tests; --subtract-overhead removes it from every timing.
+ */
+static int64_t measure_fixed_overhead(bench_runner_t run, const char *empty_path) {
+    int64_t samples[OVERHEAD_SAMPLES];
+    size_t n = 0;
+    bench_state_t state;
+
+    for (int i = 0; i < OVERHEAD_SAMPLES; i++) {
+        int64_t elapsed = run(empty_path, 0, ',', &state);
+        if (elapsed >= 0) samples[n++] = elapsed;
+    }
+    if (n == 0) return 0;
+
+    qsort(samples, n, sizeof(samples[0]), compare_ns);
+    return samples[n / 2];
+}
+
+/*
+ * Work directory - generated files go to TEMP_DIR, or with --workdir to
+ * a WORK_DIR_NAME directory inside the given one (another disk, a tmpfs).
+ * Network filesystems are refused, since their latency would be measured
+ * instead of the parsers, and free space is checked against the largest
+ * file the run will write.
+ */
+static char g_temp_dir[192] = TEMP_DIR;
+static char g_work_fs[32] = "unknown";
+
+/* Sets g_work_fs; returns true for filesystems reached over the network */
+static bool detect_work_fs(const char *dir) {
+#if defined(__linux__)
+    static const struct { long magic; const char *name; bool remote; } kinds[] = {
+        {0x01021994, "tmpfs", false},      {0xEF53, "ext4", false},
+        {0x58465342, "xfs", false},        {(long)0x9123683E, "btrfs", false},
+        {0x6969, "nfs", true},             {(long)0xFF534D42, "cifs", true},
+        {(long)0xFE534D42, "smb2", true},  {0x65735546, "fuse", true},
+    };
+    struct statfs fs;
+    if (statfs(dir, &fs) != 0) return false;
+    for (size_t i = 0; i < sizeof(kinds) / sizeof(kinds[0]); i++) {
+        if ((long)fs.f_type == kinds[i].magic) {
+            snprintf(g_work_fs, sizeof(g_work_fs), "%s", kinds[i].name);
+            return kinds[i].remote;
+        }
+    }
+    snprintf(g_work_fs, sizeof(g_work_fs), "0x%lx", (unsigned long)fs.f_type);
+    return false;
+#elif defined(__APPLE__)
+    struct statfs fs;
+    if (statfs(dir, &fs) != 0) return false;
+    snprintf(g_work_fs, sizeof(g_work_fs), "%s", fs.f_fstypename);
+    return strcmp(fs.f_fstypename, "nfs") == 0 || strcmp(fs.f_fstypename, "smbfs") == 0 ||
+           strcmp(fs.f_fstypename, "afpfs") == 0 || strcmp(fs.f_fstypename, "webdav") == 0;
+#else
+    (void)dir;
+    return false;
+#endif
+}
+
+static bool setup_work_dir(const char *workdir, double need_bytes) {
+    if (workdir) {
+        char resolved[PATH_MAX];
+        if (!realpath(workdir, resolved)) {
+            fprintf(stderr, "Error: --workdir %s: %s\n", workdir, strerror(errno));
+            return false;
+        }
+        if (strlen(resolved) + sizeof(WORK_DIR_NAME) + 1 > sizeof(g_temp_dir)) {
+            fprintf(stderr, "Error: --workdir path is too long\n");
+            return false;
+        }
+        snprintf(g_temp_dir, sizeof(g_temp_dir), "%s/%s", resolved, WORK_DIR_NAME);
+    }
+    /* The parent always exists; g_temp_dir itself is created per run */
+    char parent[sizeof(g_temp_dir)];
+    snprintf(parent, sizeof(parent), "%s", g_temp_dir);
+    char *slash = strrchr(parent, '/');
+    if (slash == parent) slash[1] = '\0';
+    else if (slash) *slash = '\0';
+
+    if (detect_work_fs(parent)) {
+        fprintf(stderr, "Error: %s is on a network filesystem (%s); pick a local --workdir\n",
+                parent, g_work_fs);
+        return false;
+    }
+    struct statvfs vfs;
+    if (statvfs(parent, &vfs) == 0) {
+        double free_bytes = (double)vfs.f_bavail * (double)vfs.f_frsize;
+        if (free_bytes < need_bytes) {
+            fprintf(stderr, "Error: %s has %.1f MiB free, the run needs about %.1f MiB; "
+                            "use --workdir or a smaller --size\n",
+                    parent, free_bytes / (1024.0 * 1024.0), need_bytes / (1024.0 * 1024.0));
+            return false;
+        }
+    }
+    return true;
+}
+
+/*
+ * Cache prefetch - with --prefetch the input is read through once right
+ * before the timed samples, so every parser starts from a warm page cache
+ * whether or not generation or warmup happened to leave it there.
+ */
+static bool prefetch_file(const char *path) {
+    int fd = open(path, O_RDONLY);
+    if (fd < 0) return false;
+#ifdef POSIX_FADV_WILLNEED
+    posix_fadvise(fd, 0, 0, POSIX_FADV_WILLNEED);
+#endif
+    char buf[1 << 16];
+    ssize_t n;
+    while ((n = read(fd, buf, sizeof(buf))) > 0) {
+    }
+    close(fd);
+    return n == 0;
+}
+
+static bool copy_file(const char *from, const char *to) {
+    FILE *in = fopen(from, "rb");
+    if (!in) return false;
+    FILE *out = fopen(to, "wb");
+    if (!out) {
+        fclose(in);
+        return false;
+    }
+    char buf[1 << 16];
+    size_t n;
+    bool ok = true;
+    while (ok && (n = fread(buf, 1, sizeof(buf), in)) > 0) {
+        ok = fwrite(buf, 1, n, out) == n;
+    }
+    fclose(in);
+    return fclose(out) == 0 && ok;
+}
+
+/*
+ * Drop-behind - evicts a finished test's file from the page cache, so a
+ * 1 GB input doesn't crowd out the next test's data. Pages still waiting
+ * for writeback can't be dropped, hence the sync first. Unlinking frees
+ * the pages as well, but only once nothing holds the file open, and kept
+ * files (--keep-files) would otherwise stay cached.
+ */
+static void drop_file_cache(const char *path) {
+#ifdef POSIX_FADV_DONTNEED
+    int fd = open(path, O_RDONLY);
+    if (fd < 0) return;
+    fdatasync(fd);
+    posix_fadvise(fd, 0, 0, POSIX_FADV_DONTNEED);
+    close(fd);
+#else
+    (void)path;
+#endif
+}
+
+/*
+ * Per-parser sandbox - with --sandbox each parser runs from its own empty
+ * working directory holding only a symlink to the input, so scratch files
+ * or crash debris from one parser can't reach the other parser or the
+ * next test. Anything left behind is reported and removed on exit.
+ */
+typedef struct {
+    char dir[320];
+    int saved_cwd;
+} sandbox_t;
+
+/* Removes dir and everything below it; returns the number of entries removed */
+static size_t remove_tree(const char *dir) {
+    size_t removed = 0;
+    DIR *d = opendir(dir);
+    if (d) {
+        struct dirent *entry;
+        while ((entry = readdir(d)) != NULL) {
+            if (strcmp(entry->d_name, ".") == 0 || strcmp(entry->d_name, "..") == 0) continue;
+            char path[640];
+            snprintf(path, sizeof(path), "%s/%s", dir, entry->d_name);
+            struct stat st;
+            if (lstat(path, &st) == 0 && S_ISDIR(st.st_mode)) {
+                removed += remove_tree(path);
+            } else {
+                unlink(path);
+                removed++;
+            }
+        }
+        closedir(d);
+    }
+    rmdir(dir);
+    return removed;
+}
+
+/* Returns the path the parser should open, or NULL if the sandbox couldn't be set up */
+static const char *sandbox_enter(sandbox_t *sb, const char *test_name, const char *parser,
+                                 const char *filepath) {
+    snprintf(sb->dir, sizeof(sb->dir), "%s/%s.%s", g_temp_dir, test_name, parser);
+    remove_tree(sb->dir);
+    if (mkdir(sb->dir, 0700) != 0) {
+        fprintf(stderr, "Warning: cannot create sandbox %s: %s\n", sb->dir, strerror(errno));
+        return NULL;
+    }
+
+    char link_path[352];
+    snprintf(link_path, sizeof(link_path), "%s/input.csv", sb->dir);
+    sb->saved_cwd = open(".", O_RDONLY);
+    if (sb->saved_cwd < 0 || symlink(filepath, link_path) != 0 || chdir(sb->dir) != 0) {
+        fprintf(stderr, "Warning: cannot enter sandbox %s: %s\n", sb->dir, strerror(errno));
+        if (sb->saved_cwd >= 0) close(sb->saved_cwd);
+        remove_tree(sb->dir);
+        return NULL;
+    }
+    return "input.csv";
+}
+
+static void sandbox_leave(sandbox_t *sb) {
+    if (fchdir(sb->saved_cwd) != 0) {
+        fprintf(stderr, "Warning: cannot leave sandbox %s: %s\n", sb->dir, strerror(errno));
+    }
+    close(sb->saved_cwd);
+
+    size_t removed = remove_tree(sb->dir);
+    if (removed > 1) {  /* the input symlink itself is expected */
+        fprintf(stderr, "Warning: %s left %zu stray files behind\n", sb->dir, removed - 1);
+    }
+}
+
+/*
+ * Result storage
+ */
+typedef struct {
+    const char *test_name;
+    size_t file_size;
+    size_t expected_rows;
+    size_t expected_fields;
+
+    timing_stats_t sonicsv_times;
+    timing_stats_t libcsv_times;
+    timing_stats_t scan_times[NUM_SCAN_BASELINES];
+
+    /* Read-call share of each timing; empty where the runner can't split it out */
+    timing_stats_t sonicsv_read_times;
+    timing_stats_t libcsv_read_times;
+
+    double sonicsv_throughput;
+    double libcsv_throughput;
+    double speedup;
+
+    /* Validation data - row/field counts are more reliable than checksums */
+    uint64_t sonicsv_rows;
+    uint64_t sonicsv_fields;
+    uint64_t libcsv_rows;
+    uint64_t libcsv_fields;
+
+    /* Set when any run returned an error rather than a timing */
+    bool sonicsv_failed;
+    bool libcsv_failed;
+
+    /* Set when the parser/test pair was quarantined and not run */
+    bool sonicsv_skipped;
+    bool libcsv_skipped;
+
+    /* Set when the test needs a feature the parser lacks (see parser_caps) */
+    bool sonicsv_unsupported;
+    bool libcsv_unsupported;
+
+    char sha256[65];  /* dataset digest with --hash */
+    char kept_name[64];  /* file name under --keep-files; empty if it couldn't be kept */
+
+    usage_totals_t sonicsv_usage;
+    usage_totals_t libcsv_usage;
+
+    /* RSS change over this test's samples, for the leak check */
+    rss_trend_t sonicsv_rss_trend;
+    rss_trend_t libcsv_rss_trend;
+
+    /* Set when the scenario declares its counts and they were checked, and
+     * when the generator's own counts disagreed with the declaration */
+    bool declared_checked;
+    bool generator_drift;
+
+    /* Bytes per parse still allocated after it returns (ASan builds only) */
+    uint64_t sonicsv_leaked;
+    uint64_t libcsv_leaked;
+
+    /* Peak resident set of one parse in its own process (see parse_peak_rss) */
+    size_t sonicsv_peak_rss;
+    size_t libcsv_peak_rss;
+} test_result_t;
+
+/*
+ * Binary integrity - the running executable (SonicSV is compiled into it)
+ * is hashed once before the suite and again before every test, so a
+ * concurrent rebuild mid-suite stops the run instead of silently mixing
+ * results from two builds. The hash goes into the report and the
+ * benchstat header as a record of exactly what was measured.
+ */
+static bool self_exe_path(char *out, size_t size) {
+#if defined(__linux__)
+    ssize_t n = readlink("/proc/self/exe", out, size - 1);
+    if (n <= 0) return false;
+    out[n] = '\0';
+    return true;
+#elif defined(__APPLE__)
+    uint32_t len = (uint32_t)size;
+    return _NSGetExecutablePath(out, &len) == 0;
+#else
+    (void)out; (void)size;
+    return false;
+#endif
+}
+
+static bool hash_file(const char *path, char hex[65]) {
+    FILE *f = fopen(path, "rb");
+    if (!f) return false;
+    sha256_t h;
+    sha256_init(&h);
+    char buf[1 << 16];
+    size_t n;
+    while ((n = fread(buf, 1, sizeof(buf), f)) > 0) {
+        sha256_update(&h, buf, n);
+    }
+    bool ok = !ferror(f);
+    fclose(f);
+    if (ok) sha256_final(&h, hex);
+    return ok;
+}
+
+static struct {
+    char path[PATH_MAX];
+    char sha256[65];
+} g_binary;
+
+/* Returns false only when the binary was hashed before and has changed */
+static bool verify_binary(void) {
+    char now[65];
+    if (g_binary.sha256[0] == '\0' || !hash_file(g_binary.path, now)) return true;
+    return strcmp(now, g_binary.sha256) == 0;
+}
+
+/*
+ * Machine fingerprint - the properties that make two runs comparable.
+ * Written into the benchstat header as key: value lines and checked
+ * against the baseline before --compare reports any deltas.
+ */
+typedef struct {
+    char cpu[128];
+    char kernel[256];
+    char memory[32];
+    char governor[32];
+    char turbo[8];
+    char cores[48];    /* "4 physical, 8 logical" */
+    char simd[48];     /* "sse4.2 avx2 avx512", as SonicSV detects it */
+} machine_info_t;
+
+static void trim_newline(char *s) {
+    size_t len = strlen(s);
+    while (len > 0 && (s[len - 1] == '\n' || s[len - 1] == '\r' || s[len - 1] == ' ')) {
+        s[--len] = '\0';
+    }
+}
+
+static bool read_first_line(const char *path, char *out, size_t out_size) {
+    FILE *f = fopen(path, "r");
+    if (!f) return false;
+    bool ok = fgets(out, (int)out_size, f) != NULL;
+    fclose(f);
+    if (ok) trim_newline(out);
+    return ok;
+}
+
+/*
+ * Work directory storage - where the test files live explains more run
+ * to run variance than most code changes (NVMe ext4 against network
+ * CIFS), so the mount options, the block device model and its I/O
+ * scheduler go into the report and the benchstat header beside the
+ * filesystem type. Linux only; tmpfs and overlay mounts have no device.
+ */
+static char g_work_mount[128] = "unknown";   /* per-mount options from mountinfo */
+static char g_work_device[96] = "unknown";   /* block device model */
+static char g_work_sched[32] = "unknown";    /* active I/O scheduler */
+
+static void detect_work_storage(const char *dir) {
+#if defined(__linux__)
+    struct stat st;
+    if (stat(dir, &st) != 0) return;
+    char devno[32];
+    snprintf(devno, sizeof(devno), "%u:%u", major(st.st_dev), minor(st.st_dev));
+
+    /* The last mount of this device wins, as a later mount shadows earlier ones */
+    FILE *f = fopen("/proc/self/mountinfo", "r");
+    if (f) {
+        char line[1024], id[32], options[128];
+        while (fgets(line, sizeof(line), f)) {
+            if (sscanf(line, "%*s %*s %31s %*s %*s %127s", id, options) == 2 && strcmp(id, devno) == 0) {
+                snprintf(g_work_mount, sizeof(g_work_mount), "%s", options);
+            }
+        }
+        fclose(f);
+    }
+
+    char path[PATH_MAX + 32], disk[PATH_MAX];
+    snprintf(path, sizeof(path), "/sys/dev/block/%s", devno);
+    if (major(st.st_dev) == 0 || !realpath(path, disk)) {
+        snprintf(g_work_device, sizeof(g_work_device), "none");
+        snprintf(g_work_sched, sizeof(g_work_sched), "n/a");
+        return;
+    }
+    /* A partition's sysfs directory sits inside its disk's */
+    snprintf(path, sizeof(path), "%s/partition", disk);
+    if (access(path, F_OK) == 0) {
+        char *slash = strrchr(disk, '/');
+        if (slash) *slash = '\0';
+    }
+    char value[64];
+    snprintf(path, sizeof(path), "%s/device/model", disk);
+    const char *name = strrchr(disk, '/') ? strrchr(disk, '/') + 1 : disk;
+    if (read_first_line(path, value, sizeof(value)) && value[0]) {
+        snprintf(g_work_device, sizeof(g_work_device), "%s (%.24s)", value, name);
+    } else {
+        snprintf(g_work_device, sizeof(g_work_device), "%.24s", name);  /* dm-0, md0, loop0 */
+    }
+    /* "mq-deadline kyber [bfq] none" - the bracketed one is active */
+    snprintf(path, sizeof(path), "%s/queue/scheduler", disk);
+    if (read_first_line(path, value, sizeof(value))) {
+        char *open = strchr(value, '['), *close = open ? strchr(open, ']') : NULL;
+        if (open && close) {
+            *close = '\0';
+            snprintf(g_work_sched, sizeof(g_work_sched), "%.31s", open + 1);
+        } else {
+            snprintf(g_work_sched, sizeof(g_work_sched), "%.31s", value);
+        }
+    }
+#else
+    (void)dir;
+#endif
+}
+
+/*
+ * SMT topology - a logical CPU is the primary thread of its core when it
+ * is the first entry in its thread_siblings_list. Returns false when the
+ * topology can't be read (non-Linux, or sysfs unavailable).
+ */
+#define CPU_TOPOLOGY_MAX_CPUS 1024
+
+static bool is_primary_thread(int cpu, bool *primary) {
+    char path[96], list[64];
+    snprintf(path, sizeof(path), "/sys/devices/system/cpu/cpu%d/topology/thread_siblings_list", cpu);
+    if (!read_first_line(path, list, sizeof(list))) return false;
+    *primary = atoi(list) == cpu;
+    return true;
+}
+
+static bool count_cores(int *physical, int *logical) {
+#ifdef __APPLE__
+    size_t len = sizeof(*physical);
+    if (sysctlbyname("hw.physicalcpu", physical, &len, NULL, 0) != 0) return false;
+    len = sizeof(*logical);
+    return sysctlbyname("hw.logicalcpu", logical, &len, NULL, 0) == 0;
+#else
+    long num_cpus = sysconf(_SC_NPROCESSORS_CONF);
+    if (num_cpus > CPU_TOPOLOGY_MAX_CPUS) num_cpus = CPU_TOPOLOGY_MAX_CPUS;
+    *physical = *logical = 0;
+    for (int cpu = 0; cpu < num_cpus; cpu++) {
+        bool primary;
+        if (!is_primary_thread(cpu, &primary)) continue;
+        (*logical)++;
+        if (primary) (*physical)++;
+    }
+    return *logical > 0;
+#endif
+}
+
+/*
+ * SIMD capabilities - what SonicSV's runtime dispatch detects on this
+ * CPU. The x86 fast path is AVX2 and the ARM one NEON; without them the
+ * results measure fallback code, which warn_missing_simd() points out.
+ */
+static uint32_t g_simd_detected;   /* set once --isa has overridden the dispatch */
+static const char *g_simd_pinned;  /* --isa level, NULL = SonicSV's own choice */
+
+static uint32_t simd_features(void) {
+    if (g_simd_detected) return g_simd_detected;
+    return csv_get_simd_features() & (CSV_SIMD_SSE4_2 | CSV_SIMD_AVX2 | CSV_SIMD_AVX512 |
+                                      CSV_SIMD_NEON | CSV_SIMD_SVE);
+}
+
+/*
+ * --isa pins SonicSV's runtime dispatch to one level by masking the
+ * feature word it caches (the implementation is compiled into this
+ * file), so e.g. the AVX-512 and AVX2 paths can be compared on the same
+ * machine and binary. Must run before the first parser is created.
+ */
+typedef struct {
+    const char *name;
+    uint32_t mask;   /* features left visible to SonicSV */
+    uint32_t needs;  /* features the CPU must have */
+} simd_level_t;
+
+static const simd_level_t simd_levels[] = {
+    {"avx512", CSV_SIMD_SSE4_2 | CSV_SIMD_AVX2 | CSV_SIMD_AVX512, CSV_SIMD_AVX512},
+    {"avx2",   CSV_SIMD_SSE4_2 | CSV_SIMD_AVX2, CSV_SIMD_AVX2},
+    {"sse4.2", CSV_SIMD_SSE4_2, CSV_SIMD_SSE4_2},
+    {"neon",   CSV_SIMD_NEON, CSV_SIMD_NEON},
+    {"scalar", 0, 0},
 };
-
-#define NUM_TESTS (sizeof(test_configs) / sizeof(test_configs[0]))
-
-/*
- * Timing utilities
- */
-typedef struct {
-    double min;
-    double max;
-    double sum;
-    double sum_sq;
-    size_t count;
-} timing_stats_t;
-
-static inline uint64_t get_time_ns(void) {
-    struct timespec ts;
-    clock_gettime(CLOCK_MONOTONIC, &ts);
-    return (uint64_t)ts.tv_sec * 1000000000ULL + ts.tv_nsec;
-}
-
-static void stats_init(timing_stats_t *s) {
-    s->min = 1e30;
-    s->max = 0;
-    s->sum = 0;
-    s->sum_sq = 0;
-    s->count = 0;
-}
-
-static void stats_add(timing_stats_t *s, double value) {
-    if (value < s->min) s->min = value;
-    if (value > s->max) s->max = value;
-    s->sum += value;
-    s->sum_sq += value * value;
-    s->count++;
-}
-
-static double stats_mean(const timing_stats_t *s) {
-    return s->count > 0 ? s->sum / s->count : 0;
-}
-
-static double stats_stddev(const timing_stats_t *s) {
-    if (s->count < 2) return 0;
-    double mean = stats_mean(s);
-    double variance = (s->sum_sq / s->count) - (mean * mean);
-    return variance > 0 ? sqrt(variance) : 0;
-}
-
-/*
- * Data generation
- */
-static uint32_t g_rng_state = 12345;
-
-static uint32_t rng_next(void) {
-    g_rng_state = g_rng_state * 1103515245 + 12345;
-    return (g_rng_state >> 16) & 0x7FFF;
-}
-
-static void rng_seed(uint32_t seed) {
-    g_rng_state = seed;
-}
-
-static void generate_field(char *buf, size_t max_len, size_t target_len,
-                           bool allow_comma, bool allow_newline) {
-    static const char charset[] = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 ";
-    size_t len = target_len + (rng_next() % (target_len / 2 + 1)) - target_len / 4;
-    if (len < 1) len = 1;
-    if (len >= max_len) len = max_len - 1;
-
-    for (size_t i = 0; i < len; i++) {
-        int r = rng_next() % 100;
-        if (allow_comma && r < 3) {
-            buf[i] = ',';
-        } else if (allow_newline && r < 5) {
-            buf[i] = '\n';
-        } else {
-            buf[i] = charset[rng_next() % (sizeof(charset) - 1)];
-        }
-    }
-    buf[len] = '\0';
-}
-
-static size_t generate_test_file(const test_config_t *config, const char *filepath) {
-    FILE *f = fopen(filepath, "wb");
-    if (!f) {
-        fprintf(stderr, "Error: Cannot create file %s: %s\n", filepath, strerror(errno));
-        return 0;
-    }
-
-    rng_seed(42);  /* Deterministic for reproducibility */
-
-    char field_buf[MAX_FIELD_SIZE];
-    size_t total_bytes = 0;
-
-    /* Generate header row */
-    for (size_t col = 0; col < config->fields_per_row; col++) {
-        if (col > 0) {
-            fputc(',', f);
-            total_bytes++;
-        }
-        int written = fprintf(f, "col%zu", col);
-        total_bytes += written;
-    }
-    fputc('\n', f);
-    total_bytes++;
-
-    /* Generate data rows */
-    for (size_t row = 0; row < config->rows; row++) {
-        for (size_t col = 0; col < config->fields_per_row; col++) {
-            if (col > 0) {
-                fputc(',', f);
-                total_bytes++;
-            }
-
-            generate_field(field_buf, MAX_FIELD_SIZE, config->avg_field_size,
-                          config->has_commas_in_fields, config->has_newlines_in_fields);
-
-            bool needs_quotes = config->has_quotes &&
-                               (strchr(field_buf, ',') || strchr(field_buf, '\n') ||
-                                strchr(field_buf, '"'));
-
-            if (needs_quotes) {
-                fputc('"', f);
-                total_bytes++;
-                for (char *p = field_buf; *p; p++) {
-                    if (*p == '"') {
-                        fputc('"', f);
-                        fputc('"', f);
-                        total_bytes += 2;
-                    } else {
-                        fputc(*p, f);
-                        total_bytes++;
-                    }
-                }
-                fputc('"', f);
-                total_bytes++;
-            } else {
-                size_t len = strlen(field_buf);
-                fwrite(field_buf, 1, len, f);
-                total_bytes += len;
-            }
-        }
-        fputc('\n', f);
-        total_bytes++;
-    }
-
-    fclose(f);
-    return total_bytes;
-}
-
-/*
- * Benchmark state - identical for both parsers
- */
-typedef struct {
-    uint64_t rows_parsed;
-    uint64_t fields_parsed;
-    uint64_t bytes_processed;
-    volatile uint64_t checksum;  /* Prevent optimizer from removing work */
-} bench_state_t;
-
-/*
- * SonicSV callback
- */
-static void sonicsv_row_callback(const csv_row_t *row, void *user_data) {
-    bench_state_t *state = (bench_state_t *)user_data;
-    state->rows_parsed++;
-    state->fields_parsed += row->num_fields;
-
-    /* Compute checksum to ensure we actually process data */
-    for (size_t i = 0; i < row->num_fields; i++) {
-        const csv_field_t *field = csv_get_field(row, i);
-        if (field && field->data && field->size > 0) {
-            state->checksum += (uint64_t)field->data[0];
-        }
-    }
-}
-
-/*
- * libcsv callbacks
- */
-static void libcsv_field_callback(void *data, size_t len, void *user_data) {
-    bench_state_t *state = (bench_state_t *)user_data;
-    state->fields_parsed++;
-    if (len > 0) {
-        state->checksum += (uint64_t)((char *)data)[0];
-    }
-}
-
-static void libcsv_row_callback(int delim, void *user_data) {
-    (void)delim;
-    bench_state_t *state = (bench_state_t *)user_data;
-    state->rows_parsed++;
-}
-
-/*
- * Benchmark runners
- */
-static double run_sonicsv_benchmark(const char *filepath, size_t file_size, bench_state_t *state) {
-    memset(state, 0, sizeof(*state));
-
-    csv_parser_t *parser = csv_parser_create(NULL);
-    if (!parser) {
-        fprintf(stderr, "Error: Failed to create SonicSV parser\n");
-        return -1;
-    }
-
-    csv_parser_set_row_callback(parser, sonicsv_row_callback, state);
-
-    uint64_t start = get_time_ns();
-    csv_error_t result = csv_parse_file(parser, filepath);
-    uint64_t end = get_time_ns();
-
-    if (result != CSV_OK) {
-        fprintf(stderr, "Error: SonicSV parse failed: %s\n", csv_error_string(result));
-        csv_parser_destroy(parser);
-        return -1;
-    }
-
-    state->bytes_processed = file_size;
-    csv_parser_destroy(parser);
-
-    return (double)(end - start) / 1e9;  /* Return seconds */
-}
-
-static double run_libcsv_benchmark(const char *filepath, size_t file_size, bench_state_t *state) {
-    memset(state, 0, sizeof(*state));
-
-    struct csv_parser parser;
-    if (csv_init(&parser, CSV_STRICT) != 0) {
-        fprintf(stderr, "Error: Failed to create libcsv parser\n");
-        return -1;
-    }
-
-    FILE *f = fopen(filepath, "rb");
-    if (!f) {
-        fprintf(stderr, "Error: Cannot open file %s\n", filepath);
-        csv_free(&parser);
-        return -1;
-    }
-
-    char *buffer = malloc(65536);
-    if (!buffer) {
-        fclose(f);
-        csv_free(&parser);
-        return -1;
-    }
-
-    uint64_t start = get_time_ns();
-
-    size_t bytes_read;
-    while ((bytes_read = fread(buffer, 1, 65536, f)) > 0) {
-        if (csv_parse(&parser, buffer, bytes_read,
-                      libcsv_field_callback, libcsv_row_callback, state) != bytes_read) {
-            fprintf(stderr, "Error: libcsv parse error: %s\n", csv_strerror(csv_error(&parser)));
-            break;
-        }
-    }
-    csv_fini(&parser, libcsv_field_callback, libcsv_row_callback, state);
-
-    uint64_t end = get_time_ns();
-
-    fclose(f);
-    free(buffer);
-    csv_free(&parser);
-
-    state->bytes_processed = file_size;
-    return (double)(end - start) / 1e9;
-}
-
-/*
- * Result storage
- */
-typedef struct {
-    const char *test_name;
-    size_t file_size;
-    size_t expected_rows;
-    size_t expected_fields;
-
-    timing_stats_t sonicsv_times;
-    timing_stats_t libcsv_times;
-
-    double sonicsv_throughput;
-    double libcsv_throughput;
-    double speedup;
-
-    /* Validation data - row/field counts are more reliable than checksums */
-    uint64_t sonicsv_rows;
-    uint64_t sonicsv_fields;
-    uint64_t libcsv_rows;
-    uint64_t libcsv_fields;
-} test_result_t;
-
-/*
- * Report generation
- */
-static void print_separator(FILE *out, int width) {
-    for (int i = 0; i < width; i++) fputc('=', out);
-    fputc('\n', out);
-}
-
-static void print_line(FILE *out, int width) {
-    for (int i = 0; i < width; i++) fputc('-', out);
-    fputc('\n', out);
-}
-
-static void print_report(FILE *out, test_result_t *results, size_t num_results,
-                         int iterations, int warmup) {
-    const int width = 95;
-
-    fprintf(out, "\n");
-    print_separator(out, width);
-    fprintf(out, "SONICSV vs LIBCSV BENCHMARK REPORT\n");
-    print_separator(out, width);
-
-    /* System information */
-    time_t now = time(NULL);
-    char time_str[64];
-    strftime(time_str, sizeof(time_str), "%Y-%m-%d %H:%M:%S", localtime(&now));
-
-    fprintf(out, "\nTEST CONFIGURATION\n");
-    print_line(out, width);
-    fprintf(out, "  Timestamp:           %s\n", time_str);
-    fprintf(out, "  Iterations:          %d (after %d warmup runs)\n", iterations, warmup);
-    fprintf(out, "  Test cases:          %zu\n", num_results);
-
-#ifdef __APPLE__
-    fprintf(out, "  Platform:            macOS\n");
-#else
-    fprintf(out, "  Platform:            Linux\n");
-#endif
-
-#ifdef __aarch64__
-    fprintf(out, "  Architecture:        ARM64 (NEON SIMD)\n");
-#elif defined(__x86_64__)
-    fprintf(out, "  Architecture:        x86_64 (SSE4.2/AVX2 SIMD)\n");
-#else
-    fprintf(out, "  Architecture:        Generic\n");
-#endif
-
-    /* Summary statistics */
-    double total_sonicsv_time = 0, total_libcsv_time = 0;
-    double total_bytes = 0;
-    double min_speedup = 1e30, max_speedup = 0, sum_speedup = 0;
-    int sonicsv_wins = 0, libcsv_wins = 0, ties = 0;
-
-    for (size_t i = 0; i < num_results; i++) {
-        total_sonicsv_time += stats_mean(&results[i].sonicsv_times);
-        total_libcsv_time += stats_mean(&results[i].libcsv_times);
-        total_bytes += results[i].file_size;
-        sum_speedup += results[i].speedup;
-        if (results[i].speedup < min_speedup) min_speedup = results[i].speedup;
-        if (results[i].speedup > max_speedup) max_speedup = results[i].speedup;
-        if (results[i].speedup > 1.05) sonicsv_wins++;
-        else if (results[i].speedup < 0.95) libcsv_wins++;
-        else ties++;
-    }
-
-    double avg_sonicsv_throughput = (total_bytes / (1024.0 * 1024.0)) / total_sonicsv_time;
-    double avg_libcsv_throughput = (total_bytes / (1024.0 * 1024.0)) / total_libcsv_time;
-
-    fprintf(out, "\nOVERALL SUMMARY\n");
-    print_line(out, width);
-    fprintf(out, "  SonicSV victories:   %d / %zu tests (>5%% faster)\n", sonicsv_wins, num_results);
-    fprintf(out, "  libcsv victories:    %d / %zu tests (>5%% faster)\n", libcsv_wins, num_results);
-    fprintf(out, "  Ties:                %d / %zu tests (within 5%%)\n", ties, num_results);
-    fprintf(out, "\n");
-    fprintf(out, "  Aggregate SonicSV:   %.1f MB/s (total: %.2f MB in %.3f s)\n",
-            avg_sonicsv_throughput, total_bytes / (1024.0 * 1024.0), total_sonicsv_time);
-    fprintf(out, "  Aggregate libcsv:    %.1f MB/s (total: %.2f MB in %.3f s)\n",
-            avg_libcsv_throughput, total_bytes / (1024.0 * 1024.0), total_libcsv_time);
-    fprintf(out, "  Aggregate speedup:   %.2fx\n", avg_sonicsv_throughput / avg_libcsv_throughput);
-    fprintf(out, "\n");
-    fprintf(out, "  Per-test speedup:\n");
-    fprintf(out, "    Average:           %.2fx\n", sum_speedup / num_results);
-    fprintf(out, "    Minimum:           %.2fx\n", min_speedup);
-    fprintf(out, "    Maximum:           %.2fx\n", max_speedup);
-
-    /* Detailed results table */
-    fprintf(out, "\nDETAILED RESULTS BY TEST\n");
-    print_separator(out, width);
-
-    fprintf(out, "\n%-18s %8s %10s %10s %8s %8s %6s\n",
-            "Test", "Size", "SonicSV", "libcsv", "Speedup", "Winner", "Valid");
-    fprintf(out, "%-18s %8s %10s %10s %8s %8s %6s\n",
-            "", "(MB)", "(MB/s)", "(MB/s)", "", "", "");
-    print_line(out, width);
-
-    for (size_t i = 0; i < num_results; i++) {
-        test_result_t *r = &results[i];
-        double size_mb = r->file_size / (1024.0 * 1024.0);
-        const char *winner = r->speedup > 1.05 ? "SonicSV" :
-                            (r->speedup < 0.95 ? "libcsv" : "-");
-        /* Validate based on row counts - more reliable than byte-level checksums */
-        bool counts_match = (r->sonicsv_rows == r->libcsv_rows) &&
-                           (r->sonicsv_fields == r->libcsv_fields);
-        const char *valid = counts_match ? "yes" : "FAIL";
-
-        fprintf(out, "%-18s %8.2f %10.1f %10.1f %7.2fx %8s %6s\n",
-                r->test_name, size_mb, r->sonicsv_throughput, r->libcsv_throughput,
-                r->speedup, winner, valid);
-    }
-
-    print_line(out, width);
-
-    /* Timing variance details */
-    fprintf(out, "\nTIMING VARIANCE (seconds, lower is better)\n");
-    print_line(out, width);
-
-    fprintf(out, "\n%-18s %10s %10s %10s %10s\n",
-            "Test", "SonicSV", "(stddev)", "libcsv", "(stddev)");
-    print_line(out, width);
-
-    for (size_t i = 0; i < num_results; i++) {
-        test_result_t *r = &results[i];
-        fprintf(out, "%-18s %10.4f %10.4f %10.4f %10.4f\n",
-                r->test_name,
-                stats_mean(&r->sonicsv_times),
-                stats_stddev(&r->sonicsv_times),
-                stats_mean(&r->libcsv_times),
-                stats_stddev(&r->libcsv_times));
-    }
-
-    print_separator(out, width);
-    fprintf(out, "End of benchmark report.\n\n");
-}
-
-/*
- * Main benchmark runner
- */
-static int run_benchmark_suite(int iterations, int warmup, FILE *report_out) {
-    test_result_t results[NUM_TESTS];
-    memset(results, 0, sizeof(results));
-
-    /* Create temp directory */
-    mkdir(TEMP_DIR, 0755);
-
-    fprintf(report_out, "Configuration: %zu tests, %d iterations, %d warmup\n\n",
-            NUM_TESTS, iterations, warmup);
-
-    fprintf(report_out, "%-4s %-18s %8s %10s %10s %8s\n",
-            "#", "Test", "Size", "SonicSV", "libcsv", "Speedup");
-    fprintf(report_out, "---- ------------------ -------- ---------- ---------- --------\n");
-
-    for (size_t t = 0; t < NUM_TESTS; t++) {
-        const test_config_t *config = &test_configs[t];
-        test_result_t *result = &results[t];
-
-        result->test_name = config->name;
-        stats_init(&result->sonicsv_times);
-        stats_init(&result->libcsv_times);
-
-        /* Generate test file */
-        char filepath[256];
-        snprintf(filepath, sizeof(filepath), "%s/%s.csv", TEMP_DIR, config->name);
-
-        size_t file_size = generate_test_file(config, filepath);
-        if (file_size == 0) {
-            fprintf(stderr, "[%2zu] %-18s FAILED (data generation)\n", t + 1, config->name);
-            continue;
-        }
-
-        result->file_size = file_size;
-        result->expected_rows = config->rows + 1;  /* +1 for header row */
-        result->expected_fields = (config->rows + 1) * config->fields_per_row;
-
-        bench_state_t state;
-
-        /* Warmup runs */
-        for (int w = 0; w < warmup; w++) {
-            run_sonicsv_benchmark(filepath, file_size, &state);
-            run_libcsv_benchmark(filepath, file_size, &state);
-        }
-
-        /* Timed runs - SonicSV */
-        for (int i = 0; i < iterations; i++) {
-            double elapsed = run_sonicsv_benchmark(filepath, file_size, &state);
-            if (elapsed > 0) {
-                stats_add(&result->sonicsv_times, elapsed);
-            }
-            if (i == iterations - 1) {
-                result->sonicsv_rows = state.rows_parsed;
-                result->sonicsv_fields = state.fields_parsed;
-            }
-        }
-
-        /* Timed runs - libcsv */
-        for (int i = 0; i < iterations; i++) {
-            double elapsed = run_libcsv_benchmark(filepath, file_size, &state);
-            if (elapsed > 0) {
-                stats_add(&result->libcsv_times, elapsed);
-            }
-            if (i == iterations - 1) {
-                result->libcsv_rows = state.rows_parsed;
-                result->libcsv_fields = state.fields_parsed;
-            }
-        }
-
-        /* Calculate throughput */
-        double sonicsv_mean = stats_mean(&result->sonicsv_times);
-        double libcsv_mean = stats_mean(&result->libcsv_times);
-
-        result->sonicsv_throughput = (file_size / (1024.0 * 1024.0)) / sonicsv_mean;
-        result->libcsv_throughput = (file_size / (1024.0 * 1024.0)) / libcsv_mean;
-        result->speedup = result->sonicsv_throughput / result->libcsv_throughput;
-
-        fprintf(report_out, "[%2zu] %-18s %6.1fMB %8.1fMB/s %8.1fMB/s %6.2fx\n",
-                t + 1, config->name,
-                file_size / (1024.0 * 1024.0),
-                result->sonicsv_throughput,
-                result->libcsv_throughput,
-                result->speedup);
-
-        /* Clean up test file */
-        unlink(filepath);
-    }
-
-    /* Cleanup */
-    rmdir(TEMP_DIR);
-
-    (void)print_report; /* suppressed; --output now receives the same compact table */
-    return 0;
-}
-
-/*
- * Entry point
- */
-int main(int argc, char **argv) {
-    int iterations = DEFAULT_ITERATIONS;
-    int warmup = DEFAULT_WARMUP;
-    const char *output_file = NULL;
-
-    static struct option long_options[] = {
-        {"iterations", required_argument, 0, 'i'},
-        {"warmup",     required_argument, 0, 'w'},
-        {"output",     required_argument, 0, 'o'},
-        {"help",       no_argument,       0, 'h'},
-        {0, 0, 0, 0}
-    };
-
-    int opt;
-    while ((opt = getopt_long(argc, argv, "i:w:o:h", long_options, NULL)) != -1) {
-        switch (opt) {
-            case 'i':
-                iterations = atoi(optarg);
-                if (iterations < 1) iterations = 1;
-                break;
-            case 'w':
-                warmup = atoi(optarg);
-                if (warmup < 0) warmup = 0;
-                break;
-            case 'o':
-                output_file = optarg;
-                break;
-            case 'h':
-            default:
-                fprintf(stderr, "SonicSV Benchmark Suite\n\n");
-                fprintf(stderr, "Usage: %s [options]\n\n", argv[0]);
-                fprintf(stderr, "Options:\n");
-                fprintf(stderr, "  -i, --iterations N   Timed iterations per test (default: %d)\n", DEFAULT_ITERATIONS);
-                fprintf(stderr, "  -w, --warmup N       Warmup iterations per test (default: %d)\n", DEFAULT_WARMUP);
-                fprintf(stderr, "  -o, --output FILE    Write report to file (default: stdout)\n");
-                fprintf(stderr, "  -h, --help           Show this help message\n\n");
-                fprintf(stderr, "This tool generates CSV test data, parses it with both SonicSV and\n");
-                fprintf(stderr, "libcsv under identical conditions, and produces a detailed comparison.\n");
-                return opt == 'h' ? 0 : 1;
-        }
-    }
-
-    FILE *report_out = stdout;
-    if (output_file) {
-        report_out = fopen(output_file, "w");
-        if (!report_out) {
-            fprintf(stderr, "Error: Cannot open output file %s: %s\n", output_file, strerror(errno));
-            return 1;
-        }
-    }
-
-    int result = run_benchmark_suite(iterations, warmup, report_out);
-
-    if (output_file) {
-        fclose(report_out);
-        fprintf(stderr, "Report written to: %s\n", output_file);
-    }
-
-    return result;
-}
+
+/* NULL if level isn't one --isa knows */
+static const simd_level_t *find_simd_level(const char *level) {
+    for (size_t i = 0; i < sizeof(simd_levels) / sizeof(simd_levels[0]); i++) {
+        if (strcasecmp(level, simd_levels[i].name) == 0) return &simd_levels[i];
+    }
+    return NULL;
+}
+
+/* level must be a known name (checked while parsing options); false if the CPU lacks it */
+static bool pin_simd_level(const char *level) {
+    const simd_level_t *l = find_simd_level(level);
+    uint32_t detected = simd_features();
+    if ((detected & l->needs) != l->needs) {
+        fprintf(stderr, "Error: --isa %s: this CPU doesn't support it\n", level);
+        return false;
+    }
+    g_simd_detected = detected;
+    g_simd_pinned = l->name;
+    atomic_store_explicit(&g_simd_features_atomic, (detected & l->mask) | CSV_SIMD_INITIALIZED_FLAG,
+                          memory_order_relaxed);
+    return true;
+}
+
+static void describe_simd(uint32_t features, char *out, size_t size) {
+    static const struct { uint32_t flag; const char *name; } names[] = {
+        {CSV_SIMD_SSE4_2, "sse4.2"}, {CSV_SIMD_AVX2, "avx2"}, {CSV_SIMD_AVX512, "avx512"},
+        {CSV_SIMD_NEON, "neon"},     {CSV_SIMD_SVE, "sve"},
+    };
+    size_t len = 0;
+    out[0] = '\0';
+    for (size_t i = 0; i < sizeof(names) / sizeof(names[0]); i++) {
+        if (!(features & names[i].flag)) continue;
+        int n = snprintf(out + len, size - len, "%s%s", len ? " " : "", names[i].name);
+        if (n < 0 || (size_t)n >= size - len) break;
+        len += (size_t)n;
+    }
+    if (len == 0) snprintf(out, size, "none");
+}
+
+static void warn_missing_simd(void) {
+    if (g_simd_pinned) return;
+    uint32_t features = simd_features();
+#if defined(__x86_64__) || defined(_M_X64)
+    if (!(features & CSV_SIMD_AVX2)) {
+        fprintf(stderr, "Warning: no AVX2 on this CPU; SonicSV runs its %s path, not the one it is tuned for\n",
+                features & CSV_SIMD_SSE4_2 ? "SSE4.2" : "scalar");
+    }
+#ifndef HAVE_AVX512
+    if (features & CSV_SIMD_AVX512) {
+        fprintf(stderr, "Note: this CPU has AVX-512 but the build excludes it (SONICSV_DISABLE_AVX512 or old compiler)\n");
+    }
+#endif
+#elif defined(__aarch64__) || defined(_M_ARM64)
+    if (!(features & CSV_SIMD_NEON)) {
+        fprintf(stderr, "Warning: NEON not detected; SonicSV runs its scalar path\n");
+    }
+#else
+    (void)features;
+    fprintf(stderr, "Warning: SonicSV has no SIMD path for this architecture; results are scalar\n");
+#endif
+}
+
+static void collect_machine_info(machine_info_t *m) {
+    memset(m, 0, sizeof(*m));
+    describe_simd(simd_features(), m->simd, sizeof(m->simd));
+    snprintf(m->cpu, sizeof(m->cpu), "unknown");
+    snprintf(m->governor, sizeof(m->governor), "n/a");
+    snprintf(m->turbo, sizeof(m->turbo), "n/a");
+    snprintf(m->cores, sizeof(m->cores), "n/a");
+
+    int physical, logical;
+    if (count_cores(&physical, &logical)) {
+        snprintf(m->cores, sizeof(m->cores), "%d physical, %d logical", physical, logical);
+    }
+
+    struct utsname u;
+    if (uname(&u) == 0) {
+        snprintf(m->kernel, sizeof(m->kernel), "%s %s %s", u.sysname, u.release, u.machine);
+    }
+
+#ifdef __APPLE__
+    size_t len = sizeof(m->cpu);
+    if (sysctlbyname("machdep.cpu.brand_string", m->cpu, &len, NULL, 0) != 0) {
+        snprintf(m->cpu, sizeof(m->cpu), "unknown");
+    }
+#else
+    FILE *f = fopen("/proc/cpuinfo", "r");
+    if (f) {
+        char line[256];
+        while (fgets(line, sizeof(line), f)) {
+            if (strncmp(line, "model name", 10) == 0 || strncmp(line, "Model", 5) == 0) {
+                char *colon = strchr(line, ':');
+                if (colon) {
+                    snprintf(m->cpu, sizeof(m->cpu), "%s", colon + 2);
+                    trim_newline(m->cpu);
+                    break;
+                }
+            }
+        }
+        fclose(f);
+    }
+    read_first_line("/sys/devices/system/cpu/cpu0/cpufreq/scaling_governor",
+                    m->governor, sizeof(m->governor));
+
+    /* intel_pstate inverts the sense: no_turbo=1 means boost is off */
+    char value[8];
+    if (read_first_line("/sys/devices/system/cpu/intel_pstate/no_turbo", value, sizeof(value))) {
+        snprintf(m->turbo, sizeof(m->turbo), "%s", value[0] == '1' ? "off" : "on");
+    } else if (read_first_line("/sys/devices/system/cpu/cpufreq/boost", value, sizeof(value))) {
+        snprintf(m->turbo, sizeof(m->turbo), "%s", value[0] == '1' ? "on" : "off");
+    }
+#endif
+
+    long pages = sysconf(_SC_PHYS_PAGES), page_size = sysconf(_SC_PAGESIZE);
+    if (pages > 0 && page_size > 0) {
+        snprintf(m->memory, sizeof(m->memory), "%.0f GB",
+                 (double)pages * (double)page_size / (1024.0 * 1024.0 * 1024.0));
+    }
+}
+
+/*
+ * CPU frequency control - pins every core to the performance governor
+ * and/or disables turbo boost for the duration of the run, then puts the
+ * original values back. Needs root; without it the settings are left
+ * alone and a warning says so. Restoration also runs on SIGINT/SIGTERM,
+ * so every path, value and length it needs is stored when the tuning is
+ * applied: the handler itself only calls open, write, close and _exit.
+ */
+#define CPU_TUNING_MAX_CPUS 1024
+
+static struct {
+    char governor_path[CPU_TUNING_MAX_CPUS][64];
+    char governor[CPU_TUNING_MAX_CPUS][32];
+    size_t governor_len[CPU_TUNING_MAX_CPUS];  /* 0 = nothing saved for this core */
+    volatile sig_atomic_t num_cpus;
+    char turbo_path[64];
+    char turbo_value[8];
+    volatile sig_atomic_t turbo_len;           /* 0 = turbo untouched */
+} g_cpu_saved;
+
+static bool write_sysfs(const char *path, const char *value, size_t len) {
+    int fd = open(path, O_WRONLY);
+    if (fd < 0) return false;
+    bool ok = write(fd, value, len) == (ssize_t)len;
+    close(fd);
+    return ok;
+}
+
+/* Async-signal-safe: runs from atexit() and from the SIGINT/SIGTERM handler */
+static void restore_cpu_tuning(void) {
+    for (int cpu = 0; cpu < g_cpu_saved.num_cpus; cpu++) {
+        if (g_cpu_saved.governor_len[cpu] == 0) continue;
+        write_sysfs(g_cpu_saved.governor_path[cpu], g_cpu_saved.governor[cpu],
+                    g_cpu_saved.governor_len[cpu]);
+    }
+    g_cpu_saved.num_cpus = 0;
+    if (g_cpu_saved.turbo_len > 0) {
+        write_sysfs(g_cpu_saved.turbo_path, g_cpu_saved.turbo_value, (size_t)g_cpu_saved.turbo_len);
+        g_cpu_saved.turbo_len = 0;
+    }
+}
+
+static void restore_cpu_tuning_on_signal(int sig) {
+    restore_cpu_tuning();
+    _exit(128 + sig);
+}
+
+static void apply_cpu_tuning(bool performance_governor, bool disable_turbo) {
+    if (!performance_governor && !disable_turbo) return;
+    if (geteuid() != 0) {
+        fprintf(stderr, "Warning: changing the CPU governor or turbo state needs root (try sudo); "
+                        "leaving CPU settings unchanged\n");
+        return;
+    }
+
+    if (performance_governor) {
+        long num_cpus = sysconf(_SC_NPROCESSORS_CONF);
+        if (num_cpus > CPU_TUNING_MAX_CPUS) num_cpus = CPU_TUNING_MAX_CPUS;
+        int changed = 0;
+        for (int cpu = 0; cpu < num_cpus; cpu++) {
+            char *path = g_cpu_saved.governor_path[cpu];
+            snprintf(path, sizeof(g_cpu_saved.governor_path[cpu]),
+                     "/sys/devices/system/cpu/cpu%d/cpufreq/scaling_governor", cpu);
+            if (!read_first_line(path, g_cpu_saved.governor[cpu], sizeof(g_cpu_saved.governor[cpu]))) {
+                continue;  /* offline core or no cpufreq driver */
+            }
+            g_cpu_saved.governor_len[cpu] = strlen(g_cpu_saved.governor[cpu]);
+            g_cpu_saved.num_cpus = cpu + 1;
+            if (write_sysfs(path, "performance", strlen("performance"))) changed++;
+        }
+        if (changed == 0) {
+            fprintf(stderr, "Warning: no cpufreq governor could be set to performance\n");
+        }
+    }
+
+    if (disable_turbo) {
+        static const struct { const char *path; const char *off; } knobs[] = {
+            {"/sys/devices/system/cpu/intel_pstate/no_turbo", "1"},
+            {"/sys/devices/system/cpu/cpufreq/boost",         "0"},
+        };
+        bool done = false;
+        for (size_t i = 0; i < sizeof(knobs) / sizeof(knobs[0]) && !done; i++) {
+            char value[8];
+            if (!read_first_line(knobs[i].path, value, sizeof(value))) continue;
+            snprintf(g_cpu_saved.turbo_value, sizeof(g_cpu_saved.turbo_value), "%s", value);
+            snprintf(g_cpu_saved.turbo_path, sizeof(g_cpu_saved.turbo_path), "%s", knobs[i].path);
+            g_cpu_saved.turbo_len = (sig_atomic_t)strlen(g_cpu_saved.turbo_value);
+            done = write_sysfs(knobs[i].path, knobs[i].off, strlen(knobs[i].off));
+        }
+        if (!done) {
+            fprintf(stderr, "Warning: no turbo boost control found; turbo state unchanged\n");
+        }
+    }
+
+    atexit(restore_cpu_tuning);
+    signal(SIGINT, restore_cpu_tuning_on_signal);
+    signal(SIGTERM, restore_cpu_tuning_on_signal);
+}
+
+/*
+ * Restricts the process to one logical CPU per physical core, so a run
+ * never lands on a hyperthread sharing execution units with another
+ * thread of the suite or with whatever the sibling is running.
+ */
+static void restrict_to_physical_cores(void) {
+#ifdef __linux__
+    cpu_set_t current, primaries;
+    if (sched_getaffinity(0, sizeof(current), &current) != 0) {
+        fprintf(stderr, "Warning: cannot read CPU affinity: %s\n", strerror(errno));
+        return;
+    }
+    CPU_ZERO(&primaries);
+    int kept = 0, dropped = 0;
+    for (int cpu = 0; cpu < CPU_SETSIZE && cpu < CPU_TOPOLOGY_MAX_CPUS; cpu++) {
+        if (!CPU_ISSET(cpu, &current)) continue;
+        bool primary;
+        if (!is_primary_thread(cpu, &primary)) primary = true;
+        if (primary) {
+            CPU_SET(cpu, &primaries);
+            kept++;
+        } else {
+            dropped++;
+        }
+    }
+    if (dropped == 0) return;  /* no SMT siblings in the current mask */
+    if (sched_setaffinity(0, sizeof(primaries), &primaries) != 0) {
+        fprintf(stderr, "Warning: cannot restrict to physical cores: %s\n", strerror(errno));
+        return;
+    }
+    fprintf(stderr, "Restricted to %d physical cores (%d SMT siblings excluded)\n", kept, dropped);
+#else
+    fprintf(stderr, "Warning: --physical-cores-only is only supported on Linux\n");
+#endif
+}
+
+/*
+ * Apple Silicon mixes performance and efficiency cores, and an unpinned
+ * run lands on either depending on load, blending the two. macOS has no
+ * hard affinity, but the QoS class steers the scheduler: user-interactive
+ * work goes to P-cores and background work stays on E-cores. Samples all
+ * run on the main thread (stripes inherit its class), so setting it once
+ * up front covers the whole run.
+ */
+static const char *g_core_class;  /* --core-class, NULL = scheduler's choice */
+
+static bool apply_core_class(const char *cls) {
+#ifdef __APPLE__
+    qos_class_t qos;
+    if (strcmp(cls, "performance") == 0) {
+        qos = QOS_CLASS_USER_INTERACTIVE;
+    } else if (strcmp(cls, "efficiency") == 0) {
+        qos = QOS_CLASS_BACKGROUND;
+    } else {
+        fprintf(stderr, "Error: --core-class must be performance or efficiency\n");
+        return false;
+    }
+    int err = pthread_set_qos_class_self_np(qos, 0);
+    if (err != 0) {
+        fprintf(stderr, "Error: cannot set QoS class: %s\n", strerror(err));
+        return false;
+    }
+    g_core_class = cls;
+    return true;
+#else
+    (void)cls;
+    fprintf(stderr, "Error: --core-class is only supported on macOS\n");
+    return false;
+#endif
+}
+
+/* --filter predicate, see parse_filter() */
+typedef enum { PRED_EQ, PRED_NE, PRED_LT, PRED_LE, PRED_GT, PRED_GE } pred_op_t;
+
+struct filter_predicate {
+    size_t col;         /* 0-based */
+    pred_op_t op;
+    char text[64];
+    size_t text_len;
+    double number;
+};
+
+/* --weights criteria, see print_score_summary() */
+enum { SCORE_THROUGHPUT, SCORE_MEMORY, SCORE_STABILITY, SCORE_RELIABILITY, SCORE_CRITERIA };
+static const char *const score_names[SCORE_CRITERIA] = {
+    "throughput", "memory", "stability", "reliability",
+};
+
+/* --fail-fast / --keep-going phases of each suite test */
+enum { PHASE_GENERATE, PHASE_PARSE, PHASE_VERIFY, FAIL_PHASES };
+static const char *const fail_phase_names[FAIL_PHASES] = {"generate", "parse", "verify"};
+
+/*
+ * Performance assertions - each --assert "sonicsv>=2000MB/s@csv_*" states
+ * a floor (or with <= a ceiling) for a parser's mean throughput on the
+ * tests matching the glob after @. Units are MB/s (10^6), MiB/s or GB/s.
+ * Any failed assertion makes the run exit 4, so published numbers are
+ * checked on the reference machine rather than trusted.
+ */
+#define MAX_ASSERTIONS 32
+
+typedef struct {
+    const char *text;
+    char parser[32];
+    bool at_least;
+    double bytes_per_s;
+    char test_glob[64];
+} assertion_t;
+
+/*
+ * Run options - everything main() parses from the command line
+ */
+typedef struct {
+    int iterations;
+    int warmup;
+    FILE *report_out;
+    FILE *benchstat_out;  /* NULL unless --benchstat was given */
+    FILE *trace_out;      /* NULL unless --trace was given */
+    size_t target_bytes;  /* Scale every test to this size; 0 keeps config rows */
+    bool subtract_overhead;
+    int repeat;           /* Parses per timed sample for small files */
+    const char *baseline_path;  /* benchstat file to compare against */
+    bool sandbox;         /* Run each parser from its own scratch directory */
+    const char *quarantine_path;  /* NULL unless --quarantine was given */
+    bool include_quarantined;     /* Retry quarantined parser/test pairs */
+    bool sample_env;      /* Add load/memory/swap columns to benchstat lines */
+    const char *report_path;    /* --report: benchstat file to summarize */
+    const char *parser_glob;    /* --report filters; NULL matches all */
+    const char *scenario_glob;
+    const char *metric;         /* unit to summarize, e.g. "MB/s" */
+    const char *merge_path;     /* --merge: pooled output file */
+    double time_budget;         /* Seconds of parsing to fit in; 0 = no limit */
+    const char *history_path;   /* benchstat file the budget is planned from */
+    const char *keep_dir;       /* Keep generated files here instead of deleting */
+    bool compress;              /* zstd-compress kept files */
+    bool prefetch;              /* Read the input into the page cache before timing */
+    bool reshuffle;             /* Regenerate the input with a new seed per iteration */
+    int stripes;                /* Concurrent samplers for small files; 1 = serial */
+    const assertion_t *assertions;  /* --assert floors/ceilings */
+    const char *cross_arch_path;    /* benchstat file from another architecture */
+    int num_assertions;
+    char *const *merge_inputs;  /* positional benchstat files (--merge, --aggregate) */
+    int num_merge_inputs;
+    size_t range_first;         /* --range: first row parsed (0 = header) */
+    size_t range_last;          /* one past the last row; 0 = no --range */
+    int in_memory_passes;       /* --in-memory: passes over each loaded file, 0 = off */
+    const char *projection_arg; /* --project as given, NULL = off */
+    uint64_t projection;        /* columns to materialize, bit 0 = column 1 */
+    size_t projection_max_col;
+    const char *filter_arg;     /* --filter as given, NULL = off */
+    struct filter_predicate filter;
+    size_t group_col;           /* --group-by column, 0-based; SIZE_MAX = off */
+    const char *share_path;     /* --share: scrubbed output file */
+    const char *share_input;    /* benchstat file to export */
+    bool aggregate;             /* --aggregate: hardware matrix from shared bundles */
+    const char *golden_path;    /* --golden=PATH / --write-golden=PATH, NULL = default */
+    double weights[SCORE_CRITERIA];  /* --weights, see print_score_summary() */
+    const char *pareto_path;    /* --pareto-data: plottable front points, NULL = off */
+    size_t churn_cycles;        /* --churn: create/parse/destroy cycles, 0 = off */
+    int hammer_threads;         /* --hammer: concurrent parsing threads, 0 = off */
+    double soak_seconds;        /* --soak: wall time per parser, 0 = off */
+    unsigned fail_fast;         /* bit per phase whose failure stops the suite; 0 = keep going */
+    bool force_compare;   /* Compare even when machine fingerprints differ */
+} bench_options_t;
+
+/*
+ * Phase tracing - records how long the suite itself spends generating,
+ * warming up, timing and cleaning up each test, so a stalled run can be
+ * attributed to the orchestration rather than to a parser.
+ */
+static uint64_t g_trace_origin_ns;
+
+static void trace_phase(const bench_options_t *opts, const char *test_name,
+                        const char *phase, uint64_t begin_ns, uint64_t end_ns) {
+    if (!opts->trace_out) return;
+    fprintf(opts->trace_out, "%12.3f %12.3f  %-18s %s\n",
+            (begin_ns - g_trace_origin_ns) / 1e6, (end_ns - begin_ns) / 1e6,
+            test_name, phase);
+    fflush(opts->trace_out);
+}
+
+/*
+ * Quarantine - parser/test pairs that crashed the suite or returned
+ * errors are listed in the --quarantine file and skipped on later runs
+ * (unless --include-quarantined), so one broken combination doesn't
+ * abort or pollute every run. Each pair is written as "crashed" before
+ * it runs and updated afterwards, so a crash leaves its entry behind.
+ */
+#define QUARANTINE_MAX 256
+
+typedef struct {
+    char key[96];     /* "SonicSV/tiny_simple" */
+    char reason[16];  /* "crashed" or "error" */
+} quarantine_entry_t;
+
+static struct {
+    quarantine_entry_t entries[QUARANTINE_MAX];
+    size_t count;
+} g_quarantine;
+
+static void quarantine_load(const char *path) {
+    g_quarantine.count = 0;
+    FILE *f = fopen(path, "r");
+    if (!f) return;  /* no file yet: nothing quarantined */
+    char line[160];
+    while (fgets(line, sizeof(line), f) && g_quarantine.count < QUARANTINE_MAX) {
+        quarantine_entry_t *e = &g_quarantine.entries[g_quarantine.count];
+        if (sscanf(line, "%95s %15s", e->key, e->reason) == 2) g_quarantine.count++;
+    }
+    fclose(f);
+}
+
+/*
+ * Writes the list to a temporary file next to path and renames it over
+ * the original, so a crash mid-write leaves either the old list or the
+ * new one, never a truncated file. The fsync is what makes the "crashed"
+ * marker survive the crash it is recording.
+ */
+static void quarantine_save(const char *path) {
+    char tmp[PATH_MAX];
+    if (snprintf(tmp, sizeof(tmp), "%s.tmp", path) >= (int)sizeof(tmp)) {
+        fprintf(stderr, "Warning: quarantine file path too long: %s\n", path);
+        return;
+    }
+    FILE *f = fopen(tmp, "w");
+    if (!f) {
+        fprintf(stderr, "Warning: cannot write quarantine file %s: %s\n", tmp, strerror(errno));
+        return;
+    }
+    bool ok = true;
+    for (size_t i = 0; i < g_quarantine.count && ok; i++) {
+        ok = fprintf(f, "%s %s\n", g_quarantine.entries[i].key, g_quarantine.entries[i].reason) >= 0;
+    }
+    ok = ok && fflush(f) == 0 && fsync(fileno(f)) == 0;
+    int saved_errno = errno;
+    if (fclose(f) != 0 && ok) {
+        ok = false;
+        saved_errno = errno;
+    }
+    if (ok && rename(tmp, path) != 0) {
+        ok = false;
+        saved_errno = errno;
+    }
+    if (!ok) {
+        fprintf(stderr, "Warning: cannot write quarantine file %s: %s\n", path, strerror(saved_errno));
+        unlink(tmp);
+    }
+}
+
+static quarantine_entry_t *quarantine_find(const char *key) {
+    for (size_t i = 0; i < g_quarantine.count; i++) {
+        if (strcmp(g_quarantine.entries[i].key, key) == 0) return &g_quarantine.entries[i];
+    }
+    return NULL;
+}
+
+/* Returns false if the pair should be skipped; otherwise marks it as in progress */
+static bool quarantine_admit(const bench_options_t *opts, const char *parser, const char *test_name) {
+    if (!opts->quarantine_path) return true;
+
+    char key[96];
+    snprintf(key, sizeof(key), "%s/%s", parser, test_name);
+    quarantine_entry_t *e = quarantine_find(key);
+    if (e && !opts->include_quarantined) {
+        fprintf(stderr, "     %-18s %s skipped (quarantined: %s)\n", test_name, parser, e->reason);
+        return false;
+    }
+    if (!e) {
+        if (g_quarantine.count == QUARANTINE_MAX) return true;
+        e = &g_quarantine.entries[g_quarantine.count++];
+        snprintf(e->key, sizeof(e->key), "%s", key);
+    }
+    snprintf(e->reason, sizeof(e->reason), "crashed");
+    quarantine_save(opts->quarantine_path);
+    return true;
+}
+
+/* Records how an admitted pair finished: errors stay quarantined, successes are released */
+static void quarantine_finish(const bench_options_t *opts, const char *parser,
+                              const char *test_name, bool failed) {
+    if (!opts->quarantine_path) return;
+
+    char key[96];
+    snprintf(key, sizeof(key), "%s/%s", parser, test_name);
+    quarantine_entry_t *e = quarantine_find(key);
+    if (!e) return;
+    if (failed) {
+        snprintf(e->reason, sizeof(e->reason), "error");
+    } else {
+        *e = g_quarantine.entries[--g_quarantine.count];
+    }
+    quarantine_save(opts->quarantine_path);
+}
+
+/*
+ * Health check - before any measured iteration each parser parses a 1 MiB
+ * quoted_mixed file once, in a child process with a short timeout. One
+ * that crashes, hangs, errors or miscounts is excluded from every test
+ * for the run and listed under SKIPPED TARGETS, instead of failing or
+ * timing out scenario after scenario.
+ */
+#define SMOKE_BYTES      (1024 * 1024)
+#define SMOKE_TIMEOUT_S  10
+
+static char g_unhealthy[NUM_PARSERS][64];  /* reason per parser_caps entry, "" = healthy */
+
+static bool parser_excluded(const char *parser) {
+    for (size_t p = 0; p < NUM_PARSERS; p++) {
+        if (strcasecmp(parser_caps[p].name, parser) == 0) return g_unhealthy[p][0] != '\0';
+    }
+    return false;
+}
+
+static void smoke_run(bench_runner_t run, const char *filepath, size_t file_size, char delim,
+                      const gen_counts_t *counts, int timeout_s, char *reason, size_t reason_size) {
+    fflush(NULL);
+    pid_t pid = fork();
+    if (pid < 0) {
+        snprintf(reason, reason_size, "fork failed: %s", strerror(errno));
+        return;
+    }
+    if (pid == 0) {
+        alarm(timeout_s);
+        bench_state_t state;
+        if (run(filepath, file_size, delim, &state) < 0) _exit(1);
+        _exit(state.rows_parsed == counts->rows && state.fields_parsed == counts->fields ? 0 : 2);
+    }
+
+    int status;
+    if (waitpid(pid, &status, 0) < 0) {
+        snprintf(reason, reason_size, "lost the child: %s", strerror(errno));
+    } else if (WIFSIGNALED(status) && WTERMSIG(status) == SIGALRM) {
+        snprintf(reason, reason_size, "timed out after %ds", timeout_s);
+    } else if (WIFSIGNALED(status)) {
+        snprintf(reason, reason_size, "crashed (%s)", strsignal(WTERMSIG(status)));
+    } else if (WEXITSTATUS(status) == 1) {
+        snprintf(reason, reason_size, "parse error");
+    } else if (WEXITSTATUS(status) != 0) {
+        snprintf(reason, reason_size, "wrong row/field counts");
+    }
+}
+
+/* Checks runners[p] for each parser_caps entry; returns the number excluded */
+static size_t smoke_check(FILE *out, const bench_runner_t *runners, int timeout_s) {
+    const test_config_t *config = &test_configs[0];
+    for (size_t t = 0; t < NUM_TESTS; t++) {
+        if (strcmp(test_configs[t].name, "quoted_mixed") == 0) config = &test_configs[t];
+    }
+    char filepath[256];
+    snprintf(filepath, sizeof(filepath), "%s/smoke.csv", g_temp_dir);
+    gen_counts_t counts;
+    size_t file_size = generate_test_file(config, filepath, SMOKE_BYTES, &counts);
+
+    size_t excluded = 0;
+    fprintf(out, "Health check (%s, 1 MiB):", config->name);
+    for (size_t p = 0; p < NUM_PARSERS; p++) {
+        g_unhealthy[p][0] = '\0';
+        if (file_size == 0) {
+            fprintf(out, "%s %s not run", p ? "," : "", parser_caps[p].name);
+            continue;
+        }
+        smoke_run(runners[p], filepath, file_size, config->delimiter, &counts, timeout_s,
+                  g_unhealthy[p], sizeof(g_unhealthy[p]));
+        fprintf(out, "%s %s %s", p ? "," : "", parser_caps[p].name,
+                g_unhealthy[p][0] ? "EXCLUDED" : "ok");
+        excluded += g_unhealthy[p][0] != '\0';
+    }
+    fprintf(out, "\n");
+    unlink(filepath);
+    return excluded;
+}
+
+static void print_skipped_targets(FILE *out) {
+    bool any = false;
+    for (size_t p = 0; p < NUM_PARSERS; p++) any |= g_unhealthy[p][0] != '\0';
+    if (!any) return;
+
+    fprintf(out, "\nSKIPPED TARGETS (failed the health check; excluded from every test)\n");
+    for (size_t p = 0; p < NUM_PARSERS; p++) {
+        if (g_unhealthy[p][0]) fprintf(out, "  %-10s %s\n", parser_caps[p].name, g_unhealthy[p]);
+    }
+}
+
+/*
+ * benchstat output - one line per timed iteration in Go's testing format,
+ * so two runs can be compared with golang.org/x/perf/cmd/benchstat.
+ * MB/s follows Go's convention of 10^6 bytes. ns/op is the parse timer
+ * alone; cpu-ns/op is process CPU time for the whole sample (file open
+ * and parser setup included), so it can exceed ns/op slightly. bytes/op
+ * is the exact input size, for rates in any unit. read-ns/op,
+ * the part of ns/op spent in read calls, appears only for runners that read
+ * through a buffer; a mapped file has no separable read time. MB/J, MB
+ * per joule of RAPL package energy over the sample, appears only where
+ * the counter is readable; striped samples share one reading, so they
+ * have none.
+ */
+static void print_benchstat_header(FILE *out, const machine_info_t *m) {
+#ifdef __APPLE__
+    fprintf(out, "goos: darwin\n");
+#else
+    fprintf(out, "goos: linux\n");
+#endif
+#if defined(__aarch64__)
+    fprintf(out, "goarch: arm64\n");
+#elif defined(__x86_64__)
+    fprintf(out, "goarch: amd64\n");
+#endif
+    fprintf(out, "pkg: sonicsv/benchmark\n");
+    fprintf(out, "cpu: %s\n", m->cpu);
+    fprintf(out, "kernel: %s\n", m->kernel);
+    fprintf(out, "memory: %s\n", m->memory);
+    fprintf(out, "governor: %s\n", m->governor);
+    fprintf(out, "turbo: %s\n", m->turbo);
+    fprintf(out, "cores: %s\n", m->cores);
+    fprintf(out, "simd: %s\n", m->simd);
+    fprintf(out, "isa: %s\n", g_simd_pinned ? g_simd_pinned : "auto");
+    if (g_core_class) fprintf(out, "core-class: %s\n", g_core_class);
+    fprintf(out, "commit: %s\n", SONICSV_GIT_COMMIT);
+    fprintf(out, "describe: %s\n", SONICSV_GIT_DESCRIBE);
+    fprintf(out, "build-log: %s\n", SONICSV_BUILD_LOG);
+    if (g_binary.sha256[0]) fprintf(out, "binary: %s\n", g_binary.sha256);
+    fprintf(out, "workfs: %s\n", g_work_fs);
+    fprintf(out, "mount: %s\n", g_work_mount);
+    fprintf(out, "device: %s\n", g_work_device);
+    fprintf(out, "iosched: %s\n", g_work_sched);
+}
+
+/*
+ * Environment sampling - with --sample-env each benchstat line also
+ * carries the 1-minute load average and available memory at the start of
+ * the iteration and the pages swapped while it ran, so iterations that
+ * overlapped with background activity can be discarded afterwards.
+ */
+typedef struct {
+    double load1;
+    double mem_avail_mb;  /* -1 when unknown */
+    uint64_t swap_pages;  /* cumulative pswpin + pswpout */
+} env_sample_t;
+
+static void sample_env(env_sample_t *e) {
+    e->load1 = 0;
+    e->mem_avail_mb = -1;
+    e->swap_pages = 0;
+
+    double load[1];
+    if (getloadavg(load, 1) == 1) e->load1 = load[0];
+
+#ifdef __linux__
+    char line[128];
+    unsigned long long value;
+    FILE *f = fopen("/proc/meminfo", "r");
+    if (f) {
+        while (fgets(line, sizeof(line), f)) {
+            if (sscanf(line, "MemAvailable: %llu kB", &value) == 1) {
+                e->mem_avail_mb = value / 1024.0;
+                break;
+            }
+        }
+        fclose(f);
+    }
+    f = fopen("/proc/vmstat", "r");
+    if (f) {
+        while (fgets(line, sizeof(line), f)) {
+            if (sscanf(line, "pswpin %llu", &value) == 1 || sscanf(line, "pswpout %llu", &value) == 1) {
+                e->swap_pages += value;
+            }
+        }
+        fclose(f);
+    }
+#endif
+}
+
+/*
+ * start/end bracket the iteration; NULL start omits the environment
+ * columns. energy_j is per parse, <= 0 omits MB/J.
+ */
+static void print_benchstat_line(FILE *out, const char *parser, const char *test_name,
+                                 size_t file_size, uint64_t wall_ns, uint64_t cpu_ns,
+                                 uint64_t read_ns, double energy_j, const env_sample_t *start,
+                                 const env_sample_t *end) {
+    fprintf(out, "Benchmark%s/%s \t1\t%llu ns/op\t%.2f MB/s\t%llu cpu-ns/op\t%zu bytes/op",
+            parser, test_name, (unsigned long long)wall_ns, file_size * 1e3 / (double)wall_ns,
+            (unsigned long long)cpu_ns, file_size);
+    if (read_ns > 0) fprintf(out, "\t%llu read-ns/op", (unsigned long long)read_ns);
+    if (energy_j > 0) fprintf(out, "\t%.2f MB/J", file_size / 1e6 / energy_j);
+    if (start && end) {
+        fprintf(out, "\t%.2f load1\t%.0f MB-avail\t%llu swap-pages", start->load1,
+                start->mem_avail_mb, (unsigned long long)(end->swap_pages - start->swap_pages));
+    }
+    fprintf(out, "\n");
+}
+
+/*
+ * Validation - a parser configured with the wrong delimiter still "succeeds",
+ * so compare against the generator's row/field counts, not just each other.
+ */
+static bool counts_match_expected(const test_result_t *r, uint64_t rows, uint64_t fields) {
+    return rows == r->expected_rows && fields == r->expected_fields;
+}
+
+static void warn_count_mismatch(size_t index, const test_result_t *r, const char *parser,
+                                uint64_t rows, uint64_t fields) {
+    fprintf(stderr, "[%2zu] %-18s WARNING: %s parsed %llu rows / %llu fields, expected %zu / %zu\n",
+            index + 1, r->test_name, parser,
+            (unsigned long long)rows, (unsigned long long)fields,
+            r->expected_rows, r->expected_fields);
+}
+
+/*
+ * Report generation
+ */
+static void print_separator(FILE *out, int width) {
+    for (int i = 0; i < width; i++) fputc('=', out);
+    fputc('\n', out);
+}
+
+static void print_line(FILE *out, int width) {
+    for (int i = 0; i < width; i++) fputc('-', out);
+    fputc('\n', out);
+}
+
+static void print_report(FILE *out, test_result_t *results, size_t num_results,
+                         int iterations, int warmup) {
+    const int width = 95;
+
+    fprintf(out, "\n");
+    print_separator(out, width);
+    fprintf(out, "SONICSV vs LIBCSV BENCHMARK REPORT\n");
+    print_separator(out, width);
+
+    /* System information */
+    time_t now = time(NULL);
+    char time_str[64];
+    strftime(time_str, sizeof(time_str), "%Y-%m-%d %H:%M:%S", localtime(&now));
+
+    fprintf(out, "\nTEST CONFIGURATION\n");
+    print_line(out, width);
+    fprintf(out, "  Timestamp:           %s\n", time_str);
+    fprintf(out, "  Iterations:          %d (after %d warmup runs)\n", iterations, warmup);
+    fprintf(out, "  Test cases:          %zu\n", num_results);
+
+#ifdef __APPLE__
+    fprintf(out, "  Platform:            macOS\n");
+#else
+    fprintf(out, "  Platform:            Linux\n");
+#endif
+
+#ifdef __aarch64__
+    fprintf(out, "  Architecture:        ARM64 (NEON SIMD)\n");
+#elif defined(__x86_64__)
+    fprintf(out, "  Architecture:        x86_64 (SSE4.2/AVX2 SIMD)\n");
+#else
+    fprintf(out, "  Architecture:        Generic\n");
+#endif
+
+    /* Summary statistics */
+    double total_sonicsv_time = 0, total_libcsv_time = 0;
+    double total_bytes = 0;
+    double min_speedup = 1e30, max_speedup = 0, sum_speedup = 0;
+    int sonicsv_wins = 0, libcsv_wins = 0, ties = 0;
+
+    for (size_t i = 0; i < num_results; i++) {
+        total_sonicsv_time += stats_mean(&results[i].sonicsv_times);
+        total_libcsv_time += stats_mean(&results[i].libcsv_times);
+        total_bytes += results[i].file_size;
+        sum_speedup += results[i].speedup;
+        if (results[i].speedup < min_speedup) min_speedup = results[i].speedup;
+        if (results[i].speedup > max_speedup) max_speedup = results[i].speedup;
+        if (results[i].speedup > 1.05) sonicsv_wins++;
+        else if (results[i].speedup < 0.95) libcsv_wins++;
+        else ties++;
+    }
+
+    double avg_sonicsv_throughput = (total_bytes / (1024.0 * 1024.0)) / total_sonicsv_time;
+    double avg_libcsv_throughput = (total_bytes / (1024.0 * 1024.0)) / total_libcsv_time;
+
+    fprintf(out, "\nOVERALL SUMMARY\n");
+    print_line(out, width);
+    fprintf(out, "  SonicSV victories:   %d / %zu tests (>5%% faster)\n", sonicsv_wins, num_results);
+    fprintf(out, "  libcsv victories:    %d / %zu tests (>5%% faster)\n", libcsv_wins, num_results);
+    fprintf(out, "  Ties:                %d / %zu tests (within 5%%)\n", ties, num_results);
+    fprintf(out, "\n");
+    fprintf(out, "  Aggregate SonicSV:   %.1f MB/s (total: %.2f MB in %.3f s)\n",
+            avg_sonicsv_throughput, total_bytes / (1024.0 * 1024.0), total_sonicsv_time);
+    fprintf(out, "  Aggregate libcsv:    %.1f MB/s (total: %.2f MB in %.3f s)\n",
+            avg_libcsv_throughput, total_bytes / (1024.0 * 1024.0), total_libcsv_time);
+    fprintf(out, "  Aggregate speedup:   %.2fx\n", avg_sonicsv_throughput / avg_libcsv_throughput);
+    fprintf(out, "\n");
+    fprintf(out, "  Per-test speedup:\n");
+    fprintf(out, "    Average:           %.2fx\n", sum_speedup / num_results);
+    fprintf(out, "    Minimum:           %.2fx\n", min_speedup);
+    fprintf(out, "    Maximum:           %.2fx\n", max_speedup);
+
+    /* Detailed results table */
+    fprintf(out, "\nDETAILED RESULTS BY TEST\n");
+    print_separator(out, width);
+
+    fprintf(out, "\n%-18s %8s %10s %10s %8s %8s %6s\n",
+            "Test", "Size", "SonicSV", "libcsv", "Speedup", "Winner", "Valid");
+    fprintf(out, "%-18s %8s %10s %10s %8s %8s %6s\n",
+            "", "(MB)", "(MB/s)", "(MB/s)", "", "", "");
+    print_line(out, width);
+
+    for (size_t i = 0; i < num_results; i++) {
+        test_result_t *r = &results[i];
+        double size_mb = r->file_size / (1024.0 * 1024.0);
+        const char *winner = r->speedup > 1.05 ? "SonicSV" :
+                            (r->speedup < 0.95 ? "libcsv" : "-");
+        /* Validate based on row counts - more reliable than byte-level checksums */
+        bool counts_match = counts_match_expected(r, r->sonicsv_rows, r->sonicsv_fields) &&
+                           counts_match_expected(r, r->libcsv_rows, r->libcsv_fields);
+        const char *valid = counts_match ? "yes" : "FAIL";
+
+        fprintf(out, "%-18s %8.2f %10.1f %10.1f %7.2fx %8s %6s\n",
+                r->test_name, size_mb, r->sonicsv_throughput, r->libcsv_throughput,
+                r->speedup, winner, valid);
+    }
+
+    print_line(out, width);
+
+    /* Timing variance details */
+    fprintf(out, "\nTIMING VARIANCE (seconds, lower is better)\n");
+    print_line(out, width);
+
+    fprintf(out, "\n%-18s %10s %10s %10s %10s\n",
+            "Test", "SonicSV", "(stddev)", "libcsv", "(stddev)");
+    print_line(out, width);
+
+    for (size_t i = 0; i < num_results; i++) {
+        test_result_t *r = &results[i];
+        fprintf(out, "%-18s %10.4f %10.4f %10.4f %10.4f\n",
+                r->test_name,
+                stats_mean(&r->sonicsv_times),
+                stats_stddev(&r->sonicsv_times),
+                stats_mean(&r->libcsv_times),
+                stats_stddev(&r->libcsv_times));
+    }
+
+    print_separator(out, width);
+    fprintf(out, "End of benchmark report.\n\n");
+}
+
+/*
+ * Adversarial summary - each worst-case input is compared with the same
+ * parser's mean throughput over the regular (SHAPE_TABLE) tests, so the
+ * factor shows how much a parser degrades rather than how fast it is.
+ */
+static const char *parser_status(const test_result_t *r, bool failed, bool skipped,
+                                 bool unsupported, uint64_t rows, uint64_t fields) {
+    if (unsupported) return "unsupported";
+    if (skipped) return "skipped";
+    if (failed) return "error";
+    if (!counts_match_expected(r, rows, fields)) return "miscount";
+    return "ok";
+}
+
+static void print_adversarial_summary(FILE *out, const test_result_t *results, size_t num_results) {
+    double sonicsv_sum = 0, libcsv_sum = 0;
+    size_t sonicsv_n = 0, libcsv_n = 0;
+    bool any_adversarial = false;
+
+    for (size_t i = 0; i < num_results; i++) {
+        if (test_configs[i].shape != SHAPE_TABLE) {
+            any_adversarial = true;
+            continue;
+        }
+        if (results[i].sonicsv_throughput > 0) {
+            sonicsv_sum += results[i].sonicsv_throughput;
+            sonicsv_n++;
+        }
+        if (results[i].libcsv_throughput > 0) {
+            libcsv_sum += results[i].libcsv_throughput;
+            libcsv_n++;
+        }
+    }
+    if (!any_adversarial) return;
+
+    double sonicsv_avg = sonicsv_n ? sonicsv_sum / sonicsv_n : 0;
+    double libcsv_avg = libcsv_n ? libcsv_sum / libcsv_n : 0;
+
+    fprintf(out, "\nADVERSARIAL INPUTS (slowdown vs. the parser's average on regular tests)\n");
+    fprintf(out, "%-23s %10s %-9s %10s %s\n", "Test", "SonicSV", "Status", "libcsv", "Status");
+    fprintf(out, "----------------------- ---------- --------- ---------- ---------\n");
+
+    for (size_t i = 0; i < num_results; i++) {
+        const test_result_t *r = &results[i];
+        if (test_configs[i].shape == SHAPE_TABLE || r->file_size == 0) continue;
+
+        char sonicsv_factor[16] = "-", libcsv_factor[16] = "-";
+        if (r->sonicsv_throughput > 0 && sonicsv_avg > 0) {
+            snprintf(sonicsv_factor, sizeof(sonicsv_factor), "%.2fx", sonicsv_avg / r->sonicsv_throughput);
+        }
+        if (r->libcsv_throughput > 0 && libcsv_avg > 0) {
+            snprintf(libcsv_factor, sizeof(libcsv_factor), "%.2fx", libcsv_avg / r->libcsv_throughput);
+        }
+
+        fprintf(out, "%-23s %10s %-9s %10s %s\n", r->test_name,
+                sonicsv_factor, parser_status(r, r->sonicsv_failed, r->sonicsv_skipped,
+                              r->sonicsv_unsupported, r->sonicsv_rows, r->sonicsv_fields),
+                libcsv_factor, parser_status(r, r->libcsv_failed, r->libcsv_skipped,
+                              r->libcsv_unsupported, r->libcsv_rows, r->libcsv_fields));
+    }
+}
+
+/*
+ * Scenario notes - each annotated test with its note and, where it
+ * declares counts, whether the generator and both parsers produced them.
+ */
+static void print_scenario_notes(FILE *out, const test_result_t *results, size_t num_results) {
+    bool any = false;
+    for (size_t i = 0; i < num_results; i++) {
+        const test_config_t *config = &test_configs[i];
+        const test_result_t *r = &results[i];
+        if (r->file_size == 0 || (!config->note && config->expect_rows == 0)) continue;
+        if (!any) {
+            fprintf(out, "\nSCENARIO NOTES (declared rows / fields, header included)\n");
+            fprintf(out, "%-23s %-21s %-18s %s\n", "Test", "Declared", "Check", "Note");
+            fprintf(out, "----------------------- --------------------- ------------------ ----\n");
+            any = true;
+        }
+
+        char declared[32] = "-", check[32] = "-";
+        if (config->expect_rows > 0) {
+            snprintf(declared, sizeof(declared), "%zu / %zu", config->expect_rows, config->expect_fields);
+        }
+        if (r->declared_checked) {
+            bool s_ran = !r->sonicsv_failed && !r->sonicsv_skipped && !r->sonicsv_unsupported;
+            bool l_ran = !r->libcsv_failed && !r->libcsv_skipped && !r->libcsv_unsupported;
+            bool s_bad = s_ran && !counts_match_expected(r, r->sonicsv_rows, r->sonicsv_fields);
+            bool l_bad = l_ran && !counts_match_expected(r, r->libcsv_rows, r->libcsv_fields);
+            snprintf(check, sizeof(check), "%s", r->generator_drift ? "GENERATOR"
+                     : s_bad && l_bad ? "MISMATCH (both)" : s_bad ? "MISMATCH (SonicSV)"
+                     : l_bad ? "MISMATCH (libcsv)" : "ok");
+        } else if (config->expect_rows > 0) {
+            snprintf(check, sizeof(check), "not at --size");
+        }
+        fprintf(out, "%-23s %-21s %-18s %s\n", r->test_name, declared, check,
+                config->note ? config->note : "");
+    }
+}
+
+/*
+ * Reliability - newlines inside quoted fields are where a parser that
+ * splits on line breaks first goes wrong, so every such test's row count
+ * is checked against the generator's on its own, and a parser that
+ * miscounts any is named here however fast it was.
+ */
+static void leak_column(char *buf, size_t size, bool ran, uint64_t leaked) {
+#ifdef BENCH_ASAN
+    if (ran) {
+        snprintf(buf, size, "%llu", (unsigned long long)leaked);
+        return;
+    }
+#else
+    (void)ran; (void)leaked;
+#endif
+    snprintf(buf, size, "-");
+}
+
+#define RSS_GROWTH_LISTED 3  /* growing tests named per parser; the rest are counted */
+
+static void print_reliability_summary(FILE *out, const test_result_t *results, size_t num_results) {
+    size_t checked = 0, sonicsv_bad = 0, libcsv_bad = 0;
+    size_t sonicsv_leaky = 0, libcsv_leaky = 0;
+#ifdef BENCH_ASAN
+    const bool every_test = true;  /* leaks matter on every file */
+    fprintf(out, "\nRELIABILITY (row counts, and bytes leaked per parse, ASan build)\n");
+#else
+    const bool every_test = false;
+    fprintf(out, "\nRELIABILITY (row counts on files with newlines in quoted fields;\n"
+                 "leaks are measured by ASan builds, see make benchmark-asan)\n");
+#endif
+    fprintf(out, "%-23s %10s %10s %-9s %8s %10s %-9s %s\n", "Test", "Expected",
+            "SonicSV", "Status", "Leaks", "libcsv", "Status", "Leaks");
+    fprintf(out, "----------------------- ---------- ---------- --------- -------- ---------- --------- --------\n");
+
+    for (size_t i = 0; i < num_results; i++) {
+        const test_result_t *r = &results[i];
+        const test_config_t *config = &test_configs[i];
+        if (r->file_size == 0) continue;
+        if (!every_test && (!config->has_quotes || !config->has_newlines_in_fields)) continue;
+        checked++;
+
+        bool s_ran = !r->sonicsv_failed && !r->sonicsv_skipped && !r->sonicsv_unsupported;
+        bool l_ran = !r->libcsv_failed && !r->libcsv_skipped && !r->libcsv_unsupported;
+        bool s_ok = !s_ran || r->sonicsv_rows == r->expected_rows;
+        bool l_ok = !l_ran || r->libcsv_rows == r->expected_rows;
+        sonicsv_bad += !s_ok;
+        libcsv_bad += !l_ok;
+        sonicsv_leaky += r->sonicsv_leaked > 0;
+        libcsv_leaky += r->libcsv_leaked > 0;
+
+        char s_leak[24], l_leak[24];
+        leak_column(s_leak, sizeof(s_leak), s_ran, r->sonicsv_leaked);
+        leak_column(l_leak, sizeof(l_leak), l_ran, r->libcsv_leaked);
+        fprintf(out, "%-23s %10zu %10llu %-9s %8s %10llu %-9s %8s\n", r->test_name, r->expected_rows,
+                (unsigned long long)r->sonicsv_rows, !s_ran ? "not run" : s_ok ? "ok" : "MISCOUNT",
+                s_leak,
+                (unsigned long long)r->libcsv_rows, !l_ran ? "not run" : l_ok ? "ok" : "MISCOUNT",
+                l_leak);
+    }
+
+    fprintf(out, "\nRSS growth within each test (RSS rising after every sample but the first):\n");
+    for (size_t p = 0; p < NUM_PARSERS; p++) {
+        size_t growing = 0;
+        fprintf(out, "  %-10s", parser_caps[p].name);
+        for (size_t i = 0; i < num_results; i++) {
+            const rss_trend_t *t = p == 0 ? &results[i].sonicsv_rss_trend : &results[i].libcsv_rss_trend;
+            if (results[i].file_size == 0 || !rss_trend_leaking(t)) continue;
+            if (growing++ < RSS_GROWTH_LISTED) {
+                fprintf(out, "%s %s %+.1f KiB/1k parses", growing > 1 ? "," : "",
+                        results[i].test_name, rss_trend_slope(t) * 1000 / 1024);
+            }
+        }
+        if (growing > RSS_GROWTH_LISTED) fprintf(out, " and %zu more", growing - RSS_GROWTH_LISTED);
+        fprintf(out, "%s\n", growing ? " - probable leak" : " none");
+    }
+
+    if (sonicsv_leaky > 0 || libcsv_leaky > 0) {
+        fprintf(out, "\nLeaking parsers:%s%s - LSan's report at exit has the allocation stacks.\n",
+                sonicsv_leaky ? " SonicSV" : "", libcsv_leaky ? " libcsv" : "");
+    }
+    if (checked == 0) {
+        fprintf(out, "(no test with quoted newlines ran)\n");
+    } else if (sonicsv_bad == 0 && libcsv_bad == 0) {
+        fprintf(out, "\nBoth parsers counted every row correctly.\n");
+    } else {
+        fprintf(out, "\nMiscounting parsers:%s%s - their results on these files are not comparable.\n",
+                sonicsv_bad ? " SonicSV" : "", libcsv_bad ? " libcsv" : "");
+    }
+}
+
+/*
+ * Stability - coefficient of variation and max/min ratio of each parser's
+ * timings per test. A fast mean with a wide spread is a poor fit for
+ * latency-sensitive services, so erratic results are called out.
+ */
+static double stats_cv_percent(const timing_stats_t *s) {
+    double mean = stats_mean(s);
+    return mean > 0 ? 100.0 * stats_stddev(s) / mean : 0;
+}
+
+static double stats_spread(const timing_stats_t *s) {
+    return s->count > 0 && s->min > 0 ? (double)s->max / (double)s->min : 0;
+}
+
+static void print_stability_summary(FILE *out, const test_result_t *results, size_t num_results,
+                                    int iterations) {
+    if (iterations < 2) return;
+
+    size_t sonicsv_erratic = 0, libcsv_erratic = 0;
+
+    fprintf(out, "\nSTABILITY (CV%% of timings, max/min ratio; CV above %.0f%% marked *)\n",
+            STABILITY_CV_MAX);
+    fprintf(out, "%-23s %8s %8s %8s %8s\n", "Test", "SonicSV", "max/min", "libcsv", "max/min");
+    fprintf(out, "----------------------- -------- -------- -------- --------\n");
+
+    for (size_t i = 0; i < num_results; i++) {
+        const test_result_t *r = &results[i];
+        if (r->file_size == 0) continue;
+
+        double s_cv = stats_cv_percent(&r->sonicsv_times);
+        double l_cv = stats_cv_percent(&r->libcsv_times);
+        bool s_bad = s_cv > STABILITY_CV_MAX, l_bad = l_cv > STABILITY_CV_MAX;
+        sonicsv_erratic += s_bad;
+        libcsv_erratic += l_bad;
+
+        fprintf(out, "%-23s %7.1f%c %7.2fx %7.1f%c %7.2fx\n", r->test_name,
+                s_cv, s_bad ? '*' : ' ', stats_spread(&r->sonicsv_times),
+                l_cv, l_bad ? '*' : ' ', stats_spread(&r->libcsv_times));
+    }
+
+    fprintf(out, "\nErratic results: SonicSV %zu, libcsv %zu of %zu tests\n",
+            sonicsv_erratic, libcsv_erratic, num_results);
+}
+
+static void print_usage_summary(FILE *out, const test_result_t *results, size_t num_results) {
+    fprintf(out, "\nRESOURCE USAGE (timed samples incl. file I/O; cpu = cpu time / wall time,\n"
+                 "csw = voluntary/involuntary context switches, flt = major/minor page faults,\n"
+                 "rss = peak resident MiB after a sample, '-' where the platform doesn't report it)\n");
+    fprintf(out, "%-23s %35s   %35s\n", "", "SonicSV", "libcsv");
+    fprintf(out, "%-23s %5s %11s %11s %5s   %5s %11s %11s %5s\n",
+            "Test", "cpu", "csw", "flt", "rss", "cpu", "csw", "flt", "rss");
+    fprintf(out, "----------------------- ----- ----------- ----------- -----"
+                 "   ----- ----------- ----------- -----\n");
+
+    for (size_t i = 0; i < num_results; i++) {
+        const test_result_t *r = &results[i];
+        if (r->file_size == 0) continue;
+
+        char cells[6][24];
+        snprintf(cells[0], sizeof(cells[0]), "%ld/%ld", r->sonicsv_usage.vol_switches,
+                 r->sonicsv_usage.invol_switches);
+        snprintf(cells[1], sizeof(cells[1]), "%ld/%ld", r->sonicsv_usage.major_faults,
+                 r->sonicsv_usage.minor_faults);
+        snprintf(cells[2], sizeof(cells[2]), "%ld/%ld", r->libcsv_usage.vol_switches,
+                 r->libcsv_usage.invol_switches);
+        snprintf(cells[3], sizeof(cells[3]), "%ld/%ld", r->libcsv_usage.major_faults,
+                 r->libcsv_usage.minor_faults);
+        const usage_totals_t *u[2] = {&r->sonicsv_usage, &r->libcsv_usage};
+        for (int k = 0; k < 2; k++) {
+            if (u[k]->peak_rss > 0) {
+                snprintf(cells[4 + k], sizeof(cells[4 + k]), "%.0f", u[k]->peak_rss / (1024.0 * 1024.0));
+            } else {
+                snprintf(cells[4 + k], sizeof(cells[4 + k]), "-");
+            }
+        }
+        fprintf(out, "%-23s %4.0f%% %11s %11s %5s   %4.0f%% %11s %11s %5s\n", r->test_name,
+                usage_cpu_percent(&r->sonicsv_usage), cells[0], cells[1], cells[4],
+                usage_cpu_percent(&r->libcsv_usage), cells[2], cells[3], cells[5]);
+    }
+
+    /* Major faults mean pages came back from disk mid-sample: the page
+     * cache was squeezed, and those timings include paging */
+    size_t pressured = 0;
+    for (size_t i = 0; i < num_results; i++) {
+        const test_result_t *r = &results[i];
+        if (r->file_size == 0) continue;
+        if (r->sonicsv_usage.major_faults > 0 || r->libcsv_usage.major_faults > 0) {
+            fprintf(out, "%s%s", pressured++ == 0 ? "\nMemory pressure (major faults) during: " : ", ",
+                    r->test_name);
+        }
+    }
+    if (pressured > 0) {
+        fprintf(out, "\n%zu test(s) may be slowed by paging; rerun with more free memory "
+                     "or smaller --size to confirm\n", pressured);
+    }
+}
+
+/* Descriptors and mappings per parser; growth across samples is a leak */
+static void print_handle_summary(FILE *out, const test_result_t *results, size_t num_results) {
+    fprintf(out, "\nOPEN DESCRIPTORS AND MAPPINGS (most open after a timed sample, +growth\n"
+                 "over all samples; '-' where the platform doesn't report it)\n");
+    fprintf(out, "%-23s %-21s   %-21s\n", "", "SonicSV", "libcsv");
+    fprintf(out, "%-23s %10s %10s   %10s %10s\n", "Test", "fds", "maps", "fds", "maps");
+    fprintf(out, "----------------------- ---------- ----------   ---------- ----------\n");
+
+    size_t leaking = 0;
+    for (size_t i = 0; i < num_results; i++) {
+        const test_result_t *r = &results[i];
+        if (r->file_size == 0) continue;
+        const usage_totals_t *u[2] = {&r->sonicsv_usage, &r->libcsv_usage};
+        char cells[4][24];
+        for (int k = 0; k < 2; k++) {
+            if (u[k]->samples == 0 || u[k]->peak_fds < 0) snprintf(cells[2 * k], sizeof(cells[0]), "-");
+            else snprintf(cells[2 * k], sizeof(cells[0]), "%d%+d", u[k]->peak_fds, u[k]->fd_growth);
+            if (u[k]->samples == 0 || u[k]->peak_maps < 0) snprintf(cells[2 * k + 1], sizeof(cells[0]), "-");
+            else snprintf(cells[2 * k + 1], sizeof(cells[0]), "%d%+d", u[k]->peak_maps, u[k]->map_growth);
+            if (u[k]->samples > 0 && (u[k]->fd_growth > 0 || u[k]->map_growth > 0)) leaking++;
+        }
+        fprintf(out, "%-23s %10s %10s   %10s %10s\n", r->test_name, cells[0], cells[1], cells[2], cells[3]);
+    }
+
+    if (leaking == 0) {
+        fprintf(out, "\nNo parser left descriptors or mappings open across samples.\n");
+        return;
+    }
+    fprintf(out, "\nLeft open across samples:");
+    for (size_t i = 0; i < num_results; i++) {
+        const test_result_t *r = &results[i];
+        if (r->file_size == 0) continue;
+        if (r->sonicsv_usage.fd_growth > 0 || r->sonicsv_usage.map_growth > 0) {
+            fprintf(out, " %s (SonicSV)", r->test_name);
+        }
+        if (r->libcsv_usage.fd_growth > 0 || r->libcsv_usage.map_growth > 0) {
+            fprintf(out, " %s (libcsv)", r->test_name);
+        }
+    }
+    fprintf(out, "\n");
+}
+
+/*
+ * Overall score - MB/s alone ranks a parser that is fast but erratic or
+ * memory-hungry above one a service would rather run. Each criterion is
+ * scored 0-100 against the best parser on it, then combined with the
+ * --weights (default throughput 4, memory 2, stability 2, reliability 2):
+ *   throughput   mean MB/s over regular tests
+ *   memory       largest peak RSS of one parse in its own process
+ *                (parse_peak_rss) over all tests, lower is better
+ *   stability    mean coefficient of variation, lower is better
+ *   reliability  share of tests run with correct counts (absolute, not relative)
+ */
+static bool parse_weights(const char *arg, double *weights) {
+    double parsed[SCORE_CRITERIA] = {0};
+    char buf[128];
+    snprintf(buf, sizeof(buf), "%s", arg);
+    for (char *tok = strtok(buf, ","); tok; tok = strtok(NULL, ",")) {
+        char *eq = strchr(tok, '=');
+        if (!eq) return false;
+        *eq = '\0';
+        size_t c = 0;
+        while (c < SCORE_CRITERIA && strcmp(score_names[c], tok) != 0) c++;
+        char *end;
+        double w = strtod(eq + 1, &end);
+        if (c == SCORE_CRITERIA || *end != '\0' || w < 0) return false;
+        parsed[c] = w;
+    }
+    double total = 0;
+    for (size_t c = 0; c < SCORE_CRITERIA; c++) total += parsed[c];
+    if (total <= 0) return false;
+    memcpy(weights, parsed, sizeof(parsed));
+    return true;
+}
+
+static void print_score_summary(FILE *out, const test_result_t *results, size_t num_results,
+                                const double *weights) {
+    double raw[NUM_PARSERS][SCORE_CRITERIA] = {{0}};
+    bool any_ran[NUM_PARSERS] = {false};
+
+    for (size_t p = 0; p < NUM_PARSERS; p++) {
+        double mbs_sum = 0, cv_sum = 0;
+        size_t mbs_n = 0, cv_n = 0, ran = 0, correct = 0;
+        size_t peak_rss = 0;
+        for (size_t i = 0; i < num_results; i++) {
+            const test_result_t *r = &results[i];
+            if (r->file_size == 0) continue;
+            const bool sonicsv = p == 0;
+            bool skipped = sonicsv ? r->sonicsv_skipped || r->sonicsv_unsupported
+                                   : r->libcsv_skipped || r->libcsv_unsupported;
+            if (skipped) continue;
+            bool failed = sonicsv ? r->sonicsv_failed : r->libcsv_failed;
+            const timing_stats_t *times = sonicsv ? &r->sonicsv_times : &r->libcsv_times;
+            size_t peak = sonicsv ? r->sonicsv_peak_rss : r->libcsv_peak_rss;
+            double mbs = sonicsv ? r->sonicsv_throughput : r->libcsv_throughput;
+
+            ran++;
+            correct += !failed && counts_match_expected(r, sonicsv ? r->sonicsv_rows : r->libcsv_rows,
+                                                        sonicsv ? r->sonicsv_fields : r->libcsv_fields);
+            if (test_configs[i].shape == SHAPE_TABLE && mbs > 0) {
+                mbs_sum += mbs;
+                mbs_n++;
+            }
+            if (times->count > 1) {
+                cv_sum += stats_cv_percent(times);
+                cv_n++;
+            }
+            if (peak > peak_rss) peak_rss = peak;
+        }
+        any_ran[p] = ran > 0;
+        raw[p][SCORE_THROUGHPUT] = mbs_n ? mbs_sum / mbs_n : 0;
+        raw[p][SCORE_MEMORY] = (double)peak_rss;
+        raw[p][SCORE_STABILITY] = cv_n ? cv_sum / cv_n : 0;
+        raw[p][SCORE_RELIABILITY] = ran ? 100.0 * correct / ran : 0;
+    }
+
+    /* Best value per criterion among parsers that ran */
+    double best[SCORE_CRITERIA] = {0};
+    for (size_t p = 0; p < NUM_PARSERS; p++) {
+        if (!any_ran[p]) continue;
+        for (size_t c = 0; c < SCORE_CRITERIA; c++) {
+            bool lower_better = c == SCORE_MEMORY || c == SCORE_STABILITY;
+            if (best[c] == 0 || (lower_better ? raw[p][c] < best[c] : raw[p][c] > best[c])) {
+                best[c] = raw[p][c];
+            }
+        }
+    }
+
+    double total_weight = 0;
+    for (size_t c = 0; c < SCORE_CRITERIA; c++) total_weight += weights[c];
+
+    double score[NUM_PARSERS][SCORE_CRITERIA + 1] = {{0}};
+    size_t order[NUM_PARSERS];
+    for (size_t p = 0; p < NUM_PARSERS; p++) {
+        order[p] = p;
+        if (!any_ran[p]) continue;
+        double overall = 0;
+        for (size_t c = 0; c < SCORE_CRITERIA; c++) {
+            double v = raw[p][c];
+            double sc;
+            if (c == SCORE_RELIABILITY) sc = v;
+            else if (c == SCORE_THROUGHPUT) sc = best[c] > 0 ? 100.0 * v / best[c] : 0;
+            else sc = v > 0 ? 100.0 * best[c] / v : 100.0;  /* nothing measured counts as best */
+            score[p][c] = sc;
+            overall += weights[c] * sc;
+        }
+        score[p][SCORE_CRITERIA] = total_weight > 0 ? overall / total_weight : 0;
+    }
+    for (size_t a = 1; a < NUM_PARSERS; a++) {
+        for (size_t b = a; b > 0 && score[order[b]][SCORE_CRITERIA] > score[order[b - 1]][SCORE_CRITERIA]; b--) {
+            size_t t = order[b];
+            order[b] = order[b - 1];
+            order[b - 1] = t;
+        }
+    }
+
+    fprintf(out, "\nOVERALL SCORE (0-100 per criterion vs. the best parser; weights");
+    for (size_t c = 0; c < SCORE_CRITERIA; c++) {
+        fprintf(out, "%s %s %g", c ? "," : "", score_names[c], weights[c]);
+    }
+    fprintf(out, ")\n");
+    fprintf(out, "%-4s %-10s %10s %10s %10s %11s %8s\n", "Rank", "Parser",
+            "throughput", "memory", "stability", "reliability", "score");
+    fprintf(out, "---- ---------- ---------- ---------- ---------- ----------- --------\n");
+    for (size_t k = 0; k < NUM_PARSERS; k++) {
+        size_t p = order[k];
+        if (!any_ran[p]) {
+            fprintf(out, "%-4s %-10s %10s\n", "-", parser_caps[p].name, "not run");
+            continue;
+        }
+        fprintf(out, "%-4zu %-10s %10.1f %10.1f %10.1f %11.1f %8.1f\n", k + 1, parser_caps[p].name,
+                score[p][SCORE_THROUGHPUT], score[p][SCORE_MEMORY], score[p][SCORE_STABILITY],
+                score[p][SCORE_RELIABILITY], score[p][SCORE_CRITERIA]);
+    }
+}
+
+/*
+ * Pareto front - per test, a parser is dominated when another is at
+ * least as fast with no larger peak RSS (parse_peak_rss), and strictly
+ * better on one of them; nobody should pick it there. With --pareto-data
+ * the points go to a file for plotting, e.g. in gnuplot:
+ *   plot "pareto.dat" using 4:3:(stringcolumn(5) eq "front" ? 7 : 6) with points pt variable
+ */
+static bool pareto_point(const test_result_t *r, size_t p, double *mbs, double *rss_mib) {
+    const bool sonicsv = p == 0;
+    bool ran = sonicsv ? !r->sonicsv_failed && !r->sonicsv_skipped && !r->sonicsv_unsupported
+                       : !r->libcsv_failed && !r->libcsv_skipped && !r->libcsv_unsupported;
+    size_t peak = sonicsv ? r->sonicsv_peak_rss : r->libcsv_peak_rss;
+    *mbs = sonicsv ? r->sonicsv_throughput : r->libcsv_throughput;
+    *rss_mib = peak / (1024.0 * 1024.0);
+    return ran && *mbs > 0 && peak > 0;
+}
+
+static void print_pareto_summary(FILE *out, const test_result_t *results, size_t num_results,
+                                 const char *data_path) {
+    FILE *data = NULL;
+    if (data_path) {
+        data = fopen(data_path, "w");
+        if (!data) {
+            fprintf(stderr, "Warning: cannot write %s: %s\n", data_path, strerror(errno));
+        } else {
+            fprintf(data, "# test parser mb_per_s peak_rss_mib front|dominated\n");
+        }
+    }
+
+    fprintf(out, "\nPARETO FRONT (MB/s vs. peak RSS of one parse in its own process; dominated =\n"
+                 "another parser is as fast with no more memory and better on one)\n");
+    fprintf(out, "%-23s %-20s %s\n", "Test", "Front", "Dominated");
+    fprintf(out, "----------------------- -------------------- --------------------\n");
+
+    size_t dominated_count[NUM_PARSERS] = {0};
+    size_t compared = 0;
+    for (size_t i = 0; i < num_results; i++) {
+        const test_result_t *r = &results[i];
+        if (r->file_size == 0) continue;
+        double mbs[NUM_PARSERS], rss[NUM_PARSERS];
+        bool has[NUM_PARSERS];
+        size_t points = 0;
+        for (size_t p = 0; p < NUM_PARSERS; p++) {
+            has[p] = pareto_point(r, p, &mbs[p], &rss[p]);
+            points += has[p];
+        }
+        if (points == 0) continue;
+        compared++;
+
+        char front[64] = "", dominated[64] = "";
+        for (size_t p = 0; p < NUM_PARSERS; p++) {
+            if (!has[p]) continue;
+            bool is_dominated = false;
+            for (size_t q = 0; q < NUM_PARSERS && !is_dominated; q++) {
+                is_dominated = q != p && has[q] && mbs[q] >= mbs[p] && rss[q] <= rss[p] &&
+                               (mbs[q] > mbs[p] || rss[q] < rss[p]);
+            }
+            char *list = is_dominated ? dominated : front;
+            size_t len = strlen(list);
+            snprintf(list + len, 64 - len, "%s%s", len ? ", " : "", parser_caps[p].name);
+            dominated_count[p] += is_dominated;
+            if (data) {
+                fprintf(data, "%s %s %.1f %.1f %s\n", r->test_name, parser_caps[p].name, mbs[p], rss[p],
+                        is_dominated ? "dominated" : "front");
+            }
+        }
+        fprintf(out, "%-23s %-20s %s\n", r->test_name, front, dominated[0] ? dominated : "-");
+    }
+
+    if (compared > 0) {
+        fprintf(out, "\nDominated on:");
+        for (size_t p = 0; p < NUM_PARSERS; p++) {
+            fprintf(out, "%s %s %zu of %zu tests", p ? "," : "", parser_caps[p].name,
+                    dominated_count[p], compared);
+        }
+        fprintf(out, "\n");
+    } else {
+        fprintf(out, "(no test with both throughput and RSS; RSS needs Linux or macOS)\n");
+    }
+    if (data) {
+        fclose(data);
+        fprintf(stderr, "Pareto points written to: %s\n", data_path);
+    }
+}
+
+/*
+ * Energy efficiency - MB per joule per parser (10^6-byte MB/s over the
+ * package's average watts during its samples), ranked by the mean over
+ * tests. Like benchstat's MB/J, it ignores --units.
+ * RAPL counts the whole package, so other load on the machine is charged
+ * to whichever parser was running. Omitted without RAPL readings.
+ */
+static void print_energy_summary(FILE *out, const test_result_t *results, size_t num_results) {
+    double sum[NUM_PARSERS] = {0};
+    size_t n[NUM_PARSERS] = {0};
+    for (size_t i = 0; i < num_results; i++) {
+        const test_result_t *r = &results[i];
+        if (r->file_size == 0) continue;
+        double v[NUM_PARSERS] = {
+            usage_mb_per_joule(&r->sonicsv_usage, r->file_size, stats_mean(&r->sonicsv_times)),
+            usage_mb_per_joule(&r->libcsv_usage, r->file_size, stats_mean(&r->libcsv_times)),
+        };
+        for (size_t p = 0; p < NUM_PARSERS; p++) {
+            if (v[p] <= 0) continue;
+            sum[p] += v[p];
+            n[p]++;
+        }
+    }
+    if (n[0] == 0 && n[1] == 0) return;
+
+    size_t order[NUM_PARSERS];
+    double mean[NUM_PARSERS];
+    for (size_t p = 0; p < NUM_PARSERS; p++) {
+        order[p] = p;
+        mean[p] = n[p] ? sum[p] / n[p] : 0;
+    }
+    for (size_t a = 1; a < NUM_PARSERS; a++) {
+        for (size_t b = a; b > 0 && mean[order[b]] > mean[order[b - 1]]; b--) {
+            size_t t = order[b];
+            order[b] = order[b - 1];
+            order[b - 1] = t;
+        }
+    }
+
+    fprintf(out, "\nENERGY EFFICIENCY (RAPL package energy; mean MB/J over tests, higher is better)\n");
+    fprintf(out, "%-4s %-10s %10s %6s\n", "Rank", "Parser", "MB/J", "tests");
+    fprintf(out, "---- ---------- ---------- ------\n");
+    for (size_t k = 0; k < NUM_PARSERS; k++) {
+        size_t p = order[k];
+        if (n[p] == 0) {
+            fprintf(out, "%-4s %-10s %10s\n", "-", parser_caps[p].name, "n/a");
+            continue;
+        }
+        fprintf(out, "%-4zu %-10s %10.1f %6zu\n", k + 1, parser_caps[p].name, mean[p], n[p]);
+    }
+}
+
+/*
+ * Baseline comparison - reads a benchstat file from an earlier run and
+ * reports per-test MB/s deltas. Numbers from another machine say nothing
+ * about a code change, so the fingerprint keys must match unless
+ * --force-compare is given.
+ */
+typedef struct {
+    char name[128];   /* "SonicSV/tiny_simple" */
+    double mbps_sum;
+    double ns_sum;
+    size_t count;
+} baseline_entry_t;
+
+typedef struct {
+    machine_info_t machine;
+    baseline_entry_t *entries;
+    size_t count;
+    size_t capacity;
+} baseline_t;
+
+static bool baseline_add(baseline_t *b, const char *name, double ns, double mbps) {
+    for (size_t i = 0; i < b->count; i++) {
+        if (strcmp(b->entries[i].name, name) == 0) {
+            b->entries[i].mbps_sum += mbps;
+            b->entries[i].ns_sum += ns;
+            b->entries[i].count++;
+            return true;
+        }
+    }
+    if (b->count == b->capacity) {
+        size_t cap = b->capacity ? b->capacity * 2 : 64;
+        baseline_entry_t *grown = realloc(b->entries, cap * sizeof(*grown));
+        if (!grown) return false;
+        b->entries = grown;
+        b->capacity = cap;
+    }
+    baseline_entry_t *e = &b->entries[b->count++];
+    snprintf(e->name, sizeof(e->name), "%s", name);
+    e->mbps_sum = mbps;
+    e->ns_sum = ns;
+    e->count = 1;
+    return true;
+}
+
+static void copy_value(char *dst, size_t size, const char *src) {
+    size_t len = strlen(src);
+    if (len >= size) len = size - 1;
+    memcpy(dst, src, len);
+    dst[len] = '\0';
+}
+
+static bool load_baseline(const char *path, baseline_t *b) {
+    memset(b, 0, sizeof(*b));
+    FILE *f = fopen(path, "r");
+    if (!f) {
+        fprintf(stderr, "Error: Cannot open baseline %s: %s\n", path, strerror(errno));
+        return false;
+    }
+
+    char line[512];
+    while (fgets(line, sizeof(line), f)) {
+        trim_newline(line);
+        char name[128];
+        double ns, mbps;
+        if (sscanf(line, "Benchmark%127s %*d %lf ns/op %lf MB/s", name, &ns, &mbps) == 3) {
+            if (!baseline_add(b, name, ns, mbps)) break;
+        } else if (strncmp(line, "cpu: ", 5) == 0) {
+            copy_value(b->machine.cpu, sizeof(b->machine.cpu), line + 5);
+        } else if (strncmp(line, "kernel: ", 8) == 0) {
+            copy_value(b->machine.kernel, sizeof(b->machine.kernel), line + 8);
+        } else if (strncmp(line, "memory: ", 8) == 0) {
+            copy_value(b->machine.memory, sizeof(b->machine.memory), line + 8);
+        } else if (strncmp(line, "governor: ", 10) == 0) {
+            copy_value(b->machine.governor, sizeof(b->machine.governor), line + 10);
+        } else if (strncmp(line, "turbo: ", 7) == 0) {
+            copy_value(b->machine.turbo, sizeof(b->machine.turbo), line + 7);
+        } else if (strncmp(line, "cores: ", 7) == 0) {
+            copy_value(b->machine.cores, sizeof(b->machine.cores), line + 7);
+        } else if (strncmp(line, "simd: ", 6) == 0) {
+            copy_value(b->machine.simd, sizeof(b->machine.simd), line + 6);
+        }
+    }
+    fclose(f);
+    return true;
+}
+
+static const baseline_entry_t *baseline_find(const baseline_t *b, const char *parser,
+                                             const char *test_name) {
+    char name[160];
+    snprintf(name, sizeof(name), "%s/%s", parser, test_name);
+    for (size_t i = 0; i < b->count; i++) {
+        if (strcmp(b->entries[i].name, name) == 0) return &b->entries[i];
+    }
+    return NULL;
+}
+
+static double baseline_mbps(const baseline_t *b, const char *parser, const char *test_name) {
+    const baseline_entry_t *e = baseline_find(b, parser, test_name);
+    return e ? e->mbps_sum / e->count : 0;
+}
+
+/* Mean seconds per timed sample, or 0 if the baseline has no such result */
+static double baseline_seconds(const baseline_t *b, const char *parser, const char *test_name) {
+    const baseline_entry_t *e = baseline_find(b, parser, test_name);
+    return e ? e->ns_sum / e->count / 1e9 : 0;
+}
+
+/* Lists fingerprint differences on stderr; returns true if any were found */
+static bool report_fingerprint_mismatch(const machine_info_t *old, const machine_info_t *cur) {
+    static const struct { const char *key; size_t offset; } keys[] = {
+        {"cpu",      offsetof(machine_info_t, cpu)},
+        {"kernel",   offsetof(machine_info_t, kernel)},
+        {"memory",   offsetof(machine_info_t, memory)},
+        {"governor", offsetof(machine_info_t, governor)},
+        {"turbo",    offsetof(machine_info_t, turbo)},
+        {"cores",    offsetof(machine_info_t, cores)},
+        {"simd",     offsetof(machine_info_t, simd)},
+    };
+    bool mismatch = false;
+    for (size_t i = 0; i < sizeof(keys) / sizeof(keys[0]); i++) {
+        const char *a = (const char *)old + keys[i].offset;
+        const char *b = (const char *)cur + keys[i].offset;
+        if (strcmp(a, b) != 0) {
+            if (!mismatch) {
+                fprintf(stderr, "\nWARNING: baseline was recorded on a different machine\n");
+            }
+            fprintf(stderr, "  %-9s baseline \"%s\", this run \"%s\"\n", keys[i].key, a, b);
+            mismatch = true;
+        }
+    }
+    return mismatch;
+}
+
+/* Go's MB/s (10^6 bytes), matching the benchstat lines the baseline holds */
+static double go_mbps(const timing_stats_t *times, size_t file_size) {
+    double mean = stats_mean(times);
+    return mean > 0 ? (file_size / 1e6) / mean : 0;
+}
+
+static bool glob_matches(const char *pattern, const char *text) {
+    if (!pattern) return true;
+    char p[128], t[128];
+    snprintf(p, sizeof(p), "%s", pattern);
+    snprintf(t, sizeof(t), "%s", text);
+    for (char *c = p; *c; c++) *c = (char)tolower((unsigned char)*c);
+    for (char *c = t; *c; c++) *c = (char)tolower((unsigned char)*c);
+    return fnmatch(p, t, 0) == 0;
+}
+
+/*
+ * Cross-architecture comparison - --cross-arch FILE sets this run beside
+ * a benchstat file from another architecture (typically an ARM/NEON run
+ * against the x86 history). Machine fingerprints are expected to differ
+ * and aren't checked. Raw MB/s mixes CPU and ISA, so each side's SonicSV
+ * over libcsv speedup is shown too: libcsv is scalar everywhere, which
+ * makes it a fair yardstick for how much SonicSV's SIMD paths deliver.
+ */
+static void print_cross_arch(FILE *out, const char *path, const machine_info_t *machine,
+                             const test_result_t *results, size_t num_results) {
+    baseline_t base;
+    if (!load_baseline(path, &base)) {
+        fprintf(stderr, "Warning: cannot read --cross-arch file %s\n", path);
+        return;
+    }
+
+    fprintf(out, "\nCROSS-ARCHITECTURE (MB/s, 10^6 bytes)\n");
+    fprintf(out, "  this run: %s, simd %s\n", machine->kernel, machine->simd);
+    fprintf(out, "  %-8s  %s, simd %s (%s)\n", "other:", base.machine.kernel,
+            base.machine.simd[0] ? base.machine.simd : "unknown", path);
+    fprintf(out, "%-23s %10s %10s %7s %9s %9s\n",
+            "Test", "SonicSV", "(other)", "ratio", "speedup", "(other)");
+    fprintf(out, "----------------------- ---------- ---------- ------- --------- ---------\n");
+
+    for (size_t i = 0; i < num_results; i++) {
+        const test_result_t *r = &results[i];
+        if (r->file_size == 0) continue;
+        double s_now = go_mbps(&r->sonicsv_times, r->file_size);
+        double l_now = go_mbps(&r->libcsv_times, r->file_size);
+        double s_old = baseline_mbps(&base, "SonicSV", r->test_name);
+        double l_old = baseline_mbps(&base, "Libcsv", r->test_name);
+        if (s_old == 0) continue;
+
+        fprintf(out, "%-23s %10.1f %10.1f %6.2fx %8.2fx %8.2fx\n", r->test_name,
+                s_now, s_old, s_now / s_old,
+                l_now > 0 ? s_now / l_now : 0, l_old > 0 ? s_old / l_old : 0);
+    }
+    free(base.entries);
+}
+
+/*
+ * Regression budgets - with --regression-budget FILE, --compare becomes a
+ * gate. Each line "GLOB PERCENT" lets SonicSV lose up to PERCENT of its
+ * baseline MB/s on tests matching GLOB; the first matching line wins,
+ * tests no line matches aren't gated, and # starts a comment:
+ *   adv_*   10
+ *   *        3
+ */
+#define REGRESSION_BUDGET_MAX_RULES 64
+
+static struct {
+    char glob[64];
+    double percent;
+} g_budget_rules[REGRESSION_BUDGET_MAX_RULES];
+static int g_num_budget_rules;
+
+static bool load_regression_budget(const char *path) {
+    FILE *f = fopen(path, "r");
+    if (!f) return false;
+    char line[256];
+    int line_no = 0;
+    bool ok = true;
+    while (ok && fgets(line, sizeof(line), f)) {
+        line_no++;
+        char *hash = strchr(line, '#');
+        if (hash) *hash = '\0';
+        char glob[64];
+        double percent;
+        int n = sscanf(line, "%63s %lf", glob, &percent);
+        if (n <= 0) continue;
+        if (n != 2 || percent < 0 || g_num_budget_rules == REGRESSION_BUDGET_MAX_RULES) {
+            fprintf(stderr, "Error: %s:%d: expected \"GLOB PERCENT\"\n", path, line_no);
+            ok = false;
+            break;
+        }
+        snprintf(g_budget_rules[g_num_budget_rules].glob, sizeof(g_budget_rules[0].glob), "%s", glob);
+        g_budget_rules[g_num_budget_rules++].percent = percent;
+    }
+    fclose(f);
+    return ok;
+}
+
+/* Allowed SonicSV slowdown in percent, or -1 if the test isn't gated */
+static double regression_budget(const char *test_name) {
+    for (int i = 0; i < g_num_budget_rules; i++) {
+        if (glob_matches(g_budget_rules[i].glob, test_name)) return g_budget_rules[i].percent;
+    }
+    return -1;
+}
+
+/*
+ * Colored comparison - on a terminal, --compare deltas are green when
+ * faster and red when slower than the baseline by more than the noise,
+ * and grey within it. Noise is COMPARE_NOISE_MIN or the run's own CV,
+ * whichever is larger: a 3% gain on a test whose timings spread by 5%
+ * says nothing. --color always forces escapes into files and pipes;
+ * auto leaves them out there and honours NO_COLOR and TERM=dumb.
+ */
+#define COMPARE_NOISE_MIN 2.0  /* percent */
+
+typedef enum { COLOR_AUTO, COLOR_ALWAYS, COLOR_NEVER } color_mode_t;
+
+static color_mode_t g_color = COLOR_AUTO;
+
+#define ANSI_GREEN "\033[32m"
+#define ANSI_RED   "\033[31m"
+#define ANSI_GREY  "\033[90m"
+#define ANSI_BOLD  "\033[1m"
+#define ANSI_RESET "\033[0m"
+
+static bool parse_color_mode(const char *text, color_mode_t *mode) {
+    if (strcmp(text, "auto") == 0) *mode = COLOR_AUTO;
+    else if (strcmp(text, "always") == 0) *mode = COLOR_ALWAYS;
+    else if (strcmp(text, "never") == 0) *mode = COLOR_NEVER;
+    else return false;
+    return true;
+}
+
+static bool use_color(FILE *out) {
+    if (g_color != COLOR_AUTO) return g_color == COLOR_ALWAYS;
+    const char *term = getenv("TERM");
+    return isatty(fileno(out)) && !getenv("NO_COLOR") && !(term && strcmp(term, "dumb") == 0);
+}
+
+/* Scenario families, in test_configs[] order, for grouping the comparison */
+static const char *scenario_family(const test_config_t *config) {
+    if (strncmp(config->name, "adv_", 4) == 0) return "adversarial";
+    if (config->schema) return "mixed-type columns";
+    if (config->length_dist != LEN_JITTER) return "variable field lengths";
+    if (config->delimiter != ',') return "alternate delimiters";
+    if (config->has_quotes) return "quoted fields";
+    return "plain fields";
+}
+
+/* One delta cell; old == 0 means the baseline has no such result */
+static void print_delta_cell(FILE *out, bool color, double now, double old, double noise) {
+    if (old <= 0) {
+        fprintf(out, " %8s", "-");
+        return;
+    }
+    double delta = 100.0 * (now / old - 1);
+    const char *code = delta > noise ? ANSI_GREEN : delta < -noise ? ANSI_RED : ANSI_GREY;
+    fprintf(out, " %s%+7.1f%%%s", color ? code : "", delta, color ? ANSI_RESET : "");
+}
+
+/* Returns how many tests exceeded their regression budget */
+static size_t print_baseline_comparison(FILE *out, const bench_options_t *opts,
+                                        const machine_info_t *machine,
+                                        const test_result_t *results, size_t num_results) {
+    baseline_t base;
+    size_t over_budget = 0;
+    if (!load_baseline(opts->baseline_path, &base)) return 0;
+
+    if (report_fingerprint_mismatch(&base.machine, machine) && !opts->force_compare) {
+        fprintf(stderr, "Refusing to compare across machines; pass --force-compare to override.\n");
+        free(base.entries);
+        return 0;
+    }
+
+    const bool color = use_color(out);
+    fprintf(out, "\nCOMPARISON WITH %s (MB/s, 10^6 bytes; + is faster)\n", opts->baseline_path);
+    fprintf(out, "%-23s %10s %10s %8s %10s %10s %8s\n",
+            "Test", "SonicSV", "(base)", "delta", "libcsv", "(base)", "delta");
+    fprintf(out, "----------------------- ---------- ---------- -------- ---------- ---------- --------\n");
+
+    /* Families print in the order they first appear, each with its tests */
+    bool printed[NUM_TESTS] = {false};
+    for (size_t first = 0; first < num_results; first++) {
+        if (printed[first]) continue;
+        const char *family = scenario_family(&test_configs[first]);
+        bool header = false;
+
+        for (size_t i = first; i < num_results; i++) {
+            const test_result_t *r = &results[i];
+            if (printed[i] || strcmp(scenario_family(&test_configs[i]), family) != 0) continue;
+            printed[i] = true;
+            if (r->file_size == 0) continue;
+
+            double s_now = go_mbps(&r->sonicsv_times, r->file_size);
+            double l_now = go_mbps(&r->libcsv_times, r->file_size);
+            double s_old = baseline_mbps(&base, "SonicSV", r->test_name);
+            double l_old = baseline_mbps(&base, "Libcsv", r->test_name);
+            if (s_old == 0 && l_old == 0) continue;
+
+            if (!header) {
+                fprintf(out, "%s%s%s\n", color ? ANSI_BOLD : "", family, color ? ANSI_RESET : "");
+                header = true;
+            }
+            fprintf(out, "  %-21s %10.1f %10.1f", r->test_name, s_now, s_old);
+            print_delta_cell(out, color, s_now, s_old,
+                             fmax(COMPARE_NOISE_MIN, stats_cv_percent(&r->sonicsv_times)));
+            fprintf(out, " %10.1f %10.1f", l_now, l_old);
+            print_delta_cell(out, color, l_now, l_old,
+                             fmax(COMPARE_NOISE_MIN, stats_cv_percent(&r->libcsv_times)));
+
+            double budget = regression_budget(r->test_name);
+            if (budget >= 0 && s_old > 0 && 100.0 * (s_now / s_old - 1) < -budget) {
+                fprintf(out, "  %sOVER BUDGET (-%.0f%%)%s", color ? ANSI_RED : "", budget,
+                        color ? ANSI_RESET : "");
+                over_budget++;
+            }
+            fprintf(out, "\n");
+        }
+    }
+    if (color) {
+        fprintf(out, "\n" ANSI_GREEN "faster" ANSI_RESET ", " ANSI_RED "slower" ANSI_RESET
+                     ", " ANSI_GREY "noise" ANSI_RESET " (within %.0f%% or the test's CV)\n",
+                COMPARE_NOISE_MIN);
+    }
+    if (g_num_budget_rules > 0) {
+        fprintf(out, "\nRegression budget: %zu test(s) over budget\n", over_budget);
+    }
+    free(base.entries);
+    return over_budget;
+}
+
+/* Parses PARSER>=N UNIT@GLOB (or <=) into a */
+static bool parse_assertion(const char *text, assertion_t *a) {
+    memset(a, 0, sizeof(*a));
+    a->text = text;
+    const char *op = strpbrk(text, "<>");
+    const char *at = strchr(text, '@');
+    if (!op || op[1] != '=' || !at || at < op || op == text ||
+        (size_t)(op - text) >= sizeof(a->parser) || strlen(at + 1) >= sizeof(a->test_glob)) {
+        return false;
+    }
+    memcpy(a->parser, text, (size_t)(op - text));
+    if (parser_capabilities(a->parser) == 0) return false;
+    a->at_least = op[0] == '>';
+    snprintf(a->test_glob, sizeof(a->test_glob), "%s", at + 1);
+
+    char *unit;
+    double value = strtod(op + 2, &unit);
+    size_t unit_len = (size_t)(at - unit);
+    static const struct { const char *name; double scale; } units[] = {
+        {"MB/s", 1e6}, {"MiB/s", 1024.0 * 1024.0}, {"GB/s", 1e9},
+    };
+    for (size_t i = 0; i < sizeof(units) / sizeof(units[0]); i++) {
+        if (strlen(units[i].name) == unit_len && strncasecmp(unit, units[i].name, unit_len) == 0) {
+            a->bytes_per_s = value * units[i].scale;
+            return value > 0;
+        }
+    }
+    return false;
+}
+
+/* Returns how many assertions failed */
+static size_t check_assertions(FILE *out, const bench_options_t *opts,
+                               const test_result_t *results, size_t num_results) {
+    size_t failed = 0;
+    fprintf(out, "\nASSERTIONS\n");
+    for (int i = 0; i < opts->num_assertions; i++) {
+        const assertion_t *a = &opts->assertions[i];
+        size_t matched = 0, violated = 0;
+        for (size_t t = 0; t < num_results; t++) {
+            const test_result_t *r = &results[t];
+            if (r->file_size == 0 || !glob_matches(a->test_glob, r->test_name)) continue;
+            bool sonicsv = strcasecmp(a->parser, "sonicsv") == 0;
+            const timing_stats_t *times = sonicsv ? &r->sonicsv_times : &r->libcsv_times;
+            double mean = stats_mean(times);
+            double rate = mean > 0 ? r->file_size / mean : 0;
+            bool ok = rate > 0 && (a->at_least ? rate >= a->bytes_per_s : rate <= a->bytes_per_s);
+            matched++;
+            if (!ok) {
+                fprintf(out, "  FAIL  %s: %s measured %.1f MB/s\n", a->text, r->test_name, rate / 1e6);
+                violated++;
+            }
+        }
+        if (matched == 0) {
+            fprintf(out, "  FAIL  %s: no test matches \"%s\"\n", a->text, a->test_glob);
+            violated++;
+        } else if (violated == 0) {
+            fprintf(out, "  ok    %s (%zu test%s)\n", a->text, matched, matched == 1 ? "" : "s");
+        }
+        failed += violated > 0;
+    }
+    return failed;
+}
+
+/*
+ * One parser's share of a test: optional sandbox and warmup, the timed
+ * iterations, and the quarantine bookkeeping around them. Results are
+ * written through the pointers so both parsers share this code.
+ */
+typedef struct {
+    const char *parser;   /* benchstat name: "SonicSV" or "Libcsv" */
+    bench_runner_t run;
+    int64_t overhead;     /* ns subtracted from every sample */
+    timing_stats_t *times;
+    timing_stats_t *read_times;  /* read share of each sample, where the runner splits it out */
+    bool *failed;
+    bool *skipped;
+    bool *unsupported;
+    usage_totals_t *usage;
+    rss_trend_t *rss_trend;
+    uint64_t *rows;
+    uint64_t *fields;
+} parser_run_t;
+
+/*
+ * Adds one sample to the stats and the benchstat output; NULL env_start
+ * omits env columns, read_ns 0 the read column and energy_j <= 0 MB/J.
+ */
+static void record_sample(const bench_options_t *opts, const test_config_t *config,
+                          const parser_run_t *p, size_t file_size, int64_t elapsed, uint64_t cpu_ns,
+                          uint64_t read_ns, double energy_j, const env_sample_t *env_start,
+                          const env_sample_t *env_end) {
+    if (elapsed > 0) elapsed = elapsed > p->overhead ? elapsed - p->overhead : 1;
+    if (elapsed < 0) {
+        *p->failed = true;
+    } else if (elapsed > 0) {
+        stats_add(p->times, (uint64_t)elapsed);
+        if (read_ns > 0) stats_add(p->read_times, read_ns);
+        if (opts->benchstat_out) {
+            print_benchstat_line(opts->benchstat_out, p->parser, config->name, file_size,
+                                 (uint64_t)elapsed, cpu_ns, read_ns, energy_j, env_start, env_end);
+        }
+    }
+}
+
+/*
+ * Striping - with --stripes K, files below REPEAT_MAX_FILE_SIZE are
+ * sampled by K threads at once, each on its own copy of the file and
+ * (on Linux) pinned to its own CPU, so K times the samples fit in the
+ * same wall time. A few serial samples are taken first; if the striped
+ * median is more than STRIPE_CONTENTION_MAX slower, the threads are
+ * disturbing each other (shared cache, memory bandwidth, SMT siblings),
+ * so the striped samples are dropped and the test runs serially.
+ */
+#define STRIPE_MAX            64
+#define STRIPE_CALIBRATION    3
+#define STRIPE_CONTENTION_MAX 0.10
+
+typedef struct {
+    const parser_run_t *p;
+    char path[320];
+    size_t file_size;
+    char delim;
+    int repeat;
+    int samples;
+    int cpu;              /* CPU to pin to, -1 = leave to the scheduler */
+    int64_t *wall_ns;
+    uint64_t *cpu_ns;
+    bench_state_t state;
+} stripe_t;
+
+static void *stripe_main(void *arg) {
+    stripe_t *s = (stripe_t *)arg;
+#ifdef __linux__
+    if (s->cpu >= 0) {
+        cpu_set_t set;
+        CPU_ZERO(&set);
+        CPU_SET(s->cpu, &set);
+        pthread_setaffinity_np(pthread_self(), sizeof(set), &set);
+    }
+#endif
+    for (int i = 0; i < s->samples; i++) {
+        struct timespec a, b;
+        clock_gettime(CLOCK_THREAD_CPUTIME_ID, &a);
+        s->wall_ns[i] = run_sample(s->p->run, s->path, s->file_size, s->delim, s->repeat, &s->state);
+        clock_gettime(CLOCK_THREAD_CPUTIME_ID, &b);
+        s->cpu_ns[i] = ((uint64_t)(b.tv_sec - a.tv_sec) * 1000000000ULL + b.tv_nsec - a.tv_nsec) /
+                       (uint64_t)s->repeat;
+    }
+    return NULL;
+}
+
+/* Fills cpus with the CPUs this process may run on; returns how many */
+static int stripe_cpus(int *cpus, int max) {
+    int n = 0;
+#ifdef __linux__
+    cpu_set_t allowed;
+    if (sched_getaffinity(0, sizeof(allowed), &allowed) == 0) {
+        for (int cpu = 0; cpu < CPU_SETSIZE && n < max; cpu++) {
+            if (CPU_ISSET(cpu, &allowed)) cpus[n++] = cpu;
+        }
+        return n;
+    }
+#endif
+    long online = sysconf(_SC_NPROCESSORS_ONLN);
+    for (; n < online && n < max; n++) cpus[n] = -1;
+    return n;
+}
+
+static int64_t median_ns(int64_t *samples, size_t n) {
+    qsort(samples, n, sizeof(samples[0]), compare_ns);
+    return samples[n / 2];
+}
+
+/* Returns true if striped samples were recorded, false to run serially instead */
+static bool run_striped(const bench_options_t *opts, const test_config_t *config,
+                        const parser_run_t *p, const char *input, size_t file_size, int repeat) {
+    int cpus[STRIPE_MAX];
+    int k = stripe_cpus(cpus, opts->stripes < STRIPE_MAX ? opts->stripes : STRIPE_MAX);
+    if (k < 2) return false;
+
+    bench_state_t state;
+    int64_t serial[STRIPE_CALIBRATION];
+    for (int i = 0; i < STRIPE_CALIBRATION; i++) {
+        serial[i] = run_sample(p->run, input, file_size, config->delimiter, repeat, &state);
+        if (serial[i] < 0) return false;
+    }
+    int64_t serial_median = median_ns(serial, STRIPE_CALIBRATION);
+
+    size_t total = (size_t)k * opts->iterations;
+    stripe_t stripes[STRIPE_MAX];
+    pthread_t threads[STRIPE_MAX];
+    int64_t *wall_ns = malloc(total * sizeof(*wall_ns));
+    uint64_t *cpu_ns = malloc(total * sizeof(*cpu_ns));
+    int copies = 0, started = 0;
+    bool ok = wall_ns && cpu_ns;
+
+    for (int s = 0; ok && s < k; s++) {
+        stripes[s] = (stripe_t){
+            .p = p, .file_size = file_size, .delim = config->delimiter, .repeat = repeat,
+            .samples = opts->iterations, .cpu = cpus[s],
+            .wall_ns = wall_ns + (size_t)s * opts->iterations,
+            .cpu_ns = cpu_ns + (size_t)s * opts->iterations,
+        };
+        snprintf(stripes[s].path, sizeof(stripes[s].path), "%s.stripe%d", input, s);
+        ok = copy_file(input, stripes[s].path);
+        if (ok) copies++;
+    }
+
+    usage_snapshot_t usage_start, usage_end;
+    usage_snapshot_start(&usage_start);
+    for (int s = 0; ok && s < k; s++) {
+        int err = pthread_create(&threads[s], NULL, stripe_main, &stripes[s]);
+        if (err != 0) {
+            /* pthread_create returns its error; errno is left alone */
+            fprintf(stderr, "     %-18s %s: cannot start stripe %d: %s; running serially\n",
+                    config->name, p->parser, s, strerror(err));
+            ok = false;
+            break;
+        }
+        started++;
+    }
+    for (int s = 0; s < started; s++) pthread_join(threads[s], NULL);
+    usage_snapshot_end(&usage_end);
+    for (int s = 0; s < copies; s++) unlink(stripes[s].path);
+
+    for (size_t i = 0; ok && i < total; i++) ok = wall_ns[i] >= 0;
+    if (ok) {
+        int64_t *sorted = malloc(total * sizeof(*sorted));
+        ok = sorted != NULL;
+        if (ok) {
+            memcpy(sorted, wall_ns, total * sizeof(*sorted));
+            int64_t striped_median = median_ns(sorted, total);
+            free(sorted);
+            if (striped_median > serial_median * (1 + STRIPE_CONTENTION_MAX)) {
+                fprintf(stderr, "     %-18s %s: %d stripes contend (median %.1f us vs %.1f us serial); "
+                                "running serially\n", config->name, p->parser, k,
+                        striped_median / 1e3, serial_median / 1e3);
+                ok = false;
+            }
+        }
+    }
+    if (ok) {
+        usage_add(p->usage, &usage_start, &usage_end);
+        for (size_t i = 0; i < total; i++) {
+            record_sample(opts, config, p, file_size, wall_ns[i], cpu_ns[i], 0, 0, NULL, NULL);
+        }
+        *p->rows = stripes[0].state.rows_parsed;
+        *p->fields = stripes[0].state.fields_parsed;
+    }
+    free(wall_ns);
+    free(cpu_ns);
+    return ok;
+}
+
+/*
+ * Reshuffling - one file has one branch pattern, and a parser can look
+ * faster or slower on it by accident. With --reshuffle every timed
+ * iteration parses the test's file regenerated with its own seed (same
+ * parameters), so the timings cover several contents. Seeds count down
+ * to GEN_SEED: the last iteration parses the original file, which keeps
+ * the row/field validation meaningful and leaves it in place for the
+ * next parser. Returns the regenerated size, 0 on failure.
+ */
+static size_t reshuffle_input(const bench_options_t *opts, const test_config_t *config,
+                              const char *filepath, int iteration) {
+    gen_counts_t counts;
+    g_gen_seed = GEN_SEED + (uint64_t)(opts->iterations - 1 - iteration);
+    size_t size = generate_test_file(config, filepath, opts->target_bytes, &counts);
+    g_gen_seed = GEN_SEED;
+    return size;
+}
+
+/* Returns false only if the sandbox could not be set up */
+static bool run_parser_phase(const bench_options_t *opts, const test_config_t *config,
+                             const parser_run_t *p, const char *filepath, size_t file_size,
+                             int repeat, bool warmup_here) {
+    unsigned missing = test_requirements(config) & ~parser_capabilities(p->parser);
+    if (missing) {
+        fprintf(stderr, "     %-18s %s unsupported (needs", config->name, p->parser);
+        for (size_t c = 0; c < sizeof(cap_labels) / sizeof(cap_labels[0]); c++) {
+            if (missing & cap_labels[c].cap) fprintf(stderr, " %s", cap_labels[c].label);
+        }
+        fprintf(stderr, ")\n");
+        *p->unsupported = true;
+        return true;
+    }
+    if (parser_excluded(p->parser) || !quarantine_admit(opts, p->parser, config->name)) {
+        *p->skipped = true;
+        return true;
+    }
+
+    sandbox_t sandbox;
+    const char *input = filepath;
+    if (opts->sandbox) {
+        input = sandbox_enter(&sandbox, config->name, p->parser, filepath);
+        if (!input) {
+            quarantine_finish(opts, p->parser, config->name, false);
+            return false;
+        }
+    }
+
+    bench_state_t state;
+    for (int w = 0; w < opts->warmup && warmup_here; w++) {
+        p->run(input, file_size, config->delimiter, &state);
+    }
+    if (opts->prefetch && !prefetch_file(input)) {
+        fprintf(stderr, "Warning: prefetch of %s failed: %s\n", input, strerror(errno));
+    }
+
+    /* Stripes parse copies made up front, so they can't follow a reshuffle */
+    bool striped = opts->stripes > 1 && file_size < REPEAT_MAX_FILE_SIZE && !opts->reshuffle &&
+                   run_striped(opts, config, p, input, file_size, repeat);
+    for (int i = 0; i < opts->iterations && !striped; i++) {
+        size_t sample_size = file_size;
+        if (opts->reshuffle && opts->iterations > 1) {
+            sample_size = reshuffle_input(opts, config, filepath, i);
+            if (sample_size == 0) {
+                *p->failed = true;
+                break;
+            }
+        }
+        env_sample_t env_start, env_end;
+        if (opts->sample_env) sample_env(&env_start);
+        usage_snapshot_t usage_start, usage_end;
+        usage_snapshot_start(&usage_start);
+        int64_t elapsed = run_sample(p->run, input, sample_size, config->delimiter, repeat, &state);
+        usage_snapshot_end(&usage_end);
+        usage_add(p->usage, &usage_start, &usage_end);
+        if (elapsed >= 0) rss_trend_add(p->rss_trend, (size_t)repeat, usage_start.rss, usage_end.rss);
+        if (opts->sample_env) sample_env(&env_end);
+        record_sample(opts, config, p, sample_size, elapsed,
+                      (usage_end.cpu_ns - usage_start.cpu_ns) / (uint64_t)repeat, state.read_ns,
+                      usage_energy_j(&usage_start, &usage_end) / repeat,
+                      opts->sample_env ? &env_start : NULL, &env_end);
+        if (i == opts->iterations - 1) {
+            *p->rows = state.rows_parsed;
+            *p->fields = state.fields_parsed;
+        }
+    }
+
+    if (opts->sandbox) sandbox_leave(&sandbox);
+    quarantine_finish(opts, p->parser, config->name, *p->failed);
+    return true;
+}
+
+/*
+ * Leak check - in an ASan build the allocator knows how many bytes are
+ * live, so a few parses bracketed by that count show what each parse
+ * leaves behind. LSan's report at exit has the stacks; this attributes
+ * the bytes to a parser and test. Returns 0 in other builds.
+ */
+#define LEAK_RUNS 3
+
+static uint64_t leaked_per_parse(bench_runner_t run, const char *filepath, size_t file_size,
+                                 char delim) {
+#ifdef BENCH_ASAN
+    bench_state_t state;
+    run(filepath, file_size, delim, &state);  /* lazy one-time allocations */
+    size_t before = __sanitizer_get_current_allocated_bytes();
+    for (int i = 0; i < LEAK_RUNS; i++) run(filepath, file_size, delim, &state);
+    size_t after = __sanitizer_get_current_allocated_bytes();
+    return after > before ? (after - before) / LEAK_RUNS : 0;
+#else
+    (void)run; (void)filepath; (void)file_size; (void)delim;
+    return 0;
+#endif
+}
+
+/*
+ * Peak memory - both parsers share the suite's process, and each has
+ * freed its buffers and unmapped the file by the time a sample ends, so
+ * the resident set read after a sample is the same few MiB for either.
+ * Instead one parse runs in a forked child, which starts with a fresh
+ * high-water mark, and reports its own ru_maxrss: the suite's baseline
+ * plus the most that parse had resident at once. Returns bytes, 0 if the
+ * parse failed or the platform doesn't tell.
+ */
+static size_t parse_peak_rss(bench_runner_t run, const char *filepath, size_t file_size, char delim) {
+    int fds[2];
+    if (pipe(fds) != 0) return 0;
+    fflush(NULL);
+    pid_t pid = fork();
+    if (pid < 0) {
+        close(fds[0]);
+        close(fds[1]);
+        return 0;
+    }
+    if (pid == 0) {
+        close(fds[0]);
+        bench_state_t state;
+        uint64_t peak = 0;
+        struct rusage ru;
+        if (run(filepath, file_size, delim, &state) >= 0 && getrusage(RUSAGE_SELF, &ru) == 0) {
+#ifdef __APPLE__
+            peak = (uint64_t)ru.ru_maxrss;          /* bytes */
+#else
+            peak = (uint64_t)ru.ru_maxrss * 1024;   /* KiB */
+#endif
+        }
+        ssize_t written = write(fds[1], &peak, sizeof(peak));
+        _exit(written != (ssize_t)sizeof(peak));
+    }
+    close(fds[1]);
+    uint64_t peak = 0;
+    if (read(fds[0], &peak, sizeof(peak)) != (ssize_t)sizeof(peak)) peak = 0;
+    close(fds[0]);
+    int status;
+    waitpid(pid, &status, 0);
+    return WIFEXITED(status) && WEXITSTATUS(status) == 0 ? (size_t)peak : 0;
+}
+
+/* Times every scan baseline on the test's file; failures just leave its stats empty */
+static void run_scan_baselines(const bench_options_t *opts, const test_config_t *config,
+                               test_result_t *result, const char *filepath, int repeat) {
+    bench_state_t state;
+    for (int b = 0; b < NUM_SCAN_BASELINES; b++) {
+        stats_init(&result->scan_times[b]);
+        for (int i = 0; i < opts->iterations; i++) {
+            usage_snapshot_t usage_start, usage_end;
+            usage_snapshot_start(&usage_start);
+            int64_t elapsed = run_sample(scan_baselines[b].run, filepath, result->file_size,
+                                         config->delimiter, repeat, &state);
+            usage_snapshot_end(&usage_end);
+            if (elapsed <= 0) continue;
+            stats_add(&result->scan_times[b], (uint64_t)elapsed);
+            if (opts->benchstat_out) {
+                print_benchstat_line(opts->benchstat_out, scan_baselines[b].name, config->name,
+                                     result->file_size, (uint64_t)elapsed,
+                                     (usage_end.cpu_ns - usage_start.cpu_ns) / (uint64_t)repeat,
+                                     0, usage_energy_j(&usage_start, &usage_end) / repeat,
+                                     NULL, NULL);
+            }
+        }
+    }
+}
+
+static void print_scan_baselines(FILE *out, const test_result_t *results, size_t num_results) {
+    fprintf(out, "\nSCAN BASELINES (the I/O ceiling; %% = parser throughput as a share of read)\n");
+    fprintf(out, "%-23s", "Test");
+    for (int b = 0; b < NUM_SCAN_BASELINES; b++) fprintf(out, " %12s", scan_baselines[b].name);
+    fprintf(out, " %8s %8s\n", "SonicSV", "libcsv");
+
+    for (size_t i = 0; i < num_results; i++) {
+        const test_result_t *r = &results[i];
+        if (r->file_size == 0) continue;
+        fprintf(out, "%-23s", r->test_name);
+        for (int b = 0; b < NUM_SCAN_BASELINES; b++) {
+            char cell[16] = "n/a";
+            double mean = stats_mean(&r->scan_times[b]);
+            if (mean > 0) format_rate(cell, sizeof(cell), r->file_size, mean);
+            fprintf(out, " %12s", cell);
+        }
+        double ceiling = stats_mean(&r->scan_times[SCAN_READ]);
+        double s_mean = stats_mean(&r->sonicsv_times), l_mean = stats_mean(&r->libcsv_times);
+        char s_cell[16] = "n/a", l_cell[16] = "n/a";
+        if (ceiling > 0 && s_mean > 0) snprintf(s_cell, sizeof(s_cell), "%.0f%%", 100.0 * ceiling / s_mean);
+        if (ceiling > 0 && l_mean > 0) snprintf(l_cell, sizeof(l_cell), "%.0f%%", 100.0 * ceiling / l_mean);
+        fprintf(out, " %8s %8s\n", s_cell, l_cell);
+    }
+}
+
+/*
+ * Read vs parse - where a runner reads through a buffer, the time inside
+ * its read calls is split out of each sample. At READ_BOUND_SHARE or more
+ * of the total the result says more about the storage than the parser.
+ * SonicSV maps the file, so its reads are page faults that can't be
+ * separated from parsing; the scan baselines above bound those instead.
+ */
+#define READ_BOUND_SHARE 0.5
+
+static void print_read_split(FILE *out, const test_result_t *results, size_t num_results) {
+    fprintf(out, "\nREAD VS PARSE (mean ms per parse; n/a = reads not separable from parsing)\n");
+    fprintf(out, "%-23s %-8s %10s %10s %7s  %s\n", "Test", "Parser", "read", "parse", "read %",
+            "bound by");
+
+    for (size_t i = 0; i < num_results; i++) {
+        const test_result_t *r = &results[i];
+        if (r->file_size == 0) continue;
+        const struct {
+            const char *name;
+            const timing_stats_t *times, *read_times;
+        } rows[] = {
+            {"SonicSV", &r->sonicsv_times, &r->sonicsv_read_times},
+            {"libcsv", &r->libcsv_times, &r->libcsv_read_times},
+        };
+        for (size_t p = 0; p < sizeof(rows) / sizeof(rows[0]); p++) {
+            double total = stats_mean(rows[p].times);
+            if (total <= 0) continue;
+            double read = stats_mean(rows[p].read_times);
+            if (read <= 0) {
+                fprintf(out, "%-23s %-8s %10s %10.3f %7s  %s\n", p == 0 ? r->test_name : "",
+                        rows[p].name, "n/a", total * 1e3, "n/a", "n/a");
+                continue;
+            }
+            double parse = total > read ? total - read : 0;
+            double share = read / total;
+            fprintf(out, "%-23s %-8s %10.3f %10.3f %6.0f%%  %s\n", p == 0 ? r->test_name : "",
+                    rows[p].name, read * 1e3, parse * 1e3, 100.0 * share,
+                    share >= READ_BOUND_SHARE ? "I/O" : "parser");
+        }
+    }
+}
+
+/*
+ * Time budget - with --time-budget, per-test parse times from a --history
+ * benchstat file decide how much of the suite fits. Each time is scaled
+ * from the file size the history ran at to this run's (--size). Coverage
+ * comes first: the cheapest tests are admitted at BUDGET_MIN_ITERATIONS
+ * until the budget is spent, then remaining time raises iterations
+ * round-robin up to --iterations. Generation, health checks and per-sample
+ * overhead aren't in the history, so the suite also keeps a running
+ * deadline: a test is only started while its estimate still fits in what
+ * is left of the budget (see budget_allows).
+ */
+#define BUDGET_MIN_ITERATIONS 3
+
+/* Parses "90", "90s", "30m" or "2h" into seconds; returns -1 if malformed */
+static double parse_duration(const char *text) {
+    char *end;
+    double value = strtod(text, &end);
+    if (end == text || value < 0) return -1;
+    if (*end == '\0' || strcmp(end, "s") == 0) return value;
+    if (strcmp(end, "m") == 0) return value * 60;
+    if (strcmp(end, "h") == 0) return value * 3600;
+    return -1;
+}
+
+/* Bytes test config c's file will roughly have in this run; 0 if unknown */
+static double planned_file_bytes(const bench_options_t *opts, const test_config_t *c) {
+    if (opts->target_bytes > 0) return (double)opts->target_bytes;
+    if (c->shape != SHAPE_TABLE) return 0;
+    return (double)c->rows * c->fields_per_row * (c->avg_field_size + 1);
+}
+
+/* File size a history entry was measured at: MB/s times seconds per parse */
+static double baseline_file_bytes(const baseline_t *b, const char *parser, const char *test_name) {
+    const baseline_entry_t *e = baseline_find(b, parser, test_name);
+    return e ? (e->mbps_sum / e->count) * (e->ns_sum / e->count) / 1e3 : 0;
+}
+
+/*
+ * Fills plan[t] with the iterations test t gets (0 means it is skipped)
+ * and estimate[t] with the seconds they should take, 0 if unknown
+ */
+static void plan_time_budget(const bench_options_t *opts, int *plan, double *estimate) {
+    for (size_t t = 0; t < NUM_TESTS; t++) {
+        plan[t] = opts->iterations;
+        estimate[t] = 0;
+    }
+    if (opts->time_budget <= 0) return;
+
+    baseline_t history;
+    if (!opts->history_path || !load_baseline(opts->history_path, &history)) {
+        fprintf(stderr, "Warning: --time-budget needs a readable --history file to plan; "
+                        "running tests until the budget is spent\n");
+        return;
+    }
+
+    /* Seconds per iteration (both parsers) at this run's size; unknown tests get the mean */
+    double cost[NUM_TESTS], known_sum = 0;
+    size_t known = 0;
+    for (size_t t = 0; t < NUM_TESTS; t++) {
+        double s = baseline_seconds(&history, "SonicSV", test_configs[t].name);
+        double l = baseline_seconds(&history, "Libcsv", test_configs[t].name);
+        cost[t] = s > 0 && l > 0 ? s + l : -1;
+        double was = baseline_file_bytes(&history, "SonicSV", test_configs[t].name);
+        double now = planned_file_bytes(opts, &test_configs[t]);
+        if (cost[t] > 0 && was > 0 && now > 0) cost[t] *= now / was;
+        if (cost[t] > 0) {
+            known_sum += cost[t];
+            known++;
+        }
+    }
+    free(history.entries);
+    if (known == 0) {
+        fprintf(stderr, "Warning: %s has no results for these tests; "
+                        "running tests until the budget is spent\n", opts->history_path);
+        return;
+    }
+    for (size_t t = 0; t < NUM_TESTS; t++) {
+        if (cost[t] < 0) cost[t] = known_sum / known;
+    }
+
+    size_t order[NUM_TESTS];
+    for (size_t t = 0; t < NUM_TESTS; t++) {
+        size_t j = t;
+        for (; j > 0 && cost[order[j - 1]] > cost[t]; j--) order[j] = order[j - 1];
+        order[j] = t;
+    }
+
+    const int min_iterations = opts->iterations < BUDGET_MIN_ITERATIONS
+                             ? opts->iterations : BUDGET_MIN_ITERATIONS;
+    double used = 0;
+    size_t admitted = 0;
+    for (size_t i = 0; i < NUM_TESTS; i++) {
+        size_t t = order[i];
+        double need = (opts->warmup + min_iterations) * cost[t];
+        if (used + need <= opts->time_budget) {
+            plan[t] = min_iterations;
+            used += need;
+            admitted++;
+        } else {
+            plan[t] = 0;
+        }
+    }
+    for (bool grew = true; grew; ) {
+        grew = false;
+        for (size_t i = 0; i < NUM_TESTS; i++) {
+            size_t t = order[i];
+            if (plan[t] == 0 || plan[t] >= opts->iterations) continue;
+            if (used + cost[t] > opts->time_budget) continue;
+            plan[t]++;
+            used += cost[t];
+            grew = true;
+        }
+    }
+
+    int fewest = opts->iterations;
+    for (size_t t = 0; t < NUM_TESTS; t++) {
+        if (plan[t] > 0 && plan[t] < fewest) fewest = plan[t];
+    }
+    fprintf(opts->report_out, "Time budget %.1fs: %zu of %zu tests, ", opts->time_budget,
+            admitted, NUM_TESTS);
+    if (fewest < opts->iterations) {
+        fprintf(opts->report_out, "%d-%d iterations", fewest, opts->iterations);
+    } else {
+        fprintf(opts->report_out, "%d iterations", fewest);
+    }
+    fprintf(opts->report_out, ", estimated %.1fs of parsing\n", used);
+    for (size_t t = 0; t < NUM_TESTS; t++) {
+        if (plan[t] > 0) estimate[t] = (opts->warmup + plan[t]) * cost[t];
+    }
+}
+
+/*
+ * The running deadline: true while a test estimated to take estimate
+ * seconds fits in what is left. Tests the history can't estimate are
+ * assumed to take as long as the longest one so far.
+ */
+static bool budget_allows(const bench_options_t *opts, uint64_t suite_start, double estimate) {
+    if (opts->time_budget <= 0) return true;
+    double elapsed = (get_time_ns() - suite_start) / 1e9;
+    return elapsed + estimate <= opts->time_budget;
+}
+
+/*
+ * Kept datasets - with --keep-files DIR each generated file is moved to
+ * DIR instead of deleted, and DIR/manifest.txt records its size, the
+ * counts a correct parser reports and (with --hash) its SHA-256. With
+ * --compress each kept file is then zstd-compressed to name.csv.zst.
+ */
+static bool compress_file(const char *path) {
+    pid_t pid = fork();
+    if (pid < 0) return false;
+    if (pid == 0) {
+        execlp("zstd", "zstd", "-q", "-f", "--rm", path, (char *)NULL);
+        _exit(127);
+    }
+    int status;
+    if (waitpid(pid, &status, 0) < 0) return false;
+    return WIFEXITED(status) && WEXITSTATUS(status) == 0;
+}
+
+/*
+ * Moves filepath into the keep directory and puts the name it ended up
+ * under in kept (empty if it had to be deleted instead)
+ */
+static void keep_dataset(const bench_options_t *opts, const char *filepath, const char *test_name,
+                         char *kept, size_t kept_size) {
+    char dest[512];
+    kept[0] = '\0';
+    snprintf(dest, sizeof(dest), "%s/%s.csv", opts->keep_dir, test_name);
+    if (rename(filepath, dest) != 0) {
+        /* saved before unlink can overwrite it */
+        int err = errno;
+        bool copied = false;
+        if (err == EXDEV) {
+            copied = copy_file(filepath, dest);
+            if (!copied) {
+                err = errno;
+                unlink(dest);
+            }
+        }
+        unlink(filepath);
+        if (!copied) {
+            fprintf(stderr, "Warning: cannot keep %s in %s: %s\n", test_name, opts->keep_dir, strerror(err));
+            return;
+        }
+    }
+    if (opts->compress && !compress_file(dest)) {
+        fprintf(stderr, "Warning: zstd failed for %s; kept it uncompressed\n", dest);
+        snprintf(kept, kept_size, "%s.csv", test_name);
+        return;
+    }
+    snprintf(kept, kept_size, "%s.csv%s", test_name, opts->compress ? ".zst" : "");
+}
+
+static void write_dataset_manifest(const bench_options_t *opts, const test_result_t *results,
+                                   size_t num_results) {
+    char path[512];
+    snprintf(path, sizeof(path), "%s/manifest.txt", opts->keep_dir);
+    FILE *f = fopen(path, "w");
+    if (!f) {
+        fprintf(stderr, "Warning: cannot write %s: %s\n", path, strerror(errno));
+        return;
+    }
+    fprintf(f, "# file bytes rows fields sha256 (generator seed %d, target %zu bytes)\n", GEN_SEED,
+            opts->target_bytes);
+    for (size_t i = 0; i < num_results; i++) {
+        const test_result_t *r = &results[i];
+        if (r->file_size == 0 || !r->kept_name[0]) continue;
+        fprintf(f, "%s %zu %llu %llu %s\n", r->kept_name, r->file_size, (unsigned long long)r->expected_rows,
+                (unsigned long long)r->expected_fields, r->sha256[0] ? r->sha256 : "-");
+    }
+    fclose(f);
+    fprintf(stderr, "Datasets kept in %s (see manifest.txt)\n", opts->keep_dir);
+}
+
+/*
+ * Field-size limits - --limits writes one-row files whose second field is
+ * just under, at and just over 64 KiB, 1 MiB and SonicSV's default
+ * max_field_size, plain and quoted, and records what each parser does
+ * with them: parse it whole, truncate it, report an error or crash. Each
+ * parse runs in a forked child so a crash is recorded, not fatal; the
+ * outcome comes back through a pipe.
+ */
+typedef struct {
+    uint64_t rows;
+    size_t bytes;     /* field bytes delivered */
+    uint64_t digest;  /* FNV-1a over every field, see limit_digest() */
+} limit_state_t;
+
+#define LIMIT_DIGEST_SEED 0xcbf29ce484222325ULL
+
+/* Folds one field into h; the trailing separator keeps "ab","c" apart from "a","bc" */
+static uint64_t limit_digest(uint64_t h, const void *data, size_t len) {
+    const unsigned char *p = (const unsigned char *)data;
+    for (size_t i = 0; i < len; i++) h = (h ^ p[i]) * 0x100000001b3ULL;
+    return (h ^ 0x1f) * 0x100000001b3ULL;
+}
+
+static void limit_sonicsv_row(const csv_row_t *row, void *user_data) {
+    limit_state_t *st = (limit_state_t *)user_data;
+    st->rows++;
+    for (size_t i = 0; i < row->num_fields; i++) {
+        const csv_field_t *field = csv_get_field(row, i);
+        if (!field) continue;
+        st->bytes += field->size;
+        st->digest = limit_digest(st->digest, field->data, field->size);
+    }
+}
+
+static void limit_libcsv_field(void *data, size_t len, void *user_data) {
+    limit_state_t *st = (limit_state_t *)user_data;
+    st->bytes += len;
+    st->digest = limit_digest(st->digest, data, len);
+}
+
+static void limit_libcsv_row(int delim, void *user_data) {
+    (void)delim;
+    ((limit_state_t *)user_data)->rows++;
+}
+
+/* Runs in the child: parses filepath and describes the outcome in out.
+ * A non-zero digest also has the field contents checked, not just their size. */
+static void limit_probe(bool sonicsv, const char *filepath, uint64_t rows, size_t bytes,
+                        uint64_t digest, char *out, size_t out_size) {
+    limit_state_t st = {0, 0, LIMIT_DIGEST_SEED};
+    if (sonicsv) {
+        csv_parse_options_t options = csv_default_options();
+        csv_parser_t *parser = csv_parser_create(&options);
+        if (!parser) {
+            snprintf(out, out_size, "error: create failed");
+            return;
+        }
+        csv_parser_set_row_callback(parser, limit_sonicsv_row, &st);
+        csv_error_t err = csv_parse_file(parser, filepath);
+        csv_parser_destroy(parser);
+        if (err != CSV_OK) {
+            snprintf(out, out_size, "error: %s", csv_error_string(err));
+            return;
+        }
+    } else {
+        struct csv_parser parser;
+        FILE *f = fopen(filepath, "rb");
+        if (!f || csv_init(&parser, CSV_STRICT) != 0) {
+            snprintf(out, out_size, "error: setup failed");
+            if (f) fclose(f);
+            return;
+        }
+        char buf[65536];
+        size_t n;
+        bool ok = true;
+        while (ok && (n = fread(buf, 1, sizeof(buf), f)) > 0) {
+            ok = csv_parse(&parser, buf, n, limit_libcsv_field, limit_libcsv_row, &st) == n;
+        }
+        if (ok) ok = csv_fini(&parser, limit_libcsv_field, limit_libcsv_row, &st) == 0;
+        if (!ok) snprintf(out, out_size, "error: %s", csv_strerror(csv_error(&parser)));
+        csv_free(&parser);
+        fclose(f);
+        if (!ok) return;
+    }
+    if (st.rows != rows) {
+        snprintf(out, out_size, "miscount (%llu of %llu rows)", (unsigned long long)st.rows,
+                 (unsigned long long)rows);
+    } else if (st.bytes != bytes) {
+        snprintf(out, out_size, "truncated (%zu of %zu bytes)", st.bytes, bytes);
+    } else if (digest != 0 && st.digest != digest) {
+        snprintf(out, out_size, "altered");
+    } else {
+        snprintf(out, out_size, "ok");
+    }
+}
+
+static void limit_run(bool sonicsv, const char *filepath, uint64_t rows, size_t bytes,
+                      uint64_t digest, char *out, size_t out_size) {
+    int fds[2];
+    if (pipe(fds) != 0) {
+        snprintf(out, out_size, "not run (pipe: %s)", strerror(errno));
+        return;
+    }
+    fflush(NULL);
+    pid_t pid = fork();
+    if (pid < 0) {
+        snprintf(out, out_size, "not run (fork: %s)", strerror(errno));
+        close(fds[0]);
+        close(fds[1]);
+        return;
+    }
+    if (pid == 0) {
+        close(fds[0]);
+        char msg[96];
+        limit_probe(sonicsv, filepath, rows, bytes, digest, msg, sizeof(msg));
+        ssize_t written = write(fds[1], msg, strlen(msg));
+        _exit(written < 0);
+    }
+    close(fds[1]);
+    ssize_t n = read(fds[0], out, out_size - 1);
+    close(fds[0]);
+    out[n > 0 ? n : 0] = '\0';
+
+    int status;
+    waitpid(pid, &status, 0);
+    if (WIFSIGNALED(status)) {
+        snprintf(out, out_size, "CRASH (%s)", strsignal(WTERMSIG(status)));
+    } else if (n <= 0) {
+        snprintf(out, out_size, "no result");
+    }
+}
+
+static bool write_limit_file(const char *filepath, size_t field_size, bool quoted) {
+    FILE *f = fopen(filepath, "wb");
+    if (!f) return false;
+    fputs("id,payload\n1,", f);
+    if (quoted) fputc('"', f);
+    char chunk[4096];
+    for (size_t i = 0; i < sizeof(chunk); i++) {
+        chunk[i] = quoted && i % 64 == 63 ? ',' : (char)('a' + i % 26);
+    }
+    for (size_t left = field_size; left > 0;) {
+        size_t n = left < sizeof(chunk) ? left : sizeof(chunk);
+        fwrite(chunk, 1, n, f);
+        left -= n;
+    }
+    if (quoted) fputc('"', f);
+    fputc('\n', f);
+    return fclose(f) == 0;
+}
+
+static int run_limits_probe(const bench_options_t *opts) {
+    FILE *out = opts->report_out;
+    csv_parse_options_t defaults = csv_default_options();
+    const size_t limits[] = {64 * 1024, 1024 * 1024, defaults.max_field_size};
+    char filepath[256];
+    snprintf(filepath, sizeof(filepath), "%s/limits.csv", g_temp_dir);
+    mkdir(g_temp_dir, 0755);
+
+    fprintf(out, "FIELD SIZE LIMITS (one field of the given size; quoted fields hold commas)\n");
+    fprintf(out, "SonicSV defaults: max_field_size %zu, max_row_size %zu (csv_parse_options_t);\n"
+                 "libcsv grows its field buffer without a limit.\n\n",
+            defaults.max_field_size, defaults.max_row_size);
+    fprintf(out, "%10s %-6s  %-34s %s\n", "Bytes", "Form", "SonicSV", "libcsv");
+    fprintf(out, "---------- ------  ---------------------------------- ----------------------------------\n");
+
+    int problems = 0;
+    for (size_t l = 0; l < sizeof(limits) / sizeof(limits[0]); l++) {
+        for (int delta = -1; delta <= 1; delta++) {
+            size_t size = limits[l] + delta;
+            for (int quoted = 0; quoted < 2; quoted++) {
+                if (!write_limit_file(filepath, size, quoted)) {
+                    fprintf(stderr, "Error: cannot write %s\n", filepath);
+                    rmdir(g_temp_dir);
+                    return 1;
+                }
+                /* "id", "payload", "1" and the field */
+                char s_out[96], l_out[96];
+                limit_run(true, filepath, 2, size + 10, 0, s_out, sizeof(s_out));
+                limit_run(false, filepath, 2, size + 10, 0, l_out, sizeof(l_out));
+                unlink(filepath);
+                problems += strncmp(s_out, "CRASH", 5) == 0 || strncmp(l_out, "CRASH", 5) == 0;
+                fprintf(out, "%10zu %-6s  %-34s %s\n", size, quoted ? "quoted" : "plain",
+                        s_out, l_out);
+            }
+        }
+    }
+    rmdir(g_temp_dir);
+
+    fprintf(out, "\nAn error past a configured limit is expected; truncation or a crash is a bug.\n");
+    return problems > 0 ? EXIT_BENCH_FAILURE : 0;
+}
+
+/*
+ * Embedded NULs - with --nul-rate the generator puts a NUL byte in that
+ * share of text fields, so the suite measures each parser on
+ * binary-contaminated input, and this section records what each does
+ * with one on small known files: keep the bytes after it (pass-through),
+ * cut the field short (truncated), stop with an error, or crash. Uses
+ * the forked probes of --limits.
+ */
+static void print_nul_behavior(FILE *out) {
+    static const struct {
+        const char *label;
+        const char *data;
+        size_t len;
+        size_t bytes;  /* field bytes a byte-transparent parser delivers */
+    } cases[] = {
+        {"mid-field",    "id,payload\n1,ab\0cd\n",     19, 15},
+        {"quoted",       "id,payload\n1,\"ab\0cd\"\n", 21, 15},
+        {"field start",  "id,payload\n1,\0abc\n",      18, 14},
+        {"only a NUL",   "id,payload\n1,\0\n",         15, 11},
+    };
+    char filepath[256];
+    snprintf(filepath, sizeof(filepath), "%s/nul.csv", g_temp_dir);
+
+    fprintf(out, "\nEMBEDDED NUL BYTES (--nul-rate %.3g; probe files with one NUL)\n", g_gen_nul_rate);
+    fprintf(out, "%-23s %-26s %s\n", "Case", "SonicSV", "libcsv");
+    fprintf(out, "----------------------- -------------------------- --------------------------\n");
+    for (size_t i = 0; i < sizeof(cases) / sizeof(cases[0]); i++) {
+        FILE *f = fopen(filepath, "wb");
+        if (!f) return;
+        bool ok = fwrite(cases[i].data, 1, cases[i].len, f) == cases[i].len;
+        if (fclose(f) != 0 || !ok) return;
+
+        char s_out[96], l_out[96];
+        limit_run(true, filepath, 2, cases[i].bytes, 0, s_out, sizeof(s_out));
+        limit_run(false, filepath, 2, cases[i].bytes, 0, l_out, sizeof(l_out));
+        unlink(filepath);
+        fprintf(out, "%-23s %-26s %s\n", cases[i].label,
+                strcmp(s_out, "ok") == 0 ? "pass-through" : s_out,
+                strcmp(l_out, "ok") == 0 ? "pass-through" : l_out);
+    }
+}
+
+/*
+ * Formula-looking fields - with --formula-rate this section parses small
+ * files holding one spreadsheet formula each, plain and quoted, and
+ * checks the field arrives byte for byte. A parser that strips the
+ * leading =, prefixes a quote or unescapes differently shows as altered,
+ * which would break a harness that writes the data back out.
+ */
+static void print_formula_behavior(FILE *out) {
+    static const struct {
+        const char *label;
+        const char *csv_field;  /* as written in the file */
+        const char *value;      /* what the parser must deliver */
+    } cases[] = {
+        {"=SUM(A1:A9)",         "=SUM(A1:A9)",                        "=SUM(A1:A9)"},
+        {"@SUM(1+1)",           "@SUM(1+1)",                          "@SUM(1+1)"},
+        {"+1+1",                "+1+1",                               "+1+1"},
+        {"-2+3",                "-2+3",                               "-2+3"},
+        {"quoted =1+1",         "\"=1+1\"",                           "=1+1"},
+        {"quoted =HYPERLINK",   "\"=HYPERLINK(\"\"http://x\"\",\"\"y\"\")\"", "=HYPERLINK(\"http://x\",\"y\")"},
+        {"quoted =cmd|...",     "\"=cmd|' /C calc'!A0\"",               "=cmd|' /C calc'!A0"},
+    };
+    char filepath[256];
+    snprintf(filepath, sizeof(filepath), "%s/formula.csv", g_temp_dir);
+
+    fprintf(out, "\nFORMULA-LOOKING FIELDS (--formula-rate %.3g; probe files with one formula)\n",
+            g_gen_formula_rate);
+    fprintf(out, "%-23s %-26s %s\n", "Case", "SonicSV", "libcsv");
+    fprintf(out, "----------------------- -------------------------- --------------------------\n");
+    bool altered = false;
+    for (size_t i = 0; i < sizeof(cases) / sizeof(cases[0]); i++) {
+        FILE *f = fopen(filepath, "wb");
+        if (!f) return;
+        fprintf(f, "id,payload\n1,%s\n", cases[i].csv_field);
+        if (fclose(f) != 0) return;
+
+        const char *fields[] = {"id", "payload", "1", cases[i].value};
+        uint64_t digest = LIMIT_DIGEST_SEED;
+        size_t bytes = 0;
+        for (size_t k = 0; k < sizeof(fields) / sizeof(fields[0]); k++) {
+            digest = limit_digest(digest, fields[k], strlen(fields[k]));
+            bytes += strlen(fields[k]);
+        }
+
+        char s_out[96], l_out[96];
+        limit_run(true, filepath, 2, bytes, digest, s_out, sizeof(s_out));
+        limit_run(false, filepath, 2, bytes, digest, l_out, sizeof(l_out));
+        unlink(filepath);
+        altered |= strcmp(s_out, "ok") != 0 || strcmp(l_out, "ok") != 0;
+        fprintf(out, "%-23s %-26s %s\n", cases[i].label,
+                strcmp(s_out, "ok") == 0 ? "unchanged" : s_out,
+                strcmp(l_out, "ok") == 0 ? "unchanged" : l_out);
+    }
+    if (altered) fprintf(out, "A parser that alters a formula field cannot be trusted to round-trip it.\n");
+}
+
+/*
+ * Failure policy - by default the suite keeps going past a failed test
+ * so one bad scenario doesn't cost the rest of an exploratory run.
+ * --fail-fast[=PHASES] stops at the first failure in those phases (all
+ * without a list) and --keep-going[=PHASES] clears them again; later
+ * flags win, so "--fail-fast --keep-going=parse" gates only on data
+ * generation and verification. The summaries cover the tests run so far.
+ */
+static bool parse_fail_phases(const char *arg, unsigned *mask, bool stop) {
+    unsigned bits = 0;
+    if (!arg || strcmp(arg, "all") == 0) {
+        bits = (1u << FAIL_PHASES) - 1;
+    } else {
+        char buf[64];
+        snprintf(buf, sizeof(buf), "%s", arg);
+        for (char *tok = strtok(buf, ","); tok; tok = strtok(NULL, ",")) {
+            size_t p = 0;
+            while (p < FAIL_PHASES && strcmp(fail_phase_names[p], tok) != 0) p++;
+            if (p == FAIL_PHASES) return false;
+            bits |= 1u << p;
+        }
+    }
+    *mask = stop ? *mask | bits : *mask & ~bits;
+    return true;
+}
+
+static bool stop_on_failure(const bench_options_t *opts, int phase, size_t index, const char *name) {
+    if (!(opts->fail_fast & (1u << phase))) return false;
+    fprintf(stderr, "[%2zu] %-18s stopping the suite (--fail-fast: %s failed)\n", index + 1, name,
+            fail_phase_names[phase]);
+    return true;
+}
+
+/*
+ * Main benchmark runner
+ */
+static int run_benchmark_suite(const bench_options_t *opts) {
+    const int iterations = opts->iterations;
+    const int warmup = opts->warmup;
+    FILE *report_out = opts->report_out;
+    test_result_t results[NUM_TESTS];
+    int plan[NUM_TESTS];
+    double estimate[NUM_TESTS];
+    size_t bench_failures = 0, mismatches = 0, stopped_at = NUM_TESTS, out_of_time = 0;
+    const uint64_t suite_start = get_time_ns();
+    uint64_t last_test_start = 0;
+    double longest_test = 0;
+    memset(results, 0, sizeof(results));
+
+    /* Create temp directory */
+    mkdir(g_temp_dir, 0755);
+
+    machine_info_t machine;
+    collect_machine_info(&machine);
+    detect_work_storage(g_temp_dir);
+    if (!self_exe_path(g_binary.path, sizeof(g_binary.path)) ||
+        !hash_file(g_binary.path, g_binary.sha256)) {
+        fprintf(stderr, "Warning: cannot hash the benchmark binary; mid-suite rebuilds go undetected\n");
+        g_binary.sha256[0] = '\0';
+    }
+
+    fprintf(report_out, "Machine: %s (%s), %s, %s, governor %s, turbo %s, simd %s\n",
+            machine.cpu, machine.cores, machine.memory, machine.kernel,
+            machine.governor, machine.turbo, machine.simd);
+    warn_missing_simd();
+    fprintf(report_out, "Configuration: %zu tests, %d iterations, %d warmup",
+            NUM_TESTS, iterations, warmup);
+    if (opts->target_bytes > 0) {
+        char size_cell[16];
+        fprintf(report_out, ", %s per test",
+                format_size(size_cell, sizeof(size_cell), (double)opts->target_bytes));
+    }
+    if (opts->repeat > 1) {
+        fprintf(report_out, ", files under 1 MB parsed %d times per sample", opts->repeat);
+    }
+    if (opts->prefetch) {
+        fprintf(report_out, ", inputs prefetched into the page cache");
+    }
+    if (opts->stripes > 1) {
+        fprintf(report_out, ", files under 1 MB sampled on up to %d cores at once", opts->stripes);
+    }
+    if (g_simd_pinned) {
+        fprintf(report_out, ", SonicSV pinned to %s", g_simd_pinned);
+    }
+    if (g_core_class) {
+        fprintf(report_out, ", %s cores only", g_core_class);
+    }
+    if (g_gen_number_locale) {
+        fprintf(report_out, ", %s number formatting", g_gen_number_locale->name);
+    }
+    fprintf(report_out, "\nWork directory: %s (%s, %s; device %s, scheduler %s)\n", g_temp_dir,
+            g_work_fs, g_work_mount, g_work_device, g_work_sched);
+    fprintf(report_out, "Source: %s (%s)\n", SONICSV_GIT_DESCRIBE, SONICSV_GIT_COMMIT);
+    fprintf(report_out, "Build log: %s\n", SONICSV_BUILD_LOG);
+    if (g_binary.sha256[0]) {
+        fprintf(report_out, "Binary: %s  %s\n", g_binary.sha256, g_binary.path);
+    }
+    plan_time_budget(opts, plan, estimate);
+    const bench_runner_t runners[NUM_PARSERS] = {run_sonicsv_benchmark, run_libcsv_benchmark};
+    bench_failures += smoke_check(report_out, runners, SMOKE_TIMEOUT_S);
+
+    int64_t sonicsv_overhead = 0, libcsv_overhead = 0;
+    char empty_path[256];
+    snprintf(empty_path, sizeof(empty_path), "%s/empty.csv", g_temp_dir);
+    FILE *empty = fopen(empty_path, "wb");
+    if (empty) {
+        fclose(empty);
+        if (!parser_excluded("SonicSV")) sonicsv_overhead = measure_fixed_overhead(run_sonicsv_benchmark, empty_path);
+        if (!parser_excluded("libcsv")) libcsv_overhead = measure_fixed_overhead(run_libcsv_benchmark, empty_path);
+        unlink(empty_path);
+    }
+    fprintf(report_out, "Fixed per-parse overhead (empty file): SonicSV %.1f us, libcsv %.1f us%s\n\n",
+            sonicsv_overhead / 1e3, libcsv_overhead / 1e3,
+            opts->subtract_overhead ? " - subtracted from all timings" : "");
+    if (!opts->subtract_overhead) {
+        sonicsv_overhead = libcsv_overhead = 0;
+    }
+
+    fprintf(report_out, "%-4s %-18s %9s %12s %12s %7s\n",
+            "#", "Test", "Size", "SonicSV", "libcsv", "Speedup");
+    fprintf(report_out, "---- ------------------ --------- ------------ ------------ -------\n");
+
+    if (opts->benchstat_out) {
+        print_benchstat_header(opts->benchstat_out, &machine);
+    }
+
+    g_trace_origin_ns = get_time_ns();
+    if (opts->trace_out) {
+        fprintf(opts->trace_out, "%12s %12s  %-18s %s\n", "start_ms", "elapsed_ms", "test", "phase");
+    }
+
+    for (size_t t = 0; t < NUM_TESTS; t++) {
+        const test_config_t *config = &test_configs[t];
+        test_result_t *result = &results[t];
+        const size_t mismatches_before = mismatches;
+
+        result->test_name = config->name;
+        stats_init(&result->sonicsv_times);
+        stats_init(&result->libcsv_times);
+        stats_init(&result->sonicsv_read_times);
+        stats_init(&result->libcsv_read_times);
+
+        if (g_duplicate_of[t] >= 0) {
+            fprintf(stderr, "[%2zu] %-18s skipped (same configuration as %s)\n", t + 1,
+                    config->name, test_configs[g_duplicate_of[t]].name);
+            continue;
+        }
+        if (plan[t] == 0) {
+            fprintf(stderr, "[%2zu] %-18s skipped (time budget)\n", t + 1, config->name);
+            continue;
+        }
+        uint64_t test_start = get_time_ns();
+        if (last_test_start > 0 && (test_start - last_test_start) / 1e9 > longest_test) {
+            longest_test = (test_start - last_test_start) / 1e9;
+        }
+        last_test_start = test_start;
+        if (!budget_allows(opts, suite_start, estimate[t] > 0 ? estimate[t] : longest_test)) {
+            fprintf(stderr, "[%2zu] %-18s skipped (time budget spent)\n", t + 1, config->name);
+            out_of_time++;
+            continue;
+        }
+        if (!verify_binary()) {
+            fprintf(stderr, "Error: %s changed during the suite (rebuilt?); refusing to mix builds\n",
+                    g_binary.path);
+            rmdir(g_temp_dir);
+            return EXIT_BUILD_FAILURE;
+        }
+        bench_options_t test_opts = *opts;
+        test_opts.iterations = plan[t];
+
+        /* Generate test file */
+        char filepath[256];
+        snprintf(filepath, sizeof(filepath), "%s/%s.csv", g_temp_dir, config->name);
+
+        uint64_t phase_start = get_time_ns();
+        gen_counts_t counts;
+        size_t file_size = generate_test_file(config, filepath, opts->target_bytes, &counts);
+        trace_phase(opts, config->name, "generate", phase_start, get_time_ns());
+        if (file_size == 0) {
+            fprintf(stderr, "[%2zu] %-18s FAILED (data generation)\n", t + 1, config->name);
+            bench_failures++;
+            if (stop_on_failure(opts, PHASE_GENERATE, t, config->name)) {
+                stopped_at = t;
+                break;
+            }
+            continue;
+        }
+
+        result->file_size = file_size;
+        result->expected_rows = counts.rows;
+        result->expected_fields = counts.fields;
+        memcpy(result->sha256, counts.sha256, sizeof(result->sha256));
+
+        /* Declared counts hold at the configured size only; parsers are
+         * then checked against the declaration, not the generator */
+        if (config->expect_rows > 0 && opts->target_bytes == 0) {
+            result->declared_checked = true;
+            if (counts.rows != config->expect_rows || counts.fields != config->expect_fields) {
+                result->generator_drift = true;
+                mismatches++;
+                fprintf(stderr, "[%2zu] %-18s WARNING: generator wrote %zu rows / %zu fields, "
+                                "scenario declares %zu / %zu\n", t + 1, config->name,
+                        counts.rows, counts.fields, config->expect_rows, config->expect_fields);
+            }
+            result->expected_rows = config->expect_rows;
+            result->expected_fields = config->expect_fields;
+        }
+
+        bench_state_t state;
+        const int repeat = file_size < REPEAT_MAX_FILE_SIZE ? opts->repeat : 1;
+
+        /* Warmup runs - with --sandbox or --quarantine each parser warms up
+         * inside its own phase, so a crash is attributed to the right one */
+        const bool warmup_per_parser = opts->sandbox || opts->quarantine_path;
+        phase_start = get_time_ns();
+        for (int w = 0; w < warmup && !warmup_per_parser; w++) {
+            if (!parser_excluded("SonicSV")) run_sonicsv_benchmark(filepath, file_size, config->delimiter, &state);
+            if (!parser_excluded("libcsv")) run_libcsv_benchmark(filepath, file_size, config->delimiter, &state);
+        }
+        trace_phase(opts, config->name, "warmup", phase_start, get_time_ns());
+
+        /* Timed runs - SonicSV */
+        phase_start = get_time_ns();
+        parser_run_t sonicsv_run = {
+            .parser = "SonicSV", .run = run_sonicsv_benchmark, .overhead = sonicsv_overhead,
+            .times = &result->sonicsv_times, .read_times = &result->sonicsv_read_times,
+            .failed = &result->sonicsv_failed,
+            .skipped = &result->sonicsv_skipped,
+            .unsupported = &result->sonicsv_unsupported,
+            .usage = &result->sonicsv_usage, .rss_trend = &result->sonicsv_rss_trend,
+            .rows = &result->sonicsv_rows, .fields = &result->sonicsv_fields,
+        };
+        if (!run_parser_phase(&test_opts, config, &sonicsv_run, filepath, file_size, repeat,
+                              warmup_per_parser)) {
+            fprintf(stderr, "[%2zu] %-18s FAILED (sandbox)\n", t + 1, config->name);
+            unlink(filepath);
+            bench_failures++;
+            if (stop_on_failure(opts, PHASE_PARSE, t, config->name)) {
+                stopped_at = t;
+                break;
+            }
+            continue;
+        }
+        trace_phase(opts, config->name, "timed_sonicsv", phase_start, get_time_ns());
+
+        /* Timed runs - libcsv */
+        phase_start = get_time_ns();
+        parser_run_t libcsv_run = {
+            .parser = "Libcsv", .run = run_libcsv_benchmark, .overhead = libcsv_overhead,
+            .times = &result->libcsv_times, .read_times = &result->libcsv_read_times,
+            .failed = &result->libcsv_failed,
+            .skipped = &result->libcsv_skipped,
+            .unsupported = &result->libcsv_unsupported,
+            .usage = &result->libcsv_usage, .rss_trend = &result->libcsv_rss_trend,
+            .rows = &result->libcsv_rows, .fields = &result->libcsv_fields,
+        };
+        if (!run_parser_phase(&test_opts, config, &libcsv_run, filepath, file_size, repeat,
+                              warmup_per_parser)) {
+            fprintf(stderr, "[%2zu] %-18s FAILED (sandbox)\n", t + 1, config->name);
+            unlink(filepath);
+            bench_failures++;
+            if (stop_on_failure(opts, PHASE_PARSE, t, config->name)) {
+                stopped_at = t;
+                break;
+            }
+            continue;
+        }
+        trace_phase(opts, config->name, "timed_libcsv", phase_start, get_time_ns());
+
+        phase_start = get_time_ns();
+        run_scan_baselines(&test_opts, config, result, filepath, repeat);
+        trace_phase(opts, config->name, "scan_baselines", phase_start, get_time_ns());
+
+        if (!result->sonicsv_skipped && !result->sonicsv_unsupported) {
+            result->sonicsv_leaked = leaked_per_parse(run_sonicsv_benchmark, filepath, file_size,
+                                                      config->delimiter);
+        }
+        if (!result->libcsv_skipped && !result->libcsv_unsupported) {
+            result->libcsv_leaked = leaked_per_parse(run_libcsv_benchmark, filepath, file_size,
+                                                     config->delimiter);
+        }
+        if (!result->sonicsv_skipped && !result->sonicsv_unsupported) {
+            result->sonicsv_peak_rss = parse_peak_rss(run_sonicsv_benchmark, filepath, file_size,
+                                                      config->delimiter);
+        }
+        if (!result->libcsv_skipped && !result->libcsv_unsupported) {
+            result->libcsv_peak_rss = parse_peak_rss(run_libcsv_benchmark, filepath, file_size,
+                                                     config->delimiter);
+        }
+
+        if (!result->sonicsv_skipped && !result->sonicsv_unsupported &&
+            !counts_match_expected(result, result->sonicsv_rows, result->sonicsv_fields)) {
+            warn_count_mismatch(t, result, "SonicSV", result->sonicsv_rows, result->sonicsv_fields);
+            mismatches++;
+        }
+        if (!result->libcsv_skipped && !result->libcsv_unsupported &&
+            !counts_match_expected(result, result->libcsv_rows, result->libcsv_fields)) {
+            warn_count_mismatch(t, result, "libcsv", result->libcsv_rows, result->libcsv_fields);
+            mismatches++;
+        }
+        if (result->sonicsv_failed || result->libcsv_failed) bench_failures++;
+
+        /* Decided now, acted on after this test's line and cleanup */
+        bool stop = (result->sonicsv_failed || result->libcsv_failed) &&
+                    stop_on_failure(opts, PHASE_PARSE, t, config->name);
+        if (!stop && mismatches > mismatches_before) stop = stop_on_failure(opts, PHASE_VERIFY, t, config->name);
+
+        /* Calculate throughput */
+        double sonicsv_mean = stats_mean(&result->sonicsv_times);
+        double libcsv_mean = stats_mean(&result->libcsv_times);
+
+        result->sonicsv_throughput = sonicsv_mean > 0 ? (file_size / (1024.0 * 1024.0)) / sonicsv_mean : 0;
+        result->libcsv_throughput = libcsv_mean > 0 ? (file_size / (1024.0 * 1024.0)) / libcsv_mean : 0;
+        result->speedup = result->libcsv_throughput > 0
+                        ? result->sonicsv_throughput / result->libcsv_throughput : 0;
+
+        /* Pairs that never ran show n/a rather than a misleading 0.0 */
+        char size_cell[16], sonicsv_cell[16] = "n/a", libcsv_cell[16] = "n/a", speedup_cell[16];
+        bool sonicsv_ran = !result->sonicsv_unsupported && !result->sonicsv_skipped;
+        bool libcsv_ran = !result->libcsv_unsupported && !result->libcsv_skipped;
+        if (sonicsv_ran) format_rate(sonicsv_cell, sizeof(sonicsv_cell), file_size, sonicsv_mean);
+        if (libcsv_ran) format_rate(libcsv_cell, sizeof(libcsv_cell), file_size, libcsv_mean);
+        snprintf(speedup_cell, sizeof(speedup_cell), sonicsv_ran && libcsv_ran ? "%.2fx" : "n/a",
+                 result->speedup);
+        fprintf(report_out, "[%2zu] %-18s %9s %12s %12s %7s\n",
+                t + 1, config->name,
+                format_size(size_cell, sizeof(size_cell), file_size),
+                sonicsv_cell, libcsv_cell, speedup_cell);
+        if (config->schema) {
+            fprintf(report_out, "     %-18s schema: %s\n", "", config->schema);
+        }
+        double s_mbj = usage_mb_per_joule(&result->sonicsv_usage, file_size, sonicsv_mean);
+        double l_mbj = usage_mb_per_joule(&result->libcsv_usage, file_size, libcsv_mean);
+        if (s_mbj > 0 || l_mbj > 0) {
+            char s_cell[16] = "n/a", l_cell[16] = "n/a";
+            if (s_mbj > 0) snprintf(s_cell, sizeof(s_cell), "%.1f MB/J", s_mbj);
+            if (l_mbj > 0) snprintf(l_cell, sizeof(l_cell), "%.1f MB/J", l_mbj);
+            fprintf(report_out, "     %-18s energy: SonicSV %s, libcsv %s\n", "", s_cell, l_cell);
+        }
+
+        /* Clean up test file */
+        phase_start = get_time_ns();
+        drop_file_cache(filepath);
+        if (opts->keep_dir) {
+            keep_dataset(opts, filepath, config->name, result->kept_name, sizeof(result->kept_name));
+        } else {
+            unlink(filepath);
+        }
+        trace_phase(opts, config->name, "cleanup", phase_start, get_time_ns());
+        if (stop) {
+            stopped_at = t;
+            break;
+        }
+    }
+    if (out_of_time > 0) {
+        fprintf(report_out, "\nTime budget of %.1fs spent; %zu planned tests were not started.\n",
+                opts->time_budget, out_of_time);
+    }
+    if (stopped_at < NUM_TESTS) {
+        fprintf(report_out, "\nStopped after test %zu of %zu (--fail-fast); the sections below cover "
+                            "the tests run so far.\n", stopped_at + 1, NUM_TESTS);
+    }
+    if (opts->keep_dir) write_dataset_manifest(opts, results, NUM_TESTS);
+
+    print_skipped_targets(report_out);
+    print_adversarial_summary(report_out, results, NUM_TESTS);
+    print_reliability_summary(report_out, results, NUM_TESTS);
+    if (g_gen_nul_rate > 0) print_nul_behavior(report_out);
+    if (g_gen_formula_rate > 0) print_formula_behavior(report_out);
+    print_scenario_notes(report_out, results, NUM_TESTS);
+    print_stability_summary(report_out, results, NUM_TESTS, iterations);
+    print_usage_summary(report_out, results, NUM_TESTS);
+    print_handle_summary(report_out, results, NUM_TESTS);
+    print_score_summary(report_out, results, NUM_TESTS, opts->weights);
+    print_pareto_summary(report_out, results, NUM_TESTS, opts->pareto_path);
+    print_energy_summary(report_out, results, NUM_TESTS);
+    print_scan_baselines(report_out, results, NUM_TESTS);
+    print_read_split(report_out, results, NUM_TESTS);
+    print_capability_matrix(report_out);
+    print_attribution(report_out);
+    if (g_gen_hash) {
+        fprintf(report_out, "\nDATASETS (SHA-256 of each generated file)\n");
+        for (size_t t = 0; t < NUM_TESTS; t++) {
+            if (results[t].sha256[0] == '\0') continue;
+            fprintf(report_out, "%s  %s\n", results[t].sha256, results[t].test_name);
+        }
+    }
+    size_t over_budget = 0, failed_assertions = 0;
+    if (opts->baseline_path) {
+        over_budget = print_baseline_comparison(report_out, opts, &machine, results, NUM_TESTS);
+    }
+    if (opts->cross_arch_path) {
+        print_cross_arch(report_out, opts->cross_arch_path, &machine, results, NUM_TESTS);
+    }
+    if (opts->num_assertions > 0) {
+        failed_assertions = check_assertions(report_out, opts, results, NUM_TESTS);
+    }
+
+    /* Cleanup */
+    rmdir(g_temp_dir);
+
+    (void)print_report; /* suppressed; --output now receives the same compact table */
+    return mismatches > 0                            ? EXIT_MISMATCH
+         : over_budget > 0 || failed_assertions > 0 ? EXIT_REGRESSION
+         : bench_failures > 0                        ? EXIT_BENCH_FAILURE
+                                                     : 0;
+}
+
+/*
+ * Generator benchmark - times generate_test_file() alone for every test
+ * config, so changes to the data generator can be measured in isolation.
+ * The generator is single-threaded (one RNG state, one output file), so
+ * there is no worker count to sweep. The stddev is taken over the rates
+ * of the individual iterations, not derived from the times'.
+ */
+static int run_generator_benchmark(const bench_options_t *opts) {
+    FILE *out = opts->report_out;
+
+    mkdir(g_temp_dir, 0755);
+
+    fprintf(out, "Generator benchmark: %zu configs, %d iterations\n\n", NUM_TESTS, opts->iterations);
+    fprintf(out, "%-4s %-18s %9s %12s %12s\n", "#", "Test", "Size", "Mean", "(stddev)");
+    fprintf(out, "---- ------------------ --------- ------------ ------------\n");
+
+    double total_bytes = 0, total_time = 0;
+
+    for (size_t t = 0; t < NUM_TESTS; t++) {
+        const test_config_t *config = &test_configs[t];
+        char filepath[256];
+        snprintf(filepath, sizeof(filepath), "%s/%s.csv", g_temp_dir, config->name);
+
+        timing_stats_t times;
+        stats_init(&times);
+        size_t file_size = 0;
+        double rate_sum = 0, rate_sum_sq = 0;  /* bytes/s of each iteration */
+
+        for (int i = 0; i < opts->iterations; i++) {
+            uint64_t start = get_time_ns();
+            gen_counts_t counts;
+            file_size = generate_test_file(config, filepath, opts->target_bytes, &counts);
+            uint64_t end = get_time_ns();
+            if (file_size == 0) break;
+            stats_add(&times, end - start);
+            double rate = end > start ? file_size * 1e9 / (double)(end - start) : 0;
+            rate_sum += rate;
+            rate_sum_sq += rate * rate;
+        }
+        unlink(filepath);
+
+        if (file_size == 0 || times.count == 0) {
+            fprintf(stderr, "[%2zu] %-18s FAILED (data generation)\n", t + 1, config->name);
+            continue;
+        }
+
+        double mean = stats_mean(&times);
+        total_bytes += file_size;
+        total_time += mean;
+
+        double rate_mean = rate_sum / times.count;
+        double rate_var = times.count > 1 ? rate_sum_sq / times.count - rate_mean * rate_mean : 0;
+        double rate_stddev = rate_var > 0 ? sqrt(rate_var) : 0;
+        char size_cell[16], rate_cell[16], stddev_cell[16];
+        fprintf(out, "[%2zu] %-18s %9s %12s %12s\n",
+                t + 1, config->name,
+                format_size(size_cell, sizeof(size_cell), file_size),
+                format_rate(rate_cell, sizeof(rate_cell), file_size, mean),
+                format_rate(stddev_cell, sizeof(stddev_cell), rate_stddev, 1));
+    }
+
+    rmdir(g_temp_dir);
+
+    if (total_time > 0) {
+        char rate_cell[16], size_cell[16];
+        fprintf(out, "\nAggregate generator:  %s (total: %s in %.3f s)\n",
+                format_rate(rate_cell, sizeof(rate_cell), total_bytes, total_time),
+                format_size(size_cell, sizeof(size_cell), total_bytes), total_time);
+    }
+    return 0;
+}
+
+/*
+ * Scaling analysis - runs every config at doubling sizes and fits
+ * time = c * bytes^k by least squares on the logs. A linear parser has
+ * k close to 1; k above SCALING_EXPONENT_MAX points at accidental
+ * super-linear behaviour such as re-scanning a growing field or row.
+ * The fastest run at each size is used, as it carries the least noise.
+ */
+static double fit_scaling_exponent(const double *bytes, const double *seconds, size_t n) {
+    double sx = 0, sy = 0, sxx = 0, sxy = 0;
+    size_t used = 0;
+    for (size_t i = 0; i < n; i++) {
+        if (bytes[i] <= 0 || seconds[i] <= 0) continue;
+        double x = log(bytes[i]), y = log(seconds[i]);
+        sx += x; sy += y; sxx += x * x; sxy += x * y;
+        used++;
+    }
+    if (used < 2) return 0;
+    double denom = used * sxx - sx * sx;
+    return denom != 0 ? (used * sxy - sx * sy) / denom : 0;
+}
+
+static int run_scaling_analysis(const bench_options_t *opts) {
+    FILE *out = opts->report_out;
+    size_t base = opts->target_bytes > 0 ? opts->target_bytes : 1024 * 1024;
+    size_t flagged = 0;
+
+    mkdir(g_temp_dir, 0755);
+
+    char size_cell[16];
+    fprintf(out, "Scaling analysis: %zu configs, %d sizes from %s, best of %d runs\n\n",
+            NUM_TESTS, SCALING_STEPS, format_size(size_cell, sizeof(size_cell), base),
+            opts->iterations);
+    fprintf(out, "%-4s %-18s %10s %10s\n", "#", "Test", "SonicSV", "libcsv");
+    fprintf(out, "---- ------------------ ---------- ----------\n");
+
+    for (size_t t = 0; t < NUM_TESTS; t++) {
+        const test_config_t *config = &test_configs[t];
+        char filepath[256];
+        snprintf(filepath, sizeof(filepath), "%s/%s.csv", g_temp_dir, config->name);
+
+        double bytes[SCALING_STEPS], sonicsv_s[SCALING_STEPS], libcsv_s[SCALING_STEPS];
+        bool failed = false;
+
+        for (int step = 0; step < SCALING_STEPS && !failed; step++) {
+            gen_counts_t counts;
+            size_t file_size = generate_test_file(config, filepath, base << step, &counts);
+            if (file_size == 0) {
+                failed = true;
+                break;
+            }
+            bytes[step] = (double)file_size;
+            sonicsv_s[step] = libcsv_s[step] = 1e30;
+
+            bench_state_t state;
+            for (int i = 0; i < opts->iterations; i++) {
+                int64_t e = run_sonicsv_benchmark(filepath, file_size, config->delimiter, &state);
+                if (e > 0 && e / 1e9 < sonicsv_s[step]) sonicsv_s[step] = e / 1e9;
+                e = run_libcsv_benchmark(filepath, file_size, config->delimiter, &state);
+                if (e > 0 && e / 1e9 < libcsv_s[step]) libcsv_s[step] = e / 1e9;
+            }
+            if (sonicsv_s[step] == 1e30) sonicsv_s[step] = 0;
+            if (libcsv_s[step] == 1e30) libcsv_s[step] = 0;
+        }
+        unlink(filepath);
+
+        if (failed) {
+            fprintf(stderr, "[%2zu] %-18s FAILED (data generation)\n", t + 1, config->name);
+            continue;
+        }
+
+        double k_sonicsv = fit_scaling_exponent(bytes, sonicsv_s, SCALING_STEPS);
+        double k_libcsv = fit_scaling_exponent(bytes, libcsv_s, SCALING_STEPS);
+        bool super_linear = k_sonicsv > SCALING_EXPONENT_MAX || k_libcsv > SCALING_EXPONENT_MAX;
+        if (super_linear) flagged++;
+
+        fprintf(out, "[%2zu] %-18s %10.2f %10.2f%s\n", t + 1, config->name,
+                k_sonicsv, k_libcsv, super_linear ? "  SUPER-LINEAR" : "");
+    }
+
+    rmdir(g_temp_dir);
+
+    fprintf(out, "\nExponent of time vs. size (1.00 = linear). %zu config(s) above %.2f.\n",
+            flagged, SCALING_EXPONENT_MAX);
+    return 0;
+}
+
+/*
+ * Range parsing - --range N:M measures parsing only rows N to M-1 (row 0
+ * is the header) of each file, the range-scan workload an indexed access
+ * API would serve. Neither parser can seek to a row, so an untimed scan
+ * first finds the byte offsets of both rows. The scan is quote-aware, as
+ * quoted fields may hold newlines; as in RFC 4180 a quote only opens a
+ * field at its start, so a stray quote mid-field is data. Its cost is
+ * reported as "index", the part an index would amortize. Each parser
+ * then reads and parses just that slice from a row boundary. With a
+ * perfect restart, range time over full-file time matches the slice's
+ * share of the bytes.
+ */
+static bool find_row_offsets(const char *filepath, char delim, size_t first, size_t last,
+                             off_t *first_off, off_t *last_off) {
+    FILE *f = fopen(filepath, "rb");
+    if (!f) return false;
+    enum { FIELD_START, UNQUOTED, QUOTED, QUOTE_IN_QUOTED } state = FIELD_START;
+    size_t row = 0;
+    off_t pos = 0;
+    bool found_first = first == 0, found_last = false;
+    *first_off = 0;
+
+    char buf[1 << 16];
+    size_t n;
+    while (!found_last && (n = fread(buf, 1, sizeof(buf), f)) > 0) {
+        for (size_t i = 0; i < n; i++) {
+            char c = buf[i];
+            if (state == QUOTED) {
+                if (c == '"') state = QUOTE_IN_QUOTED;
+                continue;
+            }
+            if (state == QUOTE_IN_QUOTED && c == '"') {
+                state = QUOTED;  /* "" is an escaped quote */
+                continue;
+            }
+            if (c == delim) {
+                state = FIELD_START;
+            } else if (c == '"' && state == FIELD_START) {
+                state = QUOTED;
+            } else if (c != '\n') {
+                state = UNQUOTED;
+            } else {
+                state = FIELD_START;
+                row++;
+                if (row == first) {
+                    *first_off = pos + (off_t)i + 1;
+                    found_first = true;
+                }
+                if (row == last) {
+                    *last_off = pos + (off_t)i + 1;
+                    found_last = true;
+                    break;
+                }
+            }
+        }
+        pos += (off_t)n;
+    }
+    fclose(f);
+    return found_first && found_last;
+}
+
+/* Reads the slice into a buffer the caller allocated; returns false on a short read */
+static bool read_range(const char *filepath, off_t offset, char *buf, size_t len) {
+    int fd = open(filepath, O_RDONLY);
+    if (fd < 0) return false;
+    size_t done = 0;
+    while (done < len) {
+        ssize_t n = pread(fd, buf + done, len - done, offset + (off_t)done);
+        if (n <= 0) break;
+        done += (size_t)n;
+    }
+    close(fd);
+    return done == len;
+}
+
+static int64_t run_sonicsv_range(const char *filepath, off_t offset, char *buf, size_t len,
+                                 char delim, bench_state_t *state) {
+    memset(state, 0, sizeof(*state));
+    csv_parse_options_t options = csv_default_options();
+    options.delimiter = delim;
+    csv_parser_t *parser = csv_parser_create(&options);
+    if (!parser) return -1;
+    csv_parser_set_row_callback(parser, sonicsv_row_callback, state);
+
+    uint64_t start = get_time_ns();
+    bool ok = read_range(filepath, offset, buf, len) &&
+              csv_parse_buffer(parser, buf, len, true) == CSV_OK;
+    uint64_t end = get_time_ns();
+
+    csv_parser_destroy(parser);
+    state->bytes_processed = len;
+    return ok ? (int64_t)(end - start) : -1;
+}
+
+static int64_t run_libcsv_range(const char *filepath, off_t offset, char *buf, size_t len,
+                                char delim, bench_state_t *state) {
+    memset(state, 0, sizeof(*state));
+    struct csv_parser parser;
+    if (csv_init(&parser, CSV_STRICT) != 0) return -1;
+    csv_set_delim(&parser, (unsigned char)delim);
+
+    uint64_t start = get_time_ns();
+    bool ok = read_range(filepath, offset, buf, len) &&
+              csv_parse(&parser, buf, len, libcsv_field_callback, libcsv_row_callback, state) == len;
+    csv_fini(&parser, libcsv_field_callback, libcsv_row_callback, state);
+    uint64_t end = get_time_ns();
+
+    csv_free(&parser);
+    state->bytes_processed = len;
+    return ok ? (int64_t)(end - start) : -1;
+}
+
+/* Fastest of the runs in seconds, 0 if every run failed or parsed the wrong row count */
+static double best_range_seconds(bool sonicsv, const char *filepath, off_t offset, char *buf,
+                                 size_t len, char delim, size_t rows, int iterations) {
+    double best = 0;
+    for (int i = 0; i < iterations; i++) {
+        bench_state_t state;
+        int64_t e = sonicsv ? run_sonicsv_range(filepath, offset, buf, len, delim, &state)
+                            : run_libcsv_range(filepath, offset, buf, len, delim, &state);
+        if (e <= 0 || state.rows_parsed != rows) return 0;
+        if (best == 0 || e / 1e9 < best) best = e / 1e9;
+    }
+    return best;
+}
+
+static double best_full_seconds(bench_runner_t run, const char *filepath, size_t file_size,
+                                char delim, int iterations) {
+    double best = 0;
+    for (int i = 0; i < iterations; i++) {
+        bench_state_t state;
+        int64_t e = run(filepath, file_size, delim, &state);
+        if (e > 0 && (best == 0 || e / 1e9 < best)) best = e / 1e9;
+    }
+    return best;
+}
+
+static int run_range_analysis(const bench_options_t *opts) {
+    FILE *out = opts->report_out;
+    const size_t first = opts->range_first, last = opts->range_last;
+    size_t failures = 0;
+
+    mkdir(g_temp_dir, 0755);
+
+    fprintf(out, "Range parse: rows %zu to %zu of each file, best of %d runs\n\n",
+            first, last - 1, opts->iterations);
+    fprintf(out, "%-4s %-18s %7s %9s %10s %7s %10s %7s\n",
+            "#", "Test", "share", "index ms", "SonicSV ms", "/full", "libcsv ms", "/full");
+    fprintf(out, "---- ------------------ ------- --------- ---------- ------- ---------- -------\n");
+
+    for (size_t t = 0; t < NUM_TESTS; t++) {
+        const test_config_t *config = &test_configs[t];
+        if (g_duplicate_of[t] >= 0) continue;
+        char filepath[256];
+        snprintf(filepath, sizeof(filepath), "%s/%s.csv", g_temp_dir, config->name);
+
+        gen_counts_t counts;
+        size_t file_size = generate_test_file(config, filepath, opts->target_bytes, &counts);
+        if (file_size == 0) {
+            fprintf(stderr, "[%2zu] %-18s FAILED (data generation)\n", t + 1, config->name);
+            failures++;
+            continue;
+        }
+
+        off_t first_off = 0, last_off = 0;
+        uint64_t index_start = get_time_ns();
+        bool found = find_row_offsets(filepath, config->delimiter, first, last,
+                                      &first_off, &last_off);
+        uint64_t index_end = get_time_ns();
+        if (!found) {
+            fprintf(stderr, "[%2zu] %-18s skipped (%zu rows)\n", t + 1, config->name, counts.rows);
+            unlink(filepath);
+            continue;
+        }
+
+        size_t len = (size_t)(last_off - first_off);
+        char *buf = malloc(len ? len : 1);
+        if (!buf) {
+            unlink(filepath);
+            failures++;
+            continue;
+        }
+        double s_range = best_range_seconds(true, filepath, first_off, buf, len,
+                                            config->delimiter, last - first, opts->iterations);
+        double l_range = best_range_seconds(false, filepath, first_off, buf, len,
+                                            config->delimiter, last - first, opts->iterations);
+        double s_full = best_full_seconds(run_sonicsv_benchmark, filepath, file_size,
+                                          config->delimiter, opts->iterations);
+        double l_full = best_full_seconds(run_libcsv_benchmark, filepath, file_size,
+                                          config->delimiter, opts->iterations);
+        free(buf);
+        unlink(filepath);
+
+        fprintf(out, "[%2zu] %-18s %6.1f%% %9.3f", t + 1, config->name,
+                100.0 * (double)len / (double)file_size, (index_end - index_start) / 1e6);
+        if (s_range > 0 && s_full > 0) {
+            fprintf(out, " %10.3f %6.1f%%", s_range * 1e3, 100.0 * s_range / s_full);
+        } else {
+            fprintf(out, " %10s %7s", "FAILED", "");
+            failures++;
+        }
+        if (l_range > 0 && l_full > 0) {
+            fprintf(out, " %10.3f %6.1f%%\n", l_range * 1e3, 100.0 * l_range / l_full);
+        } else {
+            fprintf(out, " %10s\n", "FAILED");
+            failures++;
+        }
+    }
+
+    rmdir(g_temp_dir);
+
+    fprintf(out, "\nshare is the slice's part of the file's bytes; /full is range time over\n"
+                 "full-file time. A parser restarting cleanly at a row boundary has /full\n"
+                 "close to share. FAILED means a parse error or the wrong row count.\n");
+    return failures > 0 ? EXIT_BENCH_FAILURE : 0;
+}
+
+/*
+ * In-memory parsing - --in-memory N loads each file into a buffer once
+ * and parses that buffer N times, so no pass touches the filesystem:
+ * what is left is pure parsing speed, shown next to the best end-to-end
+ * run on the file. Pass 1 is reported on its own as it still pays for
+ * cold caches and page faults in the buffer. Each pass must report the
+ * rows the end-to-end run did. With --benchstat every pass is written as
+ * a "<Parser>InMemory" line.
+ */
+static int64_t run_sonicsv_in_memory(const char *buf, size_t len, char delim,
+                                     bench_state_t *state) {
+    memset(state, 0, sizeof(*state));
+    csv_parse_options_t options = csv_default_options();
+    options.delimiter = delim;
+    csv_parser_t *parser = csv_parser_create(&options);
+    if (!parser) return -1;
+    csv_parser_set_row_callback(parser, sonicsv_row_callback, state);
+
+    uint64_t start = get_time_ns();
+    bool ok = csv_parse_buffer(parser, buf, len, true) == CSV_OK;
+    uint64_t end = get_time_ns();
+
+    csv_parser_destroy(parser);
+    state->bytes_processed = len;
+    return ok ? (int64_t)(end - start) : -1;
+}
+
+static int64_t run_libcsv_in_memory(const char *buf, size_t len, char delim,
+                                    bench_state_t *state) {
+    memset(state, 0, sizeof(*state));
+    struct csv_parser parser;
+    if (csv_init(&parser, CSV_STRICT) != 0) return -1;
+    csv_set_delim(&parser, (unsigned char)delim);
+
+    uint64_t start = get_time_ns();
+    bool ok = csv_parse(&parser, buf, len, libcsv_field_callback, libcsv_row_callback, state) == len;
+    csv_fini(&parser, libcsv_field_callback, libcsv_row_callback, state);
+    uint64_t end = get_time_ns();
+
+    csv_free(&parser);
+    state->bytes_processed = len;
+    return ok ? (int64_t)(end - start) : -1;
+}
+
+typedef int64_t (*memory_runner_t)(const char *buf, size_t len, char delim, bench_state_t *state);
+
+/* One parser's columns for a test; returns false (and prints FAILED) on an error or row mismatch */
+static bool in_memory_parser(const bench_options_t *opts, const test_config_t *config,
+                             const char *benchstat_name, bench_runner_t run, memory_runner_t mrun,
+                             const char *filepath, const char *buf, size_t len, int64_t *pass_ns) {
+    FILE *out = opts->report_out;
+    const int passes = opts->in_memory_passes;
+    bench_state_t state;
+
+    double e2e = 0;
+    uint64_t rows = 0;
+    for (int i = 0; i < opts->iterations; i++) {
+        int64_t e = run(filepath, len, config->delimiter, &state);
+        if (e > 0 && (e2e == 0 || e / 1e9 < e2e)) e2e = e / 1e9;
+        rows = state.rows_parsed;
+    }
+
+    bool ok = e2e > 0;
+    for (int i = 0; ok && i < passes; i++) {
+        usage_snapshot_t usage_start, usage_end;
+        usage_snapshot_start(&usage_start);
+        pass_ns[i] = mrun(buf, len, config->delimiter, &state);
+        usage_snapshot_end(&usage_end);
+        ok = pass_ns[i] > 0 && state.rows_parsed == rows;
+        if (ok && opts->benchstat_out) {
+            print_benchstat_line(opts->benchstat_out, benchstat_name, config->name, len,
+                                 (uint64_t)pass_ns[i], usage_end.cpu_ns - usage_start.cpu_ns, 0,
+                                 usage_energy_j(&usage_start, &usage_end), NULL, NULL);
+        }
+    }
+    if (!ok) {
+        fprintf(out, " %9s %9s %11s %11s", "FAILED", "", "", "");
+        return false;
+    }
+
+    int64_t first = pass_ns[0];
+    double median = median_ns(pass_ns, (size_t)passes) / 1e9;
+    char mem_cell[16], e2e_cell[16];
+    format_rate(mem_cell, sizeof(mem_cell), len, median);
+    format_rate(e2e_cell, sizeof(e2e_cell), len, e2e);
+    fprintf(out, " %9.3f %9.3f %11s %11s", first / 1e6, median * 1e3, mem_cell, e2e_cell);
+    return true;
+}
+
+static int run_in_memory_analysis(const bench_options_t *opts) {
+    FILE *out = opts->report_out;
+    const int passes = opts->in_memory_passes;
+    size_t failures = 0;
+
+    int64_t *pass_ns = malloc((size_t)passes * sizeof(*pass_ns));
+    if (!pass_ns) {
+        fprintf(stderr, "Error: Cannot allocate %d pass timings\n", passes);
+        return EXIT_BENCH_FAILURE;
+    }
+    mkdir(g_temp_dir, 0755);
+
+    fprintf(out, "In-memory parse: each file read once, then %d passes over the buffer; "
+                 "e2e = best of %d file parses\n\n", passes, opts->iterations);
+    fprintf(out, "%-23s %-44s %s\n", "", "SonicSV", "libcsv");
+    fprintf(out, "%-4s %-18s", "#", "Test");
+    for (int p = 0; p < 2; p++) {
+        fprintf(out, " %9s %9s %11s %11s", "pass 1 ms", "median ms", "in-memory", "e2e");
+    }
+    fprintf(out, "\n");
+
+    for (size_t t = 0; t < NUM_TESTS; t++) {
+        const test_config_t *config = &test_configs[t];
+        if (g_duplicate_of[t] >= 0) continue;
+        char filepath[256];
+        snprintf(filepath, sizeof(filepath), "%s/%s.csv", g_temp_dir, config->name);
+
+        gen_counts_t counts;
+        size_t file_size = generate_test_file(config, filepath, opts->target_bytes, &counts);
+        char *buf = file_size > 0 ? malloc(file_size) : NULL;
+        if (!buf || !read_range(filepath, 0, buf, file_size)) {
+            fprintf(stderr, "[%2zu] %-18s FAILED (%s)\n", t + 1, config->name,
+                    file_size == 0 ? "data generation" : "loading into memory");
+            free(buf);
+            unlink(filepath);
+            failures++;
+            continue;
+        }
+
+        fprintf(out, "[%2zu] %-18s", t + 1, config->name);
+        if (!in_memory_parser(opts, config, "SonicSVInMemory", run_sonicsv_benchmark,
+                              run_sonicsv_in_memory, filepath, buf, file_size, pass_ns)) {
+            failures++;
+        }
+        if (!in_memory_parser(opts, config, "LibcsvInMemory", run_libcsv_benchmark,
+                              run_libcsv_in_memory, filepath, buf, file_size, pass_ns)) {
+            failures++;
+        }
+        fprintf(out, "\n");
+        free(buf);
+        unlink(filepath);
+    }
+
+    rmdir(g_temp_dir);
+    free(pass_ns);
+
+    fprintf(out, "\nin-memory is the median pass; the gap to e2e is what reading the file\n"
+                 "costs each parser. FAILED means a parse error or a pass whose row count\n"
+                 "differs from the file parse.\n");
+    return failures > 0 ? EXIT_BENCH_FAILURE : 0;
+}
+
+/*
+ * Workloads - what a caller does with the fields once parsed, run the
+ * same way on top of both parsers: SonicSV's row callback and libcsv's
+ * field callback both hand each field, with its column, to the
+ * workload's field hook, then call its row hook. Neither parser is told
+ * about the workload, so a difference between two workloads is what the
+ * caller's side of the work costs or saves, not a parser feature.
+ */
+typedef struct {
+    bench_state_t s;
+    size_t col;            /* column of the field being delivered */
+                           /* (s.rows_parsed is the index of its row) */
+    uint64_t mask;         /* project: bit i set = materialize column i */
+    char *scratch;         /* materialized copy of the current field */
+    size_t scratch_size;
+    const struct filter_predicate *filter;
+    bool row_matched;      /* filter: the current row satisfied it */
+    size_t group_col;      /* group-by: key column, 0-based */
+    struct group_table *groups;
+    const column_spec_t *schema;  /* validate: the test's column types */
+    size_t schema_cols;
+    int sink;              /* convert: output file, -1 if none */
+    char delim;            /* round-trip: delimiter of the CSV written */
+    char *out;             /* convert: pending output, CONVERT_BUF bytes */
+    size_t out_len;
+    uint64_t result;       /* what the workload computed; must agree across parsers */
+    bool failed;           /* a hook ran out of memory */
+} workload_state_t;
+
+typedef struct {
+    const char *name;
+    void (*field)(workload_state_t *w, const char *data, size_t len);
+    void (*row)(workload_state_t *w);    /* NULL when there is nothing to do per row */
+    void (*reset)(workload_state_t *w);  /* before each run; NULL if stateless */
+    void (*finish)(workload_state_t *w); /* after the parse, still timed; NULL if none */
+} workload_t;
+
+/* Copies a field out of the parser's buffer, as building a string value would */
+static void materialize(workload_state_t *w, const char *data, size_t len) {
+    if (len > w->scratch_size) {
+        size_t size = w->scratch_size ? w->scratch_size : 256;
+        while (size < len) size *= 2;
+        char *grown = realloc(w->scratch, size);
+        if (!grown) {
+            w->failed = true;
+            return;
+        }
+        w->scratch = grown;
+        w->scratch_size = size;
+    }
+    memcpy(w->scratch, data, len);
+    if (len > 0) w->result += (uint64_t)(unsigned char)w->scratch[0];
+}
+
+static void project_field(workload_state_t *w, const char *data, size_t len) {
+    if (w->col < 64 && (w->mask >> w->col) & 1) materialize(w, data, len);
+}
+
+static const workload_t workload_project = {"project", project_field, NULL, NULL, NULL};
+
+/* The workload being run; the parser callbacks only carry the state */
+static const workload_t *g_workload;
+
+static void sonicsv_workload_callback(const csv_row_t *row, void *user_data) {
+    workload_state_t *w = (workload_state_t *)user_data;
+    w->s.fields_parsed += row->num_fields;
+    for (size_t i = 0; i < row->num_fields; i++) {
+        const csv_field_t *field = csv_get_field(row, i);
+        w->col = i;
+        g_workload->field(w, field ? field->data : "", field ? field->size : 0);
+    }
+    w->col = row->num_fields;  /* row hooks see the field count, as with libcsv */
+    if (g_workload->row) g_workload->row(w);
+    w->s.rows_parsed++;
+}
+
+static void libcsv_workload_field(void *data, size_t len, void *user_data) {
+    workload_state_t *w = (workload_state_t *)user_data;
+    w->s.fields_parsed++;
+    g_workload->field(w, (const char *)data, len);
+    w->col++;
+}
+
+static void libcsv_workload_row(int delim, void *user_data) {
+    (void)delim;
+    workload_state_t *w = (workload_state_t *)user_data;
+    if (g_workload->row) g_workload->row(w);
+    w->s.rows_parsed++;
+    w->col = 0;
+}
+
+static int64_t run_sonicsv_workload(const char *filepath, char delim, workload_state_t *w) {
+    csv_parse_options_t options = csv_default_options();
+    options.delimiter = delim;
+    csv_parser_t *parser = csv_parser_create(&options);
+    if (!parser) return -1;
+    csv_parser_set_row_callback(parser, sonicsv_workload_callback, w);
+
+    uint64_t start = get_time_ns();
+    csv_error_t result = csv_parse_file(parser, filepath);
+    if (g_workload->finish) g_workload->finish(w);
+    uint64_t end = get_time_ns();
+
+    csv_parser_destroy(parser);
+    return result == CSV_OK && !w->failed ? (int64_t)(end - start) : -1;
+}
+
+static int64_t run_libcsv_workload(const char *filepath, char delim, workload_state_t *w) {
+    struct csv_parser parser;
+    if (csv_init(&parser, CSV_STRICT) != 0) return -1;
+    csv_set_delim(&parser, (unsigned char)delim);
+    FILE *f = fopen(filepath, "rb");
+    char *buffer = malloc(65536);
+    if (!f || !buffer) {
+        if (f) fclose(f);
+        free(buffer);
+        csv_free(&parser);
+        return -1;
+    }
+
+    bool ok = true;
+    uint64_t start = get_time_ns();
+    size_t bytes_read;
+    while (ok && (bytes_read = fread(buffer, 1, 65536, f)) > 0) {
+        ok = csv_parse(&parser, buffer, bytes_read,
+                       libcsv_workload_field, libcsv_workload_row, w) == bytes_read;
+    }
+    csv_fini(&parser, libcsv_workload_field, libcsv_workload_row, w);
+    if (g_workload->finish) g_workload->finish(w);
+    uint64_t end = get_time_ns();
+
+    fclose(f);
+    free(buffer);
+    csv_free(&parser);
+    return ok && !w->failed ? (int64_t)(end - start) : -1;
+}
+
+static void workload_state_free(workload_state_t *w) {
+    free(w->scratch);
+    free(w->groups);
+    free(w->out);
+    free((void *)w->schema);
+    if (w->sink >= 0) close(w->sink);
+}
+
+/*
+ * Fastest of the runs in seconds, 0 if any failed. A NULL workload times
+ * the plain parse. w carries the workload's settings in and, after the
+ * last run, what it computed; counters are reset before every run.
+ */
+static double best_workload_seconds(bool sonicsv, const workload_t *wl, const char *filepath,
+                                    size_t file_size, char delim, int iterations,
+                                    workload_state_t *w) {
+    double best = 0;
+    for (int i = 0; i < iterations; i++) {
+        int64_t e;
+        if (!wl) {
+            bench_state_t state;
+            e = sonicsv ? run_sonicsv_benchmark(filepath, file_size, delim, &state)
+                        : run_libcsv_benchmark(filepath, file_size, delim, &state);
+        } else {
+            memset(&w->s, 0, sizeof(w->s));
+            w->col = 0;
+            w->result = 0;
+            if (wl->reset) wl->reset(w);
+            g_workload = wl;
+            e = sonicsv ? run_sonicsv_workload(filepath, delim, w)
+                        : run_libcsv_workload(filepath, delim, w);
+        }
+        if (e <= 0) return 0;
+        if (best == 0 || e / 1e9 < best) best = e / 1e9;
+    }
+    return best;
+}
+
+/*
+ * Runs wl against ref (NULL = the plain parse) on every test at least
+ * min_fields wide (and with a schema, if needs_schema), and reports both times per parser with ref over wl
+ * as the speedup. setup fills a state's workload settings for a test.
+ */
+typedef void (*workload_setup_t)(const bench_options_t *opts, const test_config_t *config,
+                                 workload_state_t *w, bool reference);
+
+static int run_workload_analysis(const bench_options_t *opts, const char *title,
+                                 const workload_t *wl, const workload_t *ref,
+                                 const char *ref_label, workload_setup_t setup,
+                                 size_t min_fields, bool needs_schema) {
+    FILE *out = opts->report_out;
+    size_t failures = 0, mismatches = 0;
+
+    mkdir(g_temp_dir, 0755);
+
+    fprintf(out, "%s, best of %d runs (ms)\n\n", title, opts->iterations);
+    fprintf(out, "%-4s %-18s %9s %9s %7s %9s %9s %7s\n", "#", "Test",
+            ref_label, wl->name, "SonicSV", ref_label, wl->name, "libcsv");
+    fprintf(out, "---- ------------------ --------- --------- ------- --------- --------- -------\n");
+
+    for (size_t t = 0; t < NUM_TESTS; t++) {
+        const test_config_t *config = &test_configs[t];
+        if (g_duplicate_of[t] >= 0) continue;
+        if (config->shape != SHAPE_TABLE) {
+            fprintf(stderr, "[%2zu] %-18s skipped (adversarial shape)\n", t + 1, config->name);
+            continue;
+        }
+        if (config->fields_per_row < min_fields) {
+            fprintf(stderr, "[%2zu] %-18s skipped (%zu columns)\n", t + 1, config->name,
+                    config->fields_per_row);
+            continue;
+        }
+        if (needs_schema && !config->schema) {
+            fprintf(stderr, "[%2zu] %-18s skipped (no schema)\n", t + 1, config->name);
+            continue;
+        }
+        char filepath[256];
+        snprintf(filepath, sizeof(filepath), "%s/%s.csv", g_temp_dir, config->name);
+
+        gen_counts_t counts;
+        size_t file_size = generate_test_file(config, filepath, opts->target_bytes, &counts);
+        if (file_size == 0) {
+            fprintf(stderr, "[%2zu] %-18s FAILED (data generation)\n", t + 1, config->name);
+            failures++;
+            continue;
+        }
+
+        fprintf(out, "[%2zu] %-18s", t + 1, config->name);
+        uint64_t results[2] = {0, 0};
+        for (int p = 0; p < 2; p++) {
+            bool sonicsv = p == 0;
+            workload_state_t ws = {.sink = -1}, rs = {.sink = -1};
+            if (setup) {
+                setup(opts, config, &ws, false);
+                setup(opts, config, &rs, true);
+            }
+            double w_s = best_workload_seconds(sonicsv, wl, filepath, file_size,
+                                               config->delimiter, opts->iterations, &ws);
+            double r_s = best_workload_seconds(sonicsv, ref, filepath, file_size,
+                                               config->delimiter, opts->iterations, &rs);
+            results[p] = ws.result;
+            workload_state_free(&ws);
+            workload_state_free(&rs);
+            if (w_s > 0 && r_s > 0) {
+                fprintf(out, " %9.3f %9.3f %6.2fx", r_s * 1e3, w_s * 1e3, r_s / w_s);
+            } else {
+                fprintf(out, " %9s %9s %7s", "FAILED", "", "");
+                failures++;
+            }
+        }
+        if (results[0] != results[1]) {
+            fprintf(out, "  MISMATCH");
+            mismatches++;
+        }
+        fprintf(out, "\n");
+        unlink(filepath);
+    }
+
+    rmdir(g_temp_dir);
+
+    fprintf(out, "\nThe SonicSV and libcsv columns are %s time over %s time (above 1 = faster).\n"
+                 "MISMATCH means the parsers fed the workload different data.\n",
+            ref_label, wl->name);
+    return mismatches > 0 ? EXIT_MISMATCH : failures > 0 ? EXIT_BENCH_FAILURE : 0;
+}
+
+/*
+ * Column projection - --project 2,7 materializes only those columns
+ * (1-based, as in cut -f) and compares that with materializing every
+ * column, the saving selective readers like Arrow's include_columns
+ * are built around. Tests narrower than the highest column are skipped.
+ */
+static bool parse_projection(const char *arg, uint64_t *mask, size_t *max_col) {
+    *mask = 0;
+    *max_col = 0;
+    const char *p = arg;
+    while (*p) {
+        char *end;
+        long col = strtol(p, &end, 10);
+        if (end == p || col < 1 || col > 64 || (*end != ',' && *end != '\0')) {
+            fprintf(stderr, "Error: --project takes column numbers 1-64 separated by commas\n");
+            return false;
+        }
+        *mask |= 1ULL << (col - 1);
+        if ((size_t)col > *max_col) *max_col = (size_t)col;
+        p = *end ? end + 1 : end;
+    }
+    return *mask != 0;
+}
+
+static void project_setup(const bench_options_t *opts, const test_config_t *config,
+                          workload_state_t *w, bool reference) {
+    (void)config;
+    w->mask = reference ? ~0ULL : opts->projection;
+}
+
+static int run_projection_analysis(const bench_options_t *opts) {
+    char title[96];
+    snprintf(title, sizeof(title), "Column projection: %s", opts->projection_arg);
+    return run_workload_analysis(opts, title, &workload_project, &workload_project,
+                                 "all cols", project_setup, opts->projection_max_col, false);
+}
+
+/*
+ * Filtering - --filter "3>=100" counts the rows whose column 3 (1-based)
+ * satisfies the predicate, against the plain parse: the filter-scan of
+ * analytical queries run straight on CSV. = and != compare text, the
+ * other operators compare numerically, and a field that isn't a number
+ * never matches those. The predicate type is declared with the options.
+ */
+static bool parse_filter(const char *arg, struct filter_predicate *f) {
+    static const struct { const char *sym; pred_op_t op; } ops[] = {
+        {"!=", PRED_NE}, {"<=", PRED_LE}, {">=", PRED_GE},
+        {"=", PRED_EQ}, {"<", PRED_LT}, {">", PRED_GT},
+    };
+    char *end;
+    long col = strtol(arg, &end, 10);
+    if (end == arg || col < 1) goto bad;
+    for (size_t i = 0; i < sizeof(ops) / sizeof(ops[0]); i++) {
+        size_t n = strlen(ops[i].sym);
+        if (strncmp(end, ops[i].sym, n) != 0) continue;
+        memset(f, 0, sizeof(*f));
+        f->col = (size_t)col - 1;
+        f->op = ops[i].op;
+        copy_value(f->text, sizeof(f->text), end + n);
+        f->text_len = strlen(f->text);
+        if (f->op == PRED_EQ || f->op == PRED_NE) return true;
+        char *num_end;
+        f->number = strtod(f->text, &num_end);
+        if (num_end != f->text && *num_end == '\0') return true;
+        fprintf(stderr, "Error: --filter: %s needs a number\n", ops[i].sym);
+        return false;
+    }
+bad:
+    fprintf(stderr, "Error: --filter must be COL OP VALUE, e.g. 3=foo or 2>=100\n");
+    return false;
+}
+
+static bool filter_matches(const struct filter_predicate *f, const char *data, size_t len) {
+    if (f->op == PRED_EQ || f->op == PRED_NE) {
+        bool equal = len == f->text_len && memcmp(data, f->text, len) == 0;
+        return equal == (f->op == PRED_EQ);
+    }
+    char buf[64];
+    if (len == 0 || len >= sizeof(buf)) return false;
+    memcpy(buf, data, len);
+    buf[len] = '\0';
+    char *end;
+    double v = strtod(buf, &end);
+    if (*end != '\0') return false;
+    switch (f->op) {
+        case PRED_LT: return v < f->number;
+        case PRED_LE: return v <= f->number;
+        case PRED_GT: return v > f->number;
+        case PRED_GE: return v >= f->number;
+        default:      return false;
+    }
+}
+
+static void filter_field(workload_state_t *w, const char *data, size_t len) {
+    if (w->col == w->filter->col) w->row_matched = filter_matches(w->filter, data, len);
+}
+
+static void filter_row(workload_state_t *w) {
+    if (w->row_matched) w->result++;
+    w->row_matched = false;
+}
+
+static const workload_t workload_filter = {"filter", filter_field, filter_row, NULL, NULL};
+
+static void filter_setup(const bench_options_t *opts, const test_config_t *config,
+                         workload_state_t *w, bool reference) {
+    (void)config; (void)reference;
+    w->filter = &opts->filter;
+}
+
+static int run_filter_analysis(const bench_options_t *opts) {
+    char title[128];
+    snprintf(title, sizeof(title), "Filter scan: rows where %s", opts->filter_arg);
+    return run_workload_analysis(opts, title, &workload_filter, NULL,
+                                 "parse", filter_setup, opts->filter.col + 1, false);
+}
+
+/*
+ * Group-by - --group-by 4 counts rows per distinct value of column 4
+ * (1-based) in a hash table, the simplest parse-then-aggregate pipeline.
+ * It runs twice per parser: keys hashed straight from the field slice the
+ * parser delivers, and keys first copied into a fresh allocation, as a
+ * parser returning owned strings forces on the caller. The gap is what
+ * zero-copy output is worth downstream (libcsv assembles every field in
+ * its own buffer first, so its slices already carry one copy). The table
+ * holds GROUP_SLOTS keys of up to GROUP_KEY_MAX bytes; rows beyond that
+ * are counted, not grouped, so pick a low-cardinality column
+ * (schema_mixed's enum is 4).
+ */
+#define GROUP_SLOTS   4096
+#define GROUP_KEY_MAX 64
+
+struct group_table {
+    size_t used;
+    uint64_t overflow;     /* rows whose key didn't fit */
+    struct {
+        uint64_t count;    /* 0 = empty slot */
+        uint32_t len;
+        char key[GROUP_KEY_MAX];
+    } slots[GROUP_SLOTS];
+};
+
+static void group_add(workload_state_t *w, const char *key, size_t len) {
+    struct group_table *g = w->groups;
+    uint64_t h = 1469598103934665603ULL;  /* FNV-1a */
+    for (size_t i = 0; i < len; i++) h = (h ^ (unsigned char)key[i]) * 1099511628211ULL;
+
+    if (len <= GROUP_KEY_MAX) {
+        for (size_t probe = 0; probe < GROUP_SLOTS; probe++) {
+            size_t i = (h + probe) & (GROUP_SLOTS - 1);
+            if (g->slots[i].count == 0) {
+                if (g->used >= GROUP_SLOTS * 3 / 4) break;
+                g->slots[i].len = (uint32_t)len;
+                memcpy(g->slots[i].key, key, len);
+                g->slots[i].count = 1;
+                g->used++;
+                w->result++;  /* distinct keys */
+                return;
+            }
+            if (g->slots[i].len == len && memcmp(g->slots[i].key, key, len) == 0) {
+                g->slots[i].count++;
+                return;
+            }
+        }
+    }
+    g->overflow++;
+    w->result += 1ULL << 32;
+}
+
+static void group_slice_field(workload_state_t *w, const char *data, size_t len) {
+    if (w->col == w->group_col) group_add(w, data, len);
+}
+
+static void group_copy_field(workload_state_t *w, const char *data, size_t len) {
+    if (w->col != w->group_col) return;
+    char *copy = malloc(len + 1);
+    if (!copy) {
+        w->failed = true;
+        return;
+    }
+    memcpy(copy, data, len);
+    copy[len] = '\0';
+    group_add(w, copy, len);
+    free(copy);
+}
+
+static void group_reset(workload_state_t *w) {
+    memset(w->groups, 0, sizeof(*w->groups));
+}
+
+static const workload_t workload_group_slice = {"slices", group_slice_field, NULL, group_reset, NULL};
+static const workload_t workload_group_copy = {"copies", group_copy_field, NULL, group_reset, NULL};
+
+static void group_setup(const bench_options_t *opts, const test_config_t *config,
+                        workload_state_t *w, bool reference) {
+    (void)config; (void)reference;
+    w->group_col = opts->group_col;
+    w->groups = calloc(1, sizeof(*w->groups));
+    if (!w->groups) w->failed = true;
+}
+
+static int run_group_analysis(const bench_options_t *opts) {
+    char title[96];
+    snprintf(title, sizeof(title), "Group-by count on column %zu", opts->group_col + 1);
+    return run_workload_analysis(opts, title, &workload_group_slice, &workload_group_copy,
+                                 "copies", group_setup, opts->group_col + 1, false);
+}
+
+/*
+ * Conversion - --convert json transcodes every file to JSON lines, one
+ * array of strings per row, written to a file in the work directory:
+ * the full read-parse-escape-write path of a CSV-to-JSON converter,
+ * against the plain parse. Only JSON is built in: a Parquet (or Arrow)
+ * writer would need a library this suite doesn't link, so there is no
+ * parquet format until one is added as a dependency.
+ */
+#define CONVERT_BUF (1 << 16)
+
+static void convert_flush(workload_state_t *w) {
+    size_t done = 0;
+    while (done < w->out_len) {
+        ssize_t n = write(w->sink, w->out + done, w->out_len - done);
+        if (n <= 0) {
+            w->failed = true;
+            break;
+        }
+        done += (size_t)n;
+    }
+    w->result += w->out_len;  /* bytes of JSON produced */
+    w->out_len = 0;
+}
+
+/* Appends len bytes, flushing first when they wouldn't fit */
+static void convert_put(workload_state_t *w, const char *data, size_t len) {
+    if (w->out_len + len > CONVERT_BUF) convert_flush(w);
+    if (len > CONVERT_BUF) {
+        w->out_len = 0;
+        while (len > 0) {
+            size_t n = len < CONVERT_BUF ? len : CONVERT_BUF;
+            memcpy(w->out, data, n);
+            w->out_len = n;
+            convert_flush(w);
+            data += n;
+            len -= n;
+        }
+        return;
+    }
+    memcpy(w->out + w->out_len, data, len);
+    w->out_len += len;
+}
+
+static void json_field(workload_state_t *w, const char *data, size_t len) {
+    convert_put(w, w->col == 0 ? "[\"" : ",\"", 2);
+    size_t run = 0;  /* bytes since the last escape, copied in one go */
+    for (size_t i = 0; i < len; i++) {
+        unsigned char c = (unsigned char)data[i];
+        if (c >= 0x20 && c != '"' && c != '\\') continue;
+        convert_put(w, data + run, i - run);
+        char esc[8];
+        int n = c == '"'  ? snprintf(esc, sizeof(esc), "\\\"")
+              : c == '\\' ? snprintf(esc, sizeof(esc), "\\\\")
+              : c == '\n' ? snprintf(esc, sizeof(esc), "\\n")
+              : snprintf(esc, sizeof(esc), "\\u%04x", c);
+        convert_put(w, esc, (size_t)n);
+        run = i + 1;
+    }
+    convert_put(w, data + run, len - run);
+    convert_put(w, "\"", 1);
+}
+
+static void json_row(workload_state_t *w) {
+    convert_put(w, w->col == 0 ? "[]\n" : "]\n", w->col == 0 ? 3 : 2);
+}
+
+static void convert_reset(workload_state_t *w) {
+    w->out_len = 0;
+    if (ftruncate(w->sink, 0) != 0 || lseek(w->sink, 0, SEEK_SET) != 0) w->failed = true;
+}
+
+static const workload_t workload_json = {"json", json_field, json_row, convert_reset, convert_flush};
+
+static void convert_setup(const bench_options_t *opts, const test_config_t *config,
+                          workload_state_t *w, bool reference) {
+    (void)opts;
+    if (reference) return;  /* the plain parse writes nothing */
+    char path[256];
+    snprintf(path, sizeof(path), "%s/%s.json", g_temp_dir, config->name);
+    w->sink = open(path, O_WRONLY | O_CREAT | O_TRUNC, 0644);
+    w->out = malloc(CONVERT_BUF);
+    if (w->sink < 0 || !w->out) w->failed = true;
+    unlink(path);  /* the open descriptor keeps it until workload_state_free() */
+}
+
+static int run_convert_analysis(const bench_options_t *opts) {
+    return run_workload_analysis(opts, "Conversion to JSON lines", &workload_json, NULL,
+                                 "parse", convert_setup, 0, false);
+}
+
+/*
+ * Round trip - --round-trip parses every test file, writes the fields
+ * back out as CSV and parses that with the same parser, which must see
+ * the same rows, the same fields per row and the same bytes in each.
+ * The writer quotes only what needs it (the delimiter, quotes, CR, LF)
+ * and doubles embedded quotes, plus a lone empty field so its row isn't
+ * written as a blank line. A pure read benchmark can't catch a parser
+ * that unescapes a field differently from how it was escaped; this can.
+ */
+static void csv_out_field(workload_state_t *w, const char *data, size_t len) {
+    if (w->col > 0) convert_put(w, &w->delim, 1);
+    bool quote = len == 0 && w->col == 0;
+    for (size_t i = 0; i < len && !quote; i++) {
+        quote = data[i] == w->delim || data[i] == '"' || data[i] == '\r' || data[i] == '\n';
+    }
+    if (!quote) {
+        convert_put(w, data, len);
+        return;
+    }
+    convert_put(w, "\"", 1);
+    size_t run = 0;
+    for (size_t i = 0; i < len; i++) {
+        if (data[i] != '"') continue;
+        convert_put(w, data + run, i + 1 - run);  /* through the quote, which is then doubled */
+        run = i;
+    }
+    convert_put(w, data + run, len - run);
+    convert_put(w, "\"", 1);
+}
+
+static void csv_out_row(workload_state_t *w) {
+    convert_put(w, "\n", 1);
+}
+
+static const workload_t workload_csv_out = {"csv", csv_out_field, csv_out_row, convert_reset, convert_flush};
+
+/* Folds every field, and the end of every row, into result */
+static void digest_field(workload_state_t *w, const char *data, size_t len) {
+    w->result = limit_digest(w->result, data, len);
+}
+
+static void digest_row(workload_state_t *w) {
+    w->result = limit_digest(w->result, "\n", 1);
+}
+
+static const workload_t workload_digest = {"digest", digest_field, digest_row, NULL, NULL};
+
+/* Describes how the re-parse differed from the first parse; "" when it didn't */
+static const char *round_trip_parser(bool sonicsv, const char *filepath, size_t file_size,
+                                     char delim, const char *written, char *why, size_t why_size) {
+    workload_state_t first = {.sink = -1}, out = {.sink = -1, .delim = delim}, again = {.sink = -1};
+    why[0] = '\0';
+    out.sink = open(written, O_RDWR | O_CREAT | O_TRUNC, 0644);
+    out.out = malloc(CONVERT_BUF);
+    struct stat st;
+    if (best_workload_seconds(sonicsv, &workload_digest, filepath, file_size, delim, 1, &first) <= 0) {
+        snprintf(why, why_size, "FAILED (parse)");
+    } else if (out.sink < 0 || !out.out ||
+               best_workload_seconds(sonicsv, &workload_csv_out, filepath, file_size, delim, 1, &out) <= 0 ||
+               fstat(out.sink, &st) != 0) {
+        snprintf(why, why_size, "FAILED (write)");
+    } else if (best_workload_seconds(sonicsv, &workload_digest, written, (size_t)st.st_size, delim, 1,
+                                     &again) <= 0) {
+        snprintf(why, why_size, "FAILED (re-parse)");
+    } else if (again.s.rows_parsed != first.s.rows_parsed) {
+        snprintf(why, why_size, "rows %llu -> %llu", (unsigned long long)first.s.rows_parsed,
+                 (unsigned long long)again.s.rows_parsed);
+    } else if (again.s.fields_parsed != first.s.fields_parsed) {
+        snprintf(why, why_size, "fields %llu -> %llu", (unsigned long long)first.s.fields_parsed,
+                 (unsigned long long)again.s.fields_parsed);
+    } else if (again.result != first.result) {
+        snprintf(why, why_size, "field contents differ");
+    }
+    workload_state_free(&first);
+    workload_state_free(&out);
+    workload_state_free(&again);
+    unlink(written);
+    return why;
+}
+
+static int run_round_trip(const bench_options_t *opts) {
+    FILE *out = opts->report_out;
+    size_t failures = 0, mismatches = 0;
+    mkdir(g_temp_dir, 0755);
+
+    fprintf(out, "ROUND TRIP (parse, write CSV, parse again with the same parser)\n\n");
+    fprintf(out, "%-4s %-18s %-28s %s\n", "#", "Test", "SonicSV", "libcsv");
+    fprintf(out, "---- ------------------ ---------------------------- ----------------------------\n");
+
+    for (size_t t = 0; t < NUM_TESTS; t++) {
+        const test_config_t *config = &test_configs[t];
+        if (g_duplicate_of[t] >= 0) continue;
+        char filepath[256], written[256];
+        snprintf(filepath, sizeof(filepath), "%s/%s.csv", g_temp_dir, config->name);
+        snprintf(written, sizeof(written), "%s/%s.rt.csv", g_temp_dir, config->name);
+
+        gen_counts_t counts;
+        size_t file_size = generate_test_file(config, filepath, opts->target_bytes, &counts);
+        if (file_size == 0) {
+            fprintf(stderr, "[%2zu] %-18s FAILED (data generation)\n", t + 1, config->name);
+            failures++;
+            continue;
+        }
+
+        char why[NUM_PARSERS][64];
+        fprintf(out, "[%2zu] %-18s", t + 1, config->name);
+        for (size_t p = 0; p < NUM_PARSERS; p++) {
+            round_trip_parser(p == 0, filepath, file_size, config->delimiter, written,
+                              why[p], sizeof(why[p]));
+            if (strncmp(why[p], "FAILED", 6) == 0) failures++;
+            else if (why[p][0]) mismatches++;
+            fprintf(out, p + 1 < NUM_PARSERS ? " %-28s" : " %s", why[p][0] ? why[p] : "identical");
+        }
+        fprintf(out, "\n");
+        unlink(filepath);
+    }
+    rmdir(g_temp_dir);
+
+    fprintf(out, "\nidentical means the re-parse saw the same rows, fields per row and field bytes.\n");
+    return mismatches > 0 ? EXIT_MISMATCH : failures > 0 ? EXIT_BENCH_FAILURE : 0;
+}
+
+/*
+ * Validation - --validate checks every field of the tests that declare a
+ * schema against its column type while parsing (ints in range, floats
+ * fully numeric, bools, YYYY-MM-DD dates, well-formed UTF-8), against
+ * the plain parse: the cost of a typed load's checking pass. The header
+ * row is skipped. The count of invalid fields must agree between the
+ * parsers and is 0 for the generator's own output.
+ */
+/* Copies a number into buf as C formatting, undoing --number-locale; false if too long */
+static bool delocalize_number(const char *data, size_t len, char *buf, size_t size) {
+    const number_locale_t *loc = g_gen_number_locale;
+    const size_t group_len = loc ? strlen(loc->group) : 0;
+    size_t n = 0;
+    for (size_t i = 0; i < len; i++) {
+        if (loc && len - i >= group_len && memcmp(data + i, loc->group, group_len) == 0) {
+            i += group_len - 1;
+            continue;
+        }
+        if (n + 1 >= size) return false;
+        buf[n++] = loc && data[i] == loc->decimal ? '.' : data[i];
+    }
+    buf[n] = '\0';
+    return n > 0;
+}
+
+static bool valid_integer(const char *data, size_t len, int64_t min, int64_t max) {
+    char buf[24];
+    if (!delocalize_number(data, len, buf, sizeof(buf))) return false;
+    if (buf[buf[0] == '-'] < '0' || buf[buf[0] == '-'] > '9') return false;
+    char *end;
+    errno = 0;
+    long long v = strtoll(buf, &end, 10);
+    return *end == '\0' && errno == 0 && v >= min && v <= max;
+}
+
+static bool valid_float(const char *data, size_t len) {
+    char buf[64];
+    if (!delocalize_number(data, len, buf, sizeof(buf))) return false;
+    char *end;
+    strtod(buf, &end);
+    return *end == '\0';
+}
+
+static bool valid_date(const char *d, size_t len) {
+    if (len != 10 || d[4] != '-' || d[7] != '-') return false;
+    for (int i = 0; i < 10; i++) {
+        if (i != 4 && i != 7 && (d[i] < '0' || d[i] > '9')) return false;
+    }
+    int month = (d[5] - '0') * 10 + (d[6] - '0');
+    int day = (d[8] - '0') * 10 + (d[9] - '0');
+    return month >= 1 && month <= 12 && day >= 1 && day <= 31;
+}
+
+static bool valid_utf8(const unsigned char *s, size_t len) {
+    for (size_t i = 0; i < len;) {
+        unsigned char c = s[i];
+        size_t n = c < 0x80 ? 1 : (c >> 5) == 0x6 ? 2 : (c >> 4) == 0xe ? 3 : (c >> 3) == 0x1e ? 4 : 0;
+        if (n == 0 || i + n > len) return false;
+        for (size_t k = 1; k < n; k++) {
+            if ((s[i + k] & 0xc0) != 0x80) return false;
+        }
+        i += n;
+    }
+    return true;
+}
+
+static void validate_field(workload_state_t *w, const char *data, size_t len) {
+    if (w->s.rows_parsed == 0 || w->col >= w->schema_cols) return;  /* header, extra columns */
+    bool ok;
+    switch (w->schema[w->col].type) {
+        case COL_INT32: ok = valid_integer(data, len, INT32_MIN, INT32_MAX); break;
+        case COL_INT64: ok = valid_integer(data, len, INT64_MIN, INT64_MAX); break;
+        case COL_FLOAT: ok = valid_float(data, len); break;
+        case COL_BOOL:  ok = (len == 4 && memcmp(data, "true", 4) == 0) ||
+                             (len == 5 && memcmp(data, "false", 5) == 0); break;
+        case COL_DATE:  ok = valid_date(data, len); break;
+        case COL_UTF8:  ok = valid_utf8((const unsigned char *)data, len); break;
+        case COL_ENUM:  ok = len > 0; break;
+        case COL_STR:
+        default:        ok = true; break;
+    }
+    if (!ok) w->result++;
+}
+
+static const workload_t workload_validate = {"validate", validate_field, NULL, NULL, NULL};
+
+static void validate_setup(const bench_options_t *opts, const test_config_t *config,
+                           workload_state_t *w, bool reference) {
+    (void)opts;
+    if (reference) return;
+    column_spec_t *cols = calloc(MAX_FIELDS_PER_ROW, sizeof(*cols));
+    w->schema_cols = cols ? parse_schema(config->schema, cols, MAX_FIELDS_PER_ROW) : 0;
+    w->schema = cols;
+    if (w->schema_cols == 0) w->failed = true;
+}
+
+static int run_validate_analysis(const bench_options_t *opts) {
+    return run_workload_analysis(opts, "Validation against each test's schema", &workload_validate,
+                                 NULL, "parse", validate_setup, 0, true);
+}
+
+/*
+ * Parser churn - serverless and per-request users create a parser, parse
+ * a few rows and destroy it, so setup and teardown can cost more than the
+ * parse itself. --churn N times N create/parse/destroy cycles on a tiny
+ * input, then N parses that reuse one parser (csv_parser_reset for
+ * SonicSV, csv_fini for libcsv); the difference is the setup cost per
+ * parse. Best of --iterations passes.
+ */
+#define CHURN_INPUT "id,name,value\n1,alpha,3.5\n2,\"beta, gamma\",7\n"
+#define CHURN_ROWS 3
+
+/* Nanoseconds per cycle over n cycles, 0 if any cycle failed or miscounted */
+static double churn_sonicsv(size_t n, bool reuse) {
+    const size_t len = sizeof(CHURN_INPUT) - 1;
+    bench_state_t state;
+    csv_parser_t *parser = NULL;
+    if (reuse) {
+        parser = csv_parser_create(NULL);
+        if (!parser) return 0;
+        csv_parser_set_row_callback(parser, sonicsv_row_callback, &state);
+    }
+
+    bool ok = true;
+    uint64_t start = get_time_ns();
+    for (size_t i = 0; i < n && ok; i++) {
+        memset(&state, 0, sizeof(state));
+        if (reuse) {
+            ok = csv_parser_reset(parser) == CSV_OK;
+        } else {
+            parser = csv_parser_create(NULL);
+            if (!parser) return 0;
+            csv_parser_set_row_callback(parser, sonicsv_row_callback, &state);
+        }
+        ok = ok && csv_parse_buffer(parser, CHURN_INPUT, len, true) == CSV_OK &&
+             state.rows_parsed == CHURN_ROWS;
+        if (!reuse) csv_parser_destroy(parser);
+    }
+    uint64_t end = get_time_ns();
+
+    if (reuse) csv_parser_destroy(parser);
+    return ok ? (double)(end - start) / (double)n : 0;
+}
+
+static double churn_libcsv(size_t n, bool reuse) {
+    const size_t len = sizeof(CHURN_INPUT) - 1;
+    bench_state_t state;
+    struct csv_parser parser;
+    if (reuse && csv_init(&parser, CSV_STRICT) != 0) return 0;
+
+    bool ok = true;
+    uint64_t start = get_time_ns();
+    for (size_t i = 0; i < n && ok; i++) {
+        memset(&state, 0, sizeof(state));
+        if (!reuse && csv_init(&parser, CSV_STRICT) != 0) return 0;
+        ok = csv_parse(&parser, CHURN_INPUT, len, libcsv_field_callback, libcsv_row_callback,
+                       &state) == len &&
+             csv_fini(&parser, libcsv_field_callback, libcsv_row_callback, &state) == 0 &&
+             state.rows_parsed == CHURN_ROWS;
+        if (!reuse) csv_free(&parser);
+    }
+    uint64_t end = get_time_ns();
+
+    if (reuse) csv_free(&parser);
+    return ok ? (double)(end - start) / (double)n : 0;
+}
+
+static double best_churn_ns(double (*run)(size_t, bool), size_t n, bool reuse, int iterations) {
+    double best = 0;
+    for (int i = 0; i < iterations; i++) {
+        double ns = run(n, reuse);
+        if (ns <= 0) return 0;
+        if (best == 0 || ns < best) best = ns;
+    }
+    return best;
+}
+
+static int run_churn_benchmark(const bench_options_t *opts) {
+    FILE *out = opts->report_out;
+    const size_t n = opts->churn_cycles;
+    const struct {
+        const char *name;
+        double (*run)(size_t, bool);
+    } parsers[] = {{"SonicSV", churn_sonicsv}, {"libcsv", churn_libcsv}};
+
+    fprintf(out, "PARSER CHURN (%zu cycles on a %zu-byte, %d-row input, best of %d passes)\n\n",
+            n, sizeof(CHURN_INPUT) - 1, CHURN_ROWS, opts->iterations);
+    fprintf(out, "%-10s %14s %14s %14s\n", "Parser", "fresh ns/parse", "reused ns", "setup ns");
+    fprintf(out, "---------- -------------- -------------- --------------\n");
+
+    int failures = 0;
+    for (size_t p = 0; p < sizeof(parsers) / sizeof(parsers[0]); p++) {
+        if (opts->warmup > 0) parsers[p].run(n, false);
+        double fresh = best_churn_ns(parsers[p].run, n, false, opts->iterations);
+        double reused = best_churn_ns(parsers[p].run, n, true, opts->iterations);
+        if (fresh <= 0 || reused <= 0) {
+            fprintf(out, "%-10s %14s\n", parsers[p].name, "FAILED");
+            failures++;
+            continue;
+        }
+        fprintf(out, "%-10s %14.1f %14.1f %14.1f\n", parsers[p].name, fresh, reused,
+                fresh > reused ? fresh - reused : 0.0);
+    }
+    return failures > 0 ? EXIT_BENCH_FAILURE : 0;
+}
+
+/*
+ * Thread-safety hammer - --hammer N parses every test file from N threads
+ * of one process at once, each thread with its own parsers and starting
+ * at a different file so neighbours parse different inputs, then checks
+ * every parse's counts against the generator. The suite itself only ever
+ * runs one parse per thread; this is what catches shared state inside a
+ * parser. Build with -fsanitize=thread (make benchmark-tsan) to have data
+ * races reported too.
+ */
+#define HAMMER_MAX_THREADS 64
+#define HAMMER_BYTES (256 * 1024)  /* per file, unless --size */
+
+/* gcc defines __SANITIZE_THREAD__; clang only answers __has_feature */
+#if defined(__SANITIZE_THREAD__)
+#define HAMMER_TSAN 1
+#elif defined(__has_feature)
+#if __has_feature(thread_sanitizer)
+#define HAMMER_TSAN 1
+#endif
+#endif
+
+typedef struct {
+    char path[256];
+    size_t size;
+    char delim;
+    gen_counts_t counts;
+} hammer_file_t;
+
+typedef struct {
+    const hammer_file_t *files;
+    size_t num_files;
+    size_t first;  /* index of this thread's first file */
+    int passes;
+    size_t parses[NUM_PARSERS];
+    size_t failed[NUM_PARSERS];
+    size_t miscounted[NUM_PARSERS];
+} hammer_thread_t;
+
+static void *hammer_main(void *arg) {
+    hammer_thread_t *h = (hammer_thread_t *)arg;
+    const bench_runner_t runners[NUM_PARSERS] = {run_sonicsv_benchmark, run_libcsv_benchmark};
+    for (int pass = 0; pass < h->passes; pass++) {
+        for (size_t k = 0; k < h->num_files; k++) {
+            const hammer_file_t *f = &h->files[(h->first + k) % h->num_files];
+            for (size_t p = 0; p < NUM_PARSERS; p++) {
+                bench_state_t state;
+                h->parses[p]++;
+                if (runners[p](f->path, f->size, f->delim, &state) < 0) {
+                    h->failed[p]++;
+                } else if (state.rows_parsed != f->counts.rows ||
+                           state.fields_parsed != f->counts.fields) {
+                    h->miscounted[p]++;
+                }
+            }
+        }
+    }
+    return NULL;
+}
+
+/* Generates one file per distinct test into files[]; false if any failed (*num_files are kept) */
+static bool generate_file_set(const bench_options_t *opts, hammer_file_t *files, size_t *num_files) {
+    const size_t target = opts->target_bytes > 0 ? opts->target_bytes : HAMMER_BYTES;
+    mkdir(g_temp_dir, 0755);
+    *num_files = 0;
+    for (size_t t = 0; t < NUM_TESTS; t++) {
+        const test_config_t *config = &test_configs[t];
+        if (g_duplicate_of[t] >= 0) continue;
+        hammer_file_t *f = &files[*num_files];
+        snprintf(f->path, sizeof(f->path), "%s/%s.csv", g_temp_dir, config->name);
+        f->delim = config->delimiter;
+        f->size = generate_test_file(config, f->path, target, &f->counts);
+        if (f->size == 0) {
+            fprintf(stderr, "Error: cannot generate %s\n", config->name);
+            return false;
+        }
+        (*num_files)++;
+    }
+    return true;
+}
+
+static int run_hammer(const bench_options_t *opts) {
+    FILE *out = opts->report_out;
+    const int threads = opts->hammer_threads;
+    hammer_file_t *files = calloc(NUM_TESTS, sizeof(*files));
+    if (!files) return 1;
+
+    size_t num_files;
+    int result = generate_file_set(opts, files, &num_files) ? 0 : EXIT_BENCH_FAILURE;
+
+    hammer_thread_t hammer[HAMMER_MAX_THREADS];
+    pthread_t tids[HAMMER_MAX_THREADS];
+    int started = 0;
+    uint64_t start = get_time_ns();
+    for (int i = 0; result == 0 && i < threads; i++) {
+        hammer[i] = (hammer_thread_t){
+            .files = files, .num_files = num_files,
+            .first = (size_t)i * num_files / (size_t)threads, .passes = opts->iterations,
+        };
+        int err = pthread_create(&tids[i], NULL, hammer_main, &hammer[i]);
+        if (err != 0) {
+            /* pthread_create returns its error; errno is left alone */
+            fprintf(stderr, "Error: cannot start thread %d: %s\n", i, strerror(err));
+            result = 1;
+            break;
+        }
+        started++;
+    }
+    for (int i = 0; i < started; i++) pthread_join(tids[i], NULL);
+    uint64_t end = get_time_ns();
+
+    for (size_t i = 0; i < num_files; i++) unlink(files[i].path);
+    rmdir(g_temp_dir);
+    free(files);
+    if (result != 0) return result;
+
+    fprintf(out, "THREAD HAMMER (%d threads x %zu files x %d passes, %.1fs)\n", threads, num_files,
+            opts->iterations, (end - start) / 1e9);
+    fprintf(out, "%-10s %10s %10s %10s\n", "Parser", "parses", "failed", "miscounted");
+    fprintf(out, "---------- ---------- ---------- ----------\n");
+    for (size_t p = 0; p < NUM_PARSERS; p++) {
+        size_t parses = 0, failed = 0, miscounted = 0;
+        for (int i = 0; i < threads; i++) {
+            parses += hammer[i].parses[p];
+            failed += hammer[i].failed[p];
+            miscounted += hammer[i].miscounted[p];
+        }
+        fprintf(out, "%-10s %10zu %10zu %10zu\n", parser_caps[p].name, parses, failed, miscounted);
+        if (miscounted > 0) result = EXIT_MISMATCH;
+        else if (failed > 0 && result == 0) result = EXIT_BENCH_FAILURE;
+    }
+#ifdef HAMMER_TSAN
+    fprintf(out, "\nThreadSanitizer build: any data races were reported by its runtime (stderr or log_path).\n");
+#else
+    fprintf(out, "\nNot a ThreadSanitizer build; only wrong results are caught (make benchmark-tsan).\n");
+#endif
+    return result;
+}
+
+/*
+ * Soak - --soak T parses the hammer's file set round-robin for T of wall
+ * time per parser, in SOAK_WINDOWS equal windows. Each window reports
+ * the parse throughput and the resident set at its end, so a leak or
+ * fragmentation that only slows a parser after thousands of parses shows
+ * up as a trend that a few iterations never reach. Every parse is also
+ * checked against the generator's counts.
+ */
+#define SOAK_WINDOWS 12
+#define SOAK_SLOWDOWN_MAX 0.10               /* last window this much slower than the first */
+#define SOAK_RSS_GROWTH_MAX (16 * 1024 * 1024)  /* bytes of RSS gained, first to last window */
+
+static int soak_parser(const bench_options_t *opts, size_t p, bench_runner_t run,
+                       const hammer_file_t *files, size_t num_files) {
+    FILE *out = opts->report_out;
+    const uint64_t window_ns = (uint64_t)(opts->soak_seconds * 1e9 / SOAK_WINDOWS);
+    double first_mbs = 0, last_mbs = 0;
+    size_t first_rss = 0, last_rss = 0, failed = 0, miscounted = 0, next = 0;
+    rss_trend_t trend = {0};
+    bench_state_t state;
+
+    for (int w = 0; w < opts->warmup; w++) {
+        for (size_t k = 0; k < num_files; k++) run(files[k].path, files[k].size, files[k].delim, &state);
+    }
+
+    fprintf(out, "\n%s\n%-6s %9s %9s %12s %8s\n", parser_caps[p].name,
+            "window", "elapsed", "parses", "throughput", "RSS MiB");
+    uint64_t soak_start = get_time_ns();
+    size_t window_start_rss = current_rss_bytes();
+    for (int w = 0; w < SOAK_WINDOWS; w++) {
+        uint64_t window_end = soak_start + (uint64_t)(w + 1) * window_ns;
+        uint64_t parse_ns = 0, bytes = 0;
+        size_t parses = 0;
+        while (get_time_ns() < window_end) {
+            const hammer_file_t *f = &files[next++ % num_files];
+            int64_t e = run(f->path, f->size, f->delim, &state);
+            parses++;
+            if (e < 0) {
+                failed++;
+                continue;
+            }
+            if (state.rows_parsed != f->counts.rows || state.fields_parsed != f->counts.fields) {
+                miscounted++;
+            }
+            parse_ns += (uint64_t)e;
+            bytes += f->size;
+        }
+
+        double mbs = parse_ns > 0 ? bytes * 1e3 / (double)parse_ns : 0;
+        size_t rss = current_rss_bytes();
+        rss_trend_add(&trend, parses, window_start_rss, rss);
+        window_start_rss = rss;
+        if (w == 0) {
+            first_mbs = mbs;
+            first_rss = rss;
+        }
+        last_mbs = mbs;
+        last_rss = rss;
+
+        char rate[16] = "n/a", rss_cell[16] = "-";
+        if (parse_ns > 0) format_rate(rate, sizeof(rate), (double)bytes, parse_ns / 1e9);
+        if (rss > 0) snprintf(rss_cell, sizeof(rss_cell), "%.1f", rss / (1024.0 * 1024.0));
+        fprintf(out, "%6d %8.1fs %9zu %12s %8s\n", w + 1, (get_time_ns() - soak_start) / 1e9,
+                parses, rate, rss_cell);
+        fflush(out);
+    }
+
+    bool slower = first_mbs > 0 && last_mbs < first_mbs * (1 - SOAK_SLOWDOWN_MAX);
+    bool grew = first_rss > 0 && last_rss > first_rss + SOAK_RSS_GROWTH_MAX;
+    fprintf(out, "first to last window: throughput %+.1f%%, RSS %+.1f MiB",
+            first_mbs > 0 ? 100.0 * (last_mbs - first_mbs) / first_mbs : 0.0,
+            ((double)last_rss - (double)first_rss) / (1024.0 * 1024.0));
+    if (slower) fprintf(out, "  SLOWDOWN");
+    if (grew) fprintf(out, "  GROWTH");
+    if (failed > 0) fprintf(out, "  %zu failed", failed);
+    if (miscounted > 0) fprintf(out, "  %zu miscounted", miscounted);
+    char rss_trend[96];
+    format_rss_trend(rss_trend, sizeof(rss_trend), &trend);
+    fprintf(out, "\nRSS trend: %s\n", rss_trend);
+
+    if (miscounted > 0) return EXIT_MISMATCH;
+    if (failed > 0) return EXIT_BENCH_FAILURE;
+    return slower || grew || rss_trend_leaking(&trend) ? EXIT_REGRESSION : 0;
+}
+
+static int run_soak(const bench_options_t *opts) {
+    FILE *out = opts->report_out;
+    hammer_file_t *files = calloc(NUM_TESTS, sizeof(*files));
+    if (!files) return 1;
+
+    size_t num_files;
+    int result = generate_file_set(opts, files, &num_files) ? 0 : EXIT_BENCH_FAILURE;
+    if (result == 0) {
+        fprintf(out, "SOAK (%.0fs per parser in %d windows, %zu files round-robin)\n",
+                opts->soak_seconds, SOAK_WINDOWS, num_files);
+        const bench_runner_t runners[NUM_PARSERS] = {run_sonicsv_benchmark, run_libcsv_benchmark};
+        for (size_t p = 0; p < NUM_PARSERS; p++) {
+            if (parser_excluded(parser_caps[p].name)) continue;
+            int code = soak_parser(opts, p, runners[p], files, num_files);
+            if (code == EXIT_MISMATCH || result == 0) result = code;
+        }
+        fprintf(out, "\nSLOWDOWN = last window over %.0f%% slower than the first; GROWTH = RSS up\n"
+                     "more than %d MiB; the RSS trend is flagged when it only ever rises. Both\n"
+                     "parsers share the process, so RSS is attributed by running them one after\n"
+                     "the other.\n",
+                100 * SOAK_SLOWDOWN_MAX, SOAK_RSS_GROWTH_MAX / (1024 * 1024));
+    }
+
+    for (size_t i = 0; i < num_files; i++) unlink(files[i].path);
+    rmdir(g_temp_dir);
+    free(files);
+    return result;
+}
+
+/*
+ * Self-test - checks the harness before trusting it with a long run: a
+ * small hand-written file and one generated file are parsed by the
+ * reference parser and both real parsers, whose row, field and checksum
+ * results must agree, and the failure path must report a missing file
+ * as a failed run. The health check's forked timeout and crash paths are
+ * driven with a dummy runner that hangs and one that crashes, which must
+ * both be excluded.
+ */
+static const char selftest_csv[] =
+    "id,name,note\n"
+    "1,alpha,\"quoted, comma\"\n"
+    "2,\"be\"\"ta\",plain\n"
+    "3,,\"multi\nline\"\n";
+#define SELFTEST_ROWS   4
+#define SELFTEST_FIELDS 12
+
+static bool selftest_check(FILE *out, bool ok, const char *what, int *passed, int *total) {
+    fprintf(out, "  %-4s  %s\n", ok ? "ok" : "FAIL", what);
+    *passed += ok;
+    (*total)++;
+    return ok;
+}
+
+/* A count or agreement check, whose failure is a mismatch rather than a harness fault */
+static bool selftest_check_counts(FILE *out, bool ok, const char *what, int *passed, int *total,
+                                  int *mismatched) {
+    *mismatched += !ok;
+    return selftest_check(out, ok, what, passed, total);
+}
+
+static bool selftest_agree(const bench_state_t *a, const bench_state_t *b) {
+    return a->rows_parsed == b->rows_parsed && a->fields_parsed == b->fields_parsed &&
+           a->checksum == b->checksum;
+}
+
+/* Stand-ins for a parser that hangs and one that crashes, for the health check */
+static int64_t selftest_hanging_runner(const char *filepath, size_t file_size, char delim,
+                                       bench_state_t *state) {
+    (void)filepath; (void)file_size; (void)delim; (void)state;
+    for (;;) pause();  /* until the health check's alarm ends the child */
+    return -1;
+}
+
+static int64_t selftest_crashing_runner(const char *filepath, size_t file_size, char delim,
+                                        bench_state_t *state) {
+    (void)filepath; (void)file_size; (void)delim; (void)state;
+    raise(SIGSEGV);
+    return -1;
+}
+
+static int run_selftest(const bench_options_t *opts) {
+    FILE *out = opts->report_out;
+    int passed = 0, total = 0, mismatched = 0;
+    char path[256], what[160];
+    bench_state_t ref, sonicsv, libcsv;
+
+    mkdir(g_temp_dir, 0755);
+    snprintf(path, sizeof(path), "%s/selftest.csv", g_temp_dir);
+    fprintf(out, "SELFTEST (%s)\n", g_temp_dir);
+
+    FILE *f = fopen(path, "wb");
+    bool written = f && fwrite(selftest_csv, 1, sizeof(selftest_csv) - 1, f) == sizeof(selftest_csv) - 1;
+    if (f && fclose(f) != 0) written = false;
+    if (selftest_check(out, written, "write hand-written dataset", &passed, &total)) {
+        size_t size = sizeof(selftest_csv) - 1;
+        run_reference_parser(path, size, ',', &ref);
+        snprintf(what, sizeof(what), "reference parser: %llu rows, %llu fields (expected %d, %d)",
+                 (unsigned long long)ref.rows_parsed, (unsigned long long)ref.fields_parsed,
+                 SELFTEST_ROWS, SELFTEST_FIELDS);
+        selftest_check_counts(out,
+                              ref.rows_parsed == SELFTEST_ROWS && ref.fields_parsed == SELFTEST_FIELDS,
+                              what, &passed, &total, &mismatched);
+        selftest_check_counts(out, run_sonicsv_benchmark(path, size, ',', &sonicsv) >= 0 &&
+                                   selftest_agree(&sonicsv, &ref),
+                              "SonicSV matches reference (rows, fields, checksum)",
+                              &passed, &total, &mismatched);
+        selftest_check_counts(out, run_libcsv_benchmark(path, size, ',', &libcsv) >= 0 &&
+                                   selftest_agree(&libcsv, &ref),
+                              "libcsv matches reference (rows, fields, checksum)",
+                              &passed, &total, &mismatched);
+    }
+    unlink(path);
+
+    /* The generator's own counts are what every real test validates
+     * against; quoted_mixed covers quotes, embedded delimiters and newlines */
+    const test_config_t *config = &test_configs[0];
+    for (size_t t = 0; t < NUM_TESTS; t++) {
+        if (strcmp(test_configs[t].name, "quoted_mixed") == 0) config = &test_configs[t];
+    }
+    gen_counts_t counts;
+    size_t size = generate_test_file(config, path, 64 * 1024, &counts);
+    if (selftest_check(out, size > 0, "generate a 64 KiB quoted_mixed file", &passed, &total)) {
+        run_reference_parser(path, size, config->delimiter, &ref);
+        snprintf(what, sizeof(what), "generator counts match reference (%llu rows, %llu fields)",
+                 (unsigned long long)counts.rows, (unsigned long long)counts.fields);
+        selftest_check_counts(out, ref.rows_parsed == counts.rows && ref.fields_parsed == counts.fields,
+                              what, &passed, &total, &mismatched);
+        selftest_check_counts(out, run_sonicsv_benchmark(path, size, config->delimiter, &sonicsv) >= 0 &&
+                                   selftest_agree(&sonicsv, &ref),
+                              "SonicSV matches reference on generated data",
+                              &passed, &total, &mismatched);
+        selftest_check_counts(out, run_libcsv_benchmark(path, size, config->delimiter, &libcsv) >= 0 &&
+                                   selftest_agree(&libcsv, &ref),
+                              "libcsv matches reference on generated data",
+                              &passed, &total, &mismatched);
+    }
+    unlink(path);
+
+    /* Failure path: the runners must report a missing file, not time it */
+    fprintf(out, "  (the next two checks print expected errors)\n");
+    fflush(out);
+    snprintf(path, sizeof(path), "%s/missing.csv", g_temp_dir);
+    selftest_check(out, run_sonicsv_benchmark(path, 0, ',', &sonicsv) < 0,
+                   "SonicSV reports a missing file as failed", &passed, &total);
+    selftest_check(out, run_libcsv_benchmark(path, 0, ',', &libcsv) < 0,
+                   "libcsv reports a missing file as failed", &passed, &total);
+
+    /* Health check: a hanging and a crashing runner, in the SonicSV and
+     * libcsv slots, must both be reported and excluded from the run */
+    fprintf(out, "  (the next check runs a hanging and a crashing dummy parser)\n");
+    fflush(out);
+    const bench_runner_t dummies[NUM_PARSERS] = {selftest_hanging_runner, selftest_crashing_runner};
+    size_t excluded = smoke_check(out, dummies, 1);
+    snprintf(what, sizeof(what), "health check excludes a hanging runner (%s)",
+             g_unhealthy[0][0] ? g_unhealthy[0] : "not excluded");
+    selftest_check(out, excluded == 2 && strncmp(g_unhealthy[0], "timed out", 9) == 0 &&
+                        parser_excluded(parser_caps[0].name),
+                   what, &passed, &total);
+    snprintf(what, sizeof(what), "health check excludes a crashing runner (%s)",
+             g_unhealthy[1][0] ? g_unhealthy[1] : "not excluded");
+    selftest_check(out, strncmp(g_unhealthy[1], "crashed", 7) == 0 && parser_excluded(parser_caps[1].name),
+                   what, &passed, &total);
+    for (size_t p = 0; p < NUM_PARSERS; p++) g_unhealthy[p][0] = '\0';
+
+    /* Timing: the clock must advance and the stats must add up */
+    timing_stats_t stats;
+    stats_init(&stats);
+    uint64_t t0 = get_time_ns();
+    stats_add(&stats, 1000);
+    stats_add(&stats, 3000);
+    selftest_check(out, get_time_ns() >= t0 && stats.min == 1000 && stats.max == 3000 &&
+                        fabs(stats_mean(&stats) - 2e-6) < 1e-12,
+                   "monotonic clock and timing stats", &passed, &total);
+
+    rmdir(g_temp_dir);
+    fprintf(out, "\nHarness health: %d/%d checks passed\n", passed, total);
+    /* Wrong counts are a mismatch; any other failed check means the harness itself is broken */
+    return mismatched > 0 ? EXIT_MISMATCH : passed < total ? EXIT_BENCH_FAILURE : 0;
+}
+
+/*
+ * Golden outputs - the generator is seeded, so every test capped at
+ * GOLDEN_ROWS rows always produces the same file, and GOLDEN_FILE holds
+ * the row and field counts a correct parse of each reports. --golden
+ * runs the generator's own counts and every harness (reference,
+ * SonicSV, libcsv) against it: a harness that counts wrong would
+ * otherwise publish throughput for work it didn't do. --write-golden
+ * regenerates the file after an intended generator change, and only
+ * when all four agree, so a buggy harness can't become the reference.
+ * Either takes =PATH; by default the file is looked up next to the source
+ * tree the binary sits in (build/../benchmark/golden.txt), then relative
+ * to the current directory, so it works from outside the repo root.
+ */
+#define GOLDEN_FILE "benchmark/golden.txt"
+#define GOLDEN_ROWS 1000
+
+typedef struct {
+    char name[64];
+    uint64_t rows;
+    uint64_t fields;
+} golden_entry_t;
+
+static size_t load_golden(const char *path, golden_entry_t *entries, size_t max) {
+    FILE *f = fopen(path, "r");
+    if (!f) return 0;
+    size_t count = 0;
+    char line[256];
+    while (count < max && fgets(line, sizeof(line), f)) {
+        golden_entry_t *e = &entries[count];
+        unsigned long long rows, fields;
+        if (line[0] == '#' || sscanf(line, "%63s %llu %llu", e->name, &rows, &fields) != 3) continue;
+        e->rows = rows;
+        e->fields = fields;
+        count++;
+    }
+    fclose(f);
+    return count;
+}
+
+static void golden_cell(char *cell, size_t size, bool ran, uint64_t rows, uint64_t fields,
+                        const golden_entry_t *want, size_t *bad) {
+    if (!ran) {
+        snprintf(cell, size, "FAILED");
+    } else if (want && rows == want->rows && fields == want->fields) {
+        snprintf(cell, size, "ok");
+        return;
+    } else {
+        snprintf(cell, size, "%llu/%llu", (unsigned long long)rows, (unsigned long long)fields);
+    }
+    (*bad)++;
+}
+
+/* GOLDEN_FILE beside the binary's source tree if it exists there, else as given */
+static void default_golden_path(char *out, size_t size) {
+    char exe[PATH_MAX];
+    char *slash;
+    if (self_exe_path(exe, sizeof(exe)) && (slash = strrchr(exe, '/')) != NULL) {
+        *slash = '\0';
+        snprintf(out, size, "%s/../%s", exe, GOLDEN_FILE);
+        if (access(out, F_OK) == 0) return;
+    }
+    snprintf(out, size, "%s", GOLDEN_FILE);
+}
+
+static int run_golden(const bench_options_t *opts, bool record) {
+    FILE *out = opts->report_out;
+    char path[PATH_MAX + 32];
+    if (opts->golden_path) {
+        snprintf(path, sizeof(path), "%s", opts->golden_path);
+    } else {
+        default_golden_path(path, sizeof(path));
+    }
+    golden_entry_t golden[NUM_TESTS];
+    size_t num_golden = record ? 0 : load_golden(path, golden, NUM_TESTS);
+    if (!record && num_golden == 0) {
+        fprintf(stderr, "Error: --golden: no counts in %s (create it with --write-golden)\n", path);
+        return 1;
+    }
+    FILE *gf = NULL;
+    if (record) {
+        gf = fopen(path, "w");
+        if (!gf) {
+            fprintf(stderr, "Error: Cannot open %s: %s\n", path, strerror(errno));
+            return 1;
+        }
+        fprintf(gf, "# Rows and fields of each test at up to %d rows (fixed generator seed);\n"
+                    "# checked with --golden, regenerate with --write-golden\n", GOLDEN_ROWS);
+    }
+    mkdir(g_temp_dir, 0755);
+
+    fprintf(out, "GOLDEN OUTPUTS (%s, each test capped at %d rows; rows/fields shown where wrong)\n\n",
+            path, GOLDEN_ROWS);
+    fprintf(out, "%-4s %-18s %-16s %-16s %-16s %s\n", "#", "Test", "generator", "reference", "SonicSV", "libcsv");
+    fprintf(out, "---- ------------------ ---------------- ---------------- ---------------- ----------------\n");
+
+    size_t bad = 0, failures = 0;
+    for (size_t t = 0; t < NUM_TESTS; t++) {
+        test_config_t config = test_configs[t];
+        if (config.rows > GOLDEN_ROWS) config.rows = GOLDEN_ROWS;
+        char filepath[256];
+        snprintf(filepath, sizeof(filepath), "%s/%s.csv", g_temp_dir, config.name);
+        gen_counts_t counts;
+        size_t file_size = generate_test_file(&config, filepath, 0, &counts);
+        if (file_size == 0) {
+            fprintf(stderr, "[%2zu] %-18s FAILED (data generation)\n", t + 1, config.name);
+            failures++;
+            continue;
+        }
+
+        bench_state_t ref, sonicsv, libcsv;
+        bool ref_ran = run_reference_parser(filepath, file_size, config.delimiter, &ref) >= 0;
+        bool s_ran = run_sonicsv_benchmark(filepath, file_size, config.delimiter, &sonicsv) >= 0;
+        bool l_ran = run_libcsv_benchmark(filepath, file_size, config.delimiter, &libcsv) >= 0;
+        unlink(filepath);
+
+        /* Recording takes the generator's counts, but only if every harness agrees with them */
+        golden_entry_t recorded = {"", counts.rows, counts.fields};
+        const golden_entry_t *want = &recorded;
+        if (!record) {
+            want = NULL;
+            for (size_t g = 0; g < num_golden; g++) {
+                if (strcmp(golden[g].name, config.name) == 0) want = &golden[g];
+            }
+        }
+        char cells[4][24];
+        size_t before = bad;
+        golden_cell(cells[0], sizeof(cells[0]), true, counts.rows, counts.fields, want, &bad);
+        golden_cell(cells[1], sizeof(cells[1]), ref_ran, ref.rows_parsed, ref.fields_parsed, want, &bad);
+        golden_cell(cells[2], sizeof(cells[2]), s_ran, sonicsv.rows_parsed, sonicsv.fields_parsed, want, &bad);
+        golden_cell(cells[3], sizeof(cells[3]), l_ran, libcsv.rows_parsed, libcsv.fields_parsed, want, &bad);
+        fprintf(out, "[%2zu] %-18s %-16s %-16s %-16s %s%s\n", t + 1, config.name,
+                cells[0], cells[1], cells[2], cells[3], want ? "" : "  (not in golden file)");
+        if (gf && bad == before) {
+            fprintf(gf, "%s %llu %llu\n", config.name, (unsigned long long)counts.rows,
+                    (unsigned long long)counts.fields);
+        }
+    }
+    rmdir(g_temp_dir);
+
+    if (gf) {
+        fclose(gf);
+        if (bad > 0 || failures > 0) {
+            fprintf(out, "\nHarnesses disagree with the generator; %s left without those tests.\n", path);
+        } else {
+            fprintf(stderr, "Wrote %s\n", path);
+        }
+    } else if (bad > 0) {
+        fprintf(out, "\nA harness off the golden counts is measuring the wrong work; fix it before\n"
+                     "trusting its throughput (or --write-golden if the generator changed on purpose).\n");
+    }
+    return bad > 0 ? EXIT_MISMATCH : failures > 0 ? EXIT_BENCH_FAILURE : 0;
+}
+
+/*
+ * Report mode - re-renders a saved --benchstat file without running
+ * anything: one row per parser/test with the mean, min and max of one
+ * metric, filtered by --parser and --scenario globs (case-insensitive).
+ */
+#define REPORT_MAX_ROWS 1024
+
+typedef struct {
+    char name[128];  /* "SonicSV/tiny_simple" */
+    double sum, min, max;
+    size_t count;
+} report_row_t;
+
+/* Finds unit in the value/unit pairs after a benchstat line's name and count */
+static bool benchstat_metric(char *rest, const char *unit, double *value) {
+    char *save = NULL;
+    char *tok = strtok_r(rest, " \t", &save);  /* iteration count */
+    while (tok && (tok = strtok_r(NULL, " \t", &save)) != NULL) {
+        char *unit_tok = strtok_r(NULL, " \t", &save);
+        if (unit_tok && strcmp(unit_tok, unit) == 0) {
+            *value = atof(tok);
+            return true;
+        }
+        tok = unit_tok;
+    }
+    return false;
+}
+
+static int run_report(const bench_options_t *opts) {
+    FILE *f = fopen(opts->report_path, "r");
+    if (!f) {
+        fprintf(stderr, "Error: Cannot open %s: %s\n", opts->report_path, strerror(errno));
+        return 1;
+    }
+
+    static report_row_t rows[REPORT_MAX_ROWS];
+    size_t num_rows = 0;
+    char line[512];
+    while (fgets(line, sizeof(line), f)) {
+        if (strncmp(line, "Benchmark", 9) != 0) continue;
+        trim_newline(line);
+
+        char *name = line + 9;
+        char *rest = name + strcspn(name, " \t");
+        if (*rest == '\0') continue;
+        *rest++ = '\0';
+
+        char *slash = strchr(name, '/');
+        if (!slash) continue;
+        *slash = '\0';
+        bool wanted = glob_matches(opts->parser_glob, name) &&
+                      glob_matches(opts->scenario_glob, slash + 1);
+        *slash = '/';
+
+        double value;
+        if (!wanted || !benchstat_metric(rest, opts->metric, &value)) continue;
+
+        size_t r = 0;
+        while (r < num_rows && strcmp(rows[r].name, name) != 0) r++;
+        if (r == num_rows) {
+            if (num_rows == REPORT_MAX_ROWS) continue;
+            num_rows++;
+            copy_value(rows[r].name, sizeof(rows[r].name), name);
+            rows[r].sum = 0;
+            rows[r].count = 0;
+            rows[r].min = rows[r].max = value;
+        }
+        rows[r].sum += value;
+        rows[r].count++;
+        if (value < rows[r].min) rows[r].min = value;
+        if (value > rows[r].max) rows[r].max = value;
+    }
+    fclose(f);
+
+    FILE *out = opts->report_out;
+    fprintf(out, "%s: %s\n\n", opts->report_path, opts->metric);
+    fprintf(out, "%-34s %12s %12s %12s %5s\n", "Benchmark", "mean", "min", "max", "n");
+    fprintf(out, "---------------------------------- ------------ ------------ ------------ -----\n");
+    for (size_t r = 0; r < num_rows; r++) {
+        fprintf(out, "%-34s %12.2f %12.2f %12.2f %5zu\n", rows[r].name,
+                rows[r].sum / rows[r].count, rows[r].min, rows[r].max, rows[r].count);
+    }
+    if (num_rows == 0) {
+        fprintf(out, "(no results match)\n");
+    }
+    return 0;
+}
+
+/*
+ * Ranking stability - for each test, Kendall's tau between the parser
+ * orderings (by mean MB/s) of every pair of merged runs. 1.00 means every
+ * run ranked the parsers the same way; anything lower means "#1 vs #2"
+ * on that test flips between runs and shouldn't be read as a result.
+ */
+static void print_ranking_stability(FILE *out, const baseline_t *runs, int num_runs) {
+    if (num_runs < 2) return;
+
+    double tau_sum = 0;
+    size_t tau_tests = 0, unstable = 0;
+    bool header = false;
+
+    /* tests are taken from the first run; e->name is "Parser/test" */
+    for (size_t e = 0; e < runs[0].count; e++) {
+        const char *test = strchr(runs[0].entries[e].name, '/');
+        if (!test) continue;
+        bool seen = false;
+        for (size_t k = 0; k < e && !seen; k++) {
+            const char *other = strchr(runs[0].entries[k].name, '/');
+            seen = other && strcmp(other, test) == 0;
+        }
+        if (seen) continue;
+
+        /* parsers with this test in the first run */
+        char parsers[8][32];
+        size_t num_parsers = 0;
+        for (size_t k = e; k < runs[0].count && num_parsers < 8; k++) {
+            const char *name = runs[0].entries[k].name;
+            const char *slash = strchr(name, '/');
+            if (slash && strcmp(slash, test) == 0) {
+                snprintf(parsers[num_parsers++], sizeof(parsers[0]), "%.*s", (int)(slash - name), name);
+            }
+        }
+        if (num_parsers < 2) continue;
+
+        long concordant = 0, discordant = 0;
+        for (int a = 0; a < num_runs; a++) {
+            for (int b = a + 1; b < num_runs; b++) {
+                for (size_t x = 0; x < num_parsers; x++) {
+                    for (size_t y = x + 1; y < num_parsers; y++) {
+                        double da = baseline_mbps(&runs[a], parsers[x], test + 1) -
+                                    baseline_mbps(&runs[a], parsers[y], test + 1);
+                        double db = baseline_mbps(&runs[b], parsers[x], test + 1) -
+                                    baseline_mbps(&runs[b], parsers[y], test + 1);
+                        if (da * db > 0) concordant++;
+                        else if (da * db < 0) discordant++;
+                    }
+                }
+            }
+        }
+        if (concordant + discordant == 0) continue;
+
+        double tau = (double)(concordant - discordant) / (concordant + discordant);
+        tau_sum += tau;
+        tau_tests++;
+        if (tau < 1.0) {
+            if (!header) {
+                fprintf(out, "\nRANKING FLIPS BETWEEN RUNS (Kendall tau per test, 1.00 = stable)\n");
+                header = true;
+            }
+            fprintf(out, "%-23s %6.2f\n", test + 1, tau);
+            unstable++;
+        }
+    }
+
+    if (tau_tests == 0) return;
+    fprintf(out, "\nRanking confidence: mean tau %.2f over %zu tests and %d runs; ",
+            tau_sum / tau_tests, tau_tests, num_runs);
+    if (unstable == 0) {
+        fprintf(out, "the parser order never changed.\n");
+    } else {
+        fprintf(out, "%zu test(s) changed order, so their winner is not a real distinction.\n", unstable);
+    }
+}
+
+/*
+ * Merge mode - pools the results of repeated runs of the same
+ * configuration into one benchstat file (then summarized as in --report),
+ * raising the sample count without longer individual runs. Inputs must
+ * share the first file's machine fingerprint unless --force-compare.
+ */
+static int run_merge(const bench_options_t *opts) {
+    const int num_runs = opts->num_merge_inputs;
+    baseline_t *runs = calloc((size_t)num_runs, sizeof(*runs));
+    if (!runs) return 1;
+
+    int status = 1;
+    int loaded = 0;
+    for (; loaded < num_runs; loaded++) {
+        if (!load_baseline(opts->merge_inputs[loaded], &runs[loaded])) goto done;
+        if (loaded > 0 && report_fingerprint_mismatch(&runs[0].machine, &runs[loaded].machine)) {
+            fprintf(stderr, "  (%s vs %s)\n", opts->merge_inputs[0], opts->merge_inputs[loaded]);
+            if (!opts->force_compare) {
+                fprintf(stderr, "Refusing to merge across machines; pass --force-compare to override.\n");
+                loaded++;
+                goto done;
+            }
+        }
+    }
+
+    FILE *out = fopen(opts->merge_path, "w");
+    if (!out) {
+        fprintf(stderr, "Error: Cannot open %s: %s\n", opts->merge_path, strerror(errno));
+        goto done;
+    }
+
+    size_t results = 0;
+    for (int i = 0; i < opts->num_merge_inputs; i++) {
+        FILE *in = fopen(opts->merge_inputs[i], "r");
+        if (!in) continue;  /* load_baseline() already opened it once */
+        char line[512];
+        while (fgets(line, sizeof(line), in)) {
+            bool is_result = strncmp(line, "Benchmark", 9) == 0;
+            if (is_result) results++;
+            /* the header (goos, cpu, ...) is taken from the first file only */
+            if (is_result || i == 0) fputs(line, out);
+        }
+        fclose(in);
+    }
+    fclose(out);
+
+    fprintf(stderr, "Merged %d files (%zu results) into %s\n",
+            opts->num_merge_inputs, results, opts->merge_path);
+
+    bench_options_t summary = *opts;
+    summary.report_path = opts->merge_path;
+    status = run_report(&summary);
+    print_ranking_stability(opts->report_out, runs, num_runs);
+
+done:
+    for (int i = 0; i < loaded; i++) free(runs[i].entries);
+    free(runs);
+    return status;
+}
+
+/*
+ * Share mode - --share OUT FILE turns a --benchstat file into a bundle
+ * for the community leaderboard, scrubbed of anything that identifies
+ * the machine or its owner. The schema (version 1) is a benchstat file:
+ *
+ *   schema: sonicsv-share/1
+ *   goos, goarch, pkg, cpu, memory, cores, simd, isa, core-class,
+ *   governor, turbo, commit, describe  - copied verbatim when present
+ *   kernel: <os> <arch>      - the kernel release is dropped
+ *   Benchmark<Parser>/<test> lines, unchanged
+ *
+ * Every other header line (binary hashes, anything added later) is left
+ * out, so new keys have to be added here deliberately to be shared.
+ */
+#define SHARE_SCHEMA "sonicsv-share/1"
+
+static const char *const share_keys[] = {
+    "goos", "goarch", "pkg", "cpu", "memory", "cores", "simd", "isa", "core-class",
+    "governor", "turbo", "commit", "describe",
+};
+
+static int run_share(const bench_options_t *opts) {
+    if (!opts->share_input) {
+        fprintf(stderr, "Error: --share needs a --benchstat file to export\n");
+        return 1;
+    }
+    FILE *in = fopen(opts->share_input, "r");
+    if (!in) {
+        fprintf(stderr, "Error: Cannot open %s: %s\n", opts->share_input, strerror(errno));
+        return 1;
+    }
+    FILE *out = fopen(opts->share_path, "w");
+    if (!out) {
+        fprintf(stderr, "Error: Cannot open %s: %s\n", opts->share_path, strerror(errno));
+        fclose(in);
+        return 1;
+    }
+
+    fprintf(out, "schema: %s\n", SHARE_SCHEMA);
+    size_t results = 0, dropped = 0;
+    char line[512];
+    while (fgets(line, sizeof(line), in)) {
+        if (strncmp(line, "Benchmark", 9) == 0) {
+            fputs(line, out);
+            results++;
+            continue;
+        }
+        const char *colon = strstr(line, ": ");
+        if (!colon) continue;
+        size_t key_len = (size_t)(colon - line);
+
+        if (key_len == 6 && strncmp(line, "kernel", 6) == 0) {
+            /* "Linux 6.8.0-45-generic x86_64": keep the OS and the arch */
+            char os[32] = "", arch[32] = "", *last = strrchr(line, ' ');
+            sscanf(colon + 2, "%31s", os);
+            if (last) sscanf(last + 1, "%31s", arch);
+            fprintf(out, "kernel: %s %s\n", os, arch);
+            continue;
+        }
+        bool keep = false;
+        for (size_t i = 0; i < sizeof(share_keys) / sizeof(share_keys[0]); i++) {
+            if (strlen(share_keys[i]) == key_len && strncmp(line, share_keys[i], key_len) == 0) {
+                keep = true;
+                break;
+            }
+        }
+        if (keep) {
+            fputs(line, out);
+        } else {
+            dropped++;
+        }
+    }
+    fclose(in);
+    fclose(out);
+
+    if (results == 0) {
+        fprintf(stderr, "Error: %s has no benchmark results\n", opts->share_input);
+        remove(opts->share_path);
+        return 1;
+    }
+    fprintf(stderr, "Wrote %s (%zu results, %zu header lines withheld)\n",
+            opts->share_path, results, dropped);
+    return 0;
+}
+
+/*
+ * Aggregate mode - --aggregate FILE... reads many --share bundles (any
+ * benchstat file works) and groups them by CPU model into the hardware
+ * matrix behind the published benchmarks. Each test's figure for a model
+ * is the median over its bundles of the per-bundle mean SonicSV MB/s;
+ * the model's overall figure is the median of those across tests, so one
+ * odd submission or one outlier test doesn't move it.
+ */
+#define AGG_MAX_MODELS 64
+#define AGG_MAX_TESTS 128
+#define AGG_MAX_COLUMNS 8   /* models shown side by side in the per-test matrix */
+
+typedef struct {
+    char cpu[128];
+    char simd[48];
+    int bundles;
+    double *mbps;      /* [AGG_MAX_TESTS][bundles]: SonicSV mean MB/s per bundle */
+    double *speedup;   /* same layout: SonicSV over libcsv */
+    int *counts;       /* [AGG_MAX_TESTS] entries filled in mbps/speedup */
+    double median;     /* median over tests of the per-test medians */
+    double median_speedup;
+} agg_model_t;
+
+static int compare_double(const void *a, const void *b) {
+    double x = *(const double *)a, y = *(const double *)b;
+    return (x > y) - (x < y);
+}
+
+/* Median of n values (sorted in place); 0 for none */
+static double median_double(double *v, int n) {
+    if (n == 0) return 0;
+    qsort(v, (size_t)n, sizeof(v[0]), compare_double);
+    return n % 2 ? v[n / 2] : (v[n / 2 - 1] + v[n / 2]) / 2;
+}
+
+static int compare_models(const void *a, const void *b) {
+    const agg_model_t *x = a, *y = b;
+    return (y->median > x->median) - (y->median < x->median);
+}
+
+static int run_aggregate(const bench_options_t *opts) {
+    const int num_files = opts->num_merge_inputs;
+    FILE *out = opts->report_out;
+    agg_model_t *models = calloc(AGG_MAX_MODELS, sizeof(*models));
+    char (*tests)[96] = calloc(AGG_MAX_TESTS, sizeof(*tests));
+    if (!models || !tests) {
+        free(models);
+        free(tests);
+        return 1;
+    }
+    int num_models = 0, num_tests = 0, used = 0;
+
+    for (int f = 0; f < num_files; f++) {
+        baseline_t b;
+        if (!load_baseline(opts->merge_inputs[f], &b)) continue;
+
+        int m = 0;
+        while (m < num_models && strcmp(models[m].cpu, b.machine.cpu) != 0) m++;
+        if (m == num_models) {
+            if (num_models == AGG_MAX_MODELS) {
+                fprintf(stderr, "Warning: more than %d CPU models; skipping %s\n",
+                        AGG_MAX_MODELS, opts->merge_inputs[f]);
+                free(b.entries);
+                continue;
+            }
+            agg_model_t *nm = &models[num_models++];
+            copy_value(nm->cpu, sizeof(nm->cpu), b.machine.cpu[0] ? b.machine.cpu : "unknown");
+            copy_value(nm->simd, sizeof(nm->simd), b.machine.simd[0] ? b.machine.simd : "-");
+            nm->mbps = calloc((size_t)AGG_MAX_TESTS * num_files, sizeof(double));
+            nm->speedup = calloc((size_t)AGG_MAX_TESTS * num_files, sizeof(double));
+            nm->counts = calloc(AGG_MAX_TESTS, sizeof(int));
+            if (!nm->mbps || !nm->speedup || !nm->counts) {
+                free(b.entries);
+                break;
+            }
+        }
+        agg_model_t *model = &models[m];
+
+        bool any = false;
+        for (size_t i = 0; i < b.count; i++) {
+            const char *test = b.entries[i].name + 8;  /* past "SonicSV/" */
+            if (strncmp(b.entries[i].name, "SonicSV/", 8) != 0) continue;
+
+            int t = 0;
+            while (t < num_tests && strcmp(tests[t], test) != 0) t++;
+            if (t == num_tests) {
+                if (num_tests == AGG_MAX_TESTS) continue;
+                copy_value(tests[num_tests++], sizeof(tests[0]), test);
+            }
+            double s = baseline_mbps(&b, "SonicSV", test);
+            double l = baseline_mbps(&b, "Libcsv", test);
+            int k = model->counts[t]++;
+            model->mbps[(size_t)t * num_files + k] = s;
+            model->speedup[(size_t)t * num_files + k] = l > 0 ? s / l : 0;
+            any = true;
+        }
+        if (any) {
+            model->bundles++;
+            used++;
+        } else {
+            fprintf(stderr, "Warning: %s has no SonicSV results\n", opts->merge_inputs[f]);
+        }
+        free(b.entries);
+    }
+
+    /* Per-test medians replace each test's samples in place at index 0 */
+    for (int m = 0; m < num_models; m++) {
+        agg_model_t *model = &models[m];
+        double medians[AGG_MAX_TESTS], speedups[AGG_MAX_TESTS];
+        int n = 0;
+        for (int t = 0; t < num_tests; t++) {
+            if (!model->counts || model->counts[t] == 0) continue;
+            double *v = &model->mbps[(size_t)t * num_files];
+            double *sp = &model->speedup[(size_t)t * num_files];
+            v[0] = median_double(v, model->counts[t]);
+            sp[0] = median_double(sp, model->counts[t]);
+            medians[n] = v[0];
+            speedups[n++] = sp[0];
+        }
+        model->median = median_double(medians, n);
+        model->median_speedup = median_double(speedups, n);
+    }
+    qsort(models, (size_t)num_models, sizeof(models[0]), compare_models);
+
+    fprintf(out, "HARDWARE MATRIX (%d bundles, %d CPU models; median SonicSV MB/s, 10^6 bytes)\n",
+            used, num_models);
+    fprintf(out, "%-4s %-40s %-22s %7s %10s %8s\n", "#", "CPU", "SIMD", "bundles", "SonicSV", "speedup");
+    fprintf(out, "---- ---------------------------------------- ---------------------- ------- ---------- --------\n");
+    for (int m = 0; m < num_models; m++) {
+        if (models[m].bundles == 0) continue;
+        char label[16];
+        snprintf(label, sizeof(label), "[%d]", m + 1);
+        fprintf(out, "%-4s %-40.40s %-22.22s %7d %10.1f %7.2fx\n", label, models[m].cpu,
+                models[m].simd, models[m].bundles, models[m].median, models[m].median_speedup);
+    }
+
+    int columns = num_models < AGG_MAX_COLUMNS ? num_models : AGG_MAX_COLUMNS;
+    if (columns > 0 && num_tests > 0) {
+        fprintf(out, "\nPer test (median SonicSV MB/s; columns are the models above)\n");
+        fprintf(out, "%-23s", "Test");
+        for (int m = 0; m < columns; m++) {
+            char label[16];
+            snprintf(label, sizeof(label), "[%d]", m + 1);
+            fprintf(out, " %9s", label);
+        }
+        fprintf(out, "\n");
+        for (int t = 0; t < num_tests; t++) {
+            fprintf(out, "%-23s", tests[t]);
+            for (int m = 0; m < columns; m++) {
+                if (models[m].counts && models[m].counts[t] > 0) {
+                    fprintf(out, " %9.1f", models[m].mbps[(size_t)t * num_files]);
+                } else {
+                    fprintf(out, " %9s", "-");
+                }
+            }
+            fprintf(out, "\n");
+        }
+        if (num_models > columns) {
+            fprintf(out, "(%d more models not shown; see the table above)\n", num_models - columns);
+        }
+    }
+    print_attribution(out);
+
+    for (int m = 0; m < num_models; m++) {
+        free(models[m].mbps);
+        free(models[m].speedup);
+        free(models[m].counts);
+    }
+    free(models);
+    free(tests);
+    return used > 0 ? 0 : 1;
+}
+
+/*
+ * Competitor lockfile - benchmark.lock records exactly which source of
+ * each parser a run measured: SonicSV by the hash of the sonicsv.h it was
+ * compiled from, libcsv by its version and the hash of the shared library
+ * actually loaded. --lock writes it, --bundle keeps a copy with the run,
+ * and --locked refuses to run when this build's parsers differ from it,
+ * so a published comparison can be reproduced against the same code. A
+ * "static" or "unknown" hash on either side can't be checked, so
+ * --locked refuses those too.
+ */
+#define LOCK_FILE "benchmark.lock"
+
+typedef struct {
+    const char *name;
+    char version[32];
+    char sha256[72];   /* "sha256:<hex>", "static" or "unknown" */
+} lock_entry_t;
+
+/* True for libcsv.so, libcsv.so.3... or libcsv.dylib, libcsv.3.dylib..., not libcsvkit etc. */
+static bool is_libcsv_library(const char *path) {
+    const char *slash = strrchr(path, '/');
+    const char *base = slash ? slash + 1 : path;
+    if (strncmp(base, "libcsv.so", 9) == 0) return base[9] == '\0' || base[9] == '.';
+    size_t len = strlen(base);
+    return strncmp(base, "libcsv.", 7) == 0 && len >= 13 && strcmp(base + len - 6, ".dylib") == 0;
+}
+
+/* Path of the loaded libcsv shared object; false when linked statically */
+static bool libcsv_library_path(char *out, size_t size) {
+#if defined(__linux__)
+    FILE *f = fopen("/proc/self/maps", "r");
+    if (!f) return false;
+    char line[PATH_MAX + 128];
+    bool found = false;
+    while (!found && fgets(line, sizeof(line), f)) {
+        char *path = strchr(line, '/');
+        if (!path) continue;
+        trim_newline(path);
+        if (is_libcsv_library(path)) {
+            copy_value(out, size, path);
+            found = true;
+        }
+    }
+    fclose(f);
+    return found;
+#elif defined(__APPLE__)
+    for (uint32_t i = 0; i < _dyld_image_count(); i++) {
+        const char *name = _dyld_get_image_name(i);
+        if (name && is_libcsv_library(name)) {
+            copy_value(out, size, name);
+            return true;
+        }
+    }
+    return false;
+#else
+    (void)out; (void)size;
+    return false;
+#endif
+}
+
+static void collect_lock_entries(lock_entry_t entries[2]) {
+    entries[0].name = "sonicsv";
+    snprintf(entries[0].version, sizeof(entries[0].version), "%d.%d.%d",
+             SONICSV_VERSION_MAJOR, SONICSV_VERSION_MINOR, SONICSV_VERSION_PATCH);
+    if (strcmp(SONICSV_SOURCE_SHA256, "unknown") == 0) {
+        snprintf(entries[0].sha256, sizeof(entries[0].sha256), "unknown");
+    } else {
+        snprintf(entries[0].sha256, sizeof(entries[0].sha256), "sha256:%s", SONICSV_SOURCE_SHA256);
+    }
+
+    entries[1].name = "libcsv";
+#ifdef CSV_MAJOR
+    snprintf(entries[1].version, sizeof(entries[1].version), "%d.%d.%d",
+             CSV_MAJOR, CSV_MINOR, CSV_RELEASE);
+#else
+    snprintf(entries[1].version, sizeof(entries[1].version), "unknown");
+#endif
+    char lib[PATH_MAX], hex[65];
+    if (!libcsv_library_path(lib, sizeof(lib))) {
+        snprintf(entries[1].sha256, sizeof(entries[1].sha256), "static");
+    } else if (hash_file(lib, hex)) {
+        snprintf(entries[1].sha256, sizeof(entries[1].sha256), "sha256:%s", hex);
+    } else {
+        snprintf(entries[1].sha256, sizeof(entries[1].sha256), "unknown");
+    }
+}
+
+static bool write_lock_file(const char *path) {
+    FILE *f = fopen(path, "w");
+    if (!f) {
+        fprintf(stderr, "Error: Cannot open %s: %s\n", path, strerror(errno));
+        return false;
+    }
+    lock_entry_t entries[2];
+    collect_lock_entries(entries);
+    fprintf(f, "# Parser sources measured by the SonicSV benchmark suite; check with --locked\n");
+    for (int i = 0; i < 2; i++) {
+        fprintf(f, "%s %s %s\n", entries[i].name, entries[i].version, entries[i].sha256);
+    }
+    fclose(f);
+    return true;
+}
+
+/* Returns false (listing the differences) unless every parser matches the lockfile */
+static bool check_lock_file(const char *path) {
+    FILE *f = fopen(path, "r");
+    if (!f) {
+        fprintf(stderr, "Error: --locked: cannot open %s: %s (create it with --lock)\n",
+                path, strerror(errno));
+        return false;
+    }
+    lock_entry_t entries[2];
+    collect_lock_entries(entries);
+    bool seen[2] = {false, false};
+    bool ok = true;
+
+    char line[256];
+    while (fgets(line, sizeof(line), f)) {
+        char name[32], version[32], sha[72];
+        if (line[0] == '#' || sscanf(line, "%31s %31s %71s", name, version, sha) != 3) continue;
+        int i = 0;
+        while (i < 2 && strcmp(entries[i].name, name) != 0) i++;
+        if (i == 2) {
+            fprintf(stderr, "  %s: locked but not in this build\n", name);
+            ok = false;
+            continue;
+        }
+        seen[i] = true;
+        if (strncmp(sha, "sha256:", 7) != 0 || strncmp(entries[i].sha256, "sha256:", 7) != 0) {
+            fprintf(stderr, "  %s: locked %s, this build %s; a static or unknown source can't be checked\n",
+                    name, sha, entries[i].sha256);
+            ok = false;
+        } else if (strcmp(entries[i].version, version) != 0 || strcmp(entries[i].sha256, sha) != 0) {
+            fprintf(stderr, "  %s: locked %s %s, this build %s %s\n", name, version, sha,
+                    entries[i].version, entries[i].sha256);
+            ok = false;
+        }
+    }
+    fclose(f);
+    for (int i = 0; i < 2; i++) {
+        if (!seen[i]) {
+            fprintf(stderr, "  %s: not in %s\n", entries[i].name, path);
+            ok = false;
+        }
+    }
+    if (!ok) fprintf(stderr, "Error: parser sources differ from or can't be checked against %s\n", path);
+    return ok;
+}
+
+/*
+ * Run bundles - with --bundle every file the run produces lands in a
+ * fresh runs/<timestamp>/ directory instead of the working directory,
+ * together with the exact command line that produced it.
+ */
+#define RUNS_DIR "runs"
+
+static bool create_run_bundle(char *dir, size_t dir_size) {
+    mkdir(RUNS_DIR, 0755);
+
+    char stamp[32];
+    time_t now = time(NULL);
+    strftime(stamp, sizeof(stamp), "%Y%m%d-%H%M%S", localtime(&now));
+
+    snprintf(dir, dir_size, "%s/%s", RUNS_DIR, stamp);
+    for (int n = 2; mkdir(dir, 0755) != 0; n++) {
+        if (errno != EEXIST || n > 99) {
+            fprintf(stderr, "Error: Cannot create run directory %s: %s\n", dir, strerror(errno));
+            return false;
+        }
+        snprintf(dir, dir_size, "%s/%s-%d", RUNS_DIR, stamp, n);
+    }
+    return true;
+}
+
+/* Places name (its last path component) inside the bundle directory */
+static const char *bundle_path(char *out, size_t out_size, const char *dir, const char *name) {
+    const char *slash = strrchr(name, '/');
+    snprintf(out, out_size, "%s/%s", dir, slash ? slash + 1 : name);
+    return out;
+}
+
+static void write_run_command(const char *dir, int argc, char **argv) {
+    char path[128];
+    FILE *f = fopen(bundle_path(path, sizeof(path), dir, "command.txt"), "w");
+    if (!f) return;
+    for (int i = 0; i < argc; i++) {
+        fprintf(f, "%s%s", i ? " " : "", argv[i]);
+    }
+    fprintf(f, "\n");
+    fclose(f);
+}
+
+/*
+ * Shell completion - generated from the getopt table, so a new option is
+ * completable as soon as it exists. Options taking a path complete files,
+ * those with a fixed set of values complete the values.
+ *   source <(benchmark_suite --completion bash)
+ *   benchmark_suite --completion fish > ~/.config/fish/completions/benchmark_suite.fish
+ */
+static const char *const completion_files[] = {
+    "output", "benchstat", "trace", "compare", "cross-arch", "regression-budget", "quarantine",
+    "report", "merge", "share", "aggregate", "history", "keep-files", "workdir", "pareto-data",
+};
+
+static const struct {
+    const char *option;
+    const char *values;
+} completion_values[] = {
+    {"isa", "avx512 avx2 sse4.2 neon scalar"},
+    {"units", "mib mb auto"},
+    {"color", "auto always never"},
+    {"core-class", "performance efficiency"},
+    {"convert", "json"},
+    {"number-locale", "de fr ch"},
+    {"completion", "bash zsh fish"},
+    {"fail-fast", "all generate parse verify"},
+    {"keep-going", "all generate parse verify"},
+};
+
+static bool completes_files(const char *option) {
+    for (size_t i = 0; i < sizeof(completion_files) / sizeof(completion_files[0]); i++) {
+        if (strcmp(completion_files[i], option) == 0) return true;
+    }
+    return false;
+}
+
+static const char *completion_choices(const char *option) {
+    for (size_t i = 0; i < sizeof(completion_values) / sizeof(completion_values[0]); i++) {
+        if (strcmp(completion_values[i].option, option) == 0) return completion_values[i].values;
+    }
+    return NULL;
+}
+
+static bool print_completion(FILE *out, const char *shell, const char *prog,
+                             const struct option *options) {
+    const char *slash = strrchr(prog, '/');
+    const char *name = slash ? slash + 1 : prog;
+    char func[64];
+    snprintf(func, sizeof(func), "_%s", name);
+    for (char *c = func; *c; c++) {
+        if (!isalnum((unsigned char)*c)) *c = '_';
+    }
+
+    if (strcmp(shell, "bash") == 0) {
+        fprintf(out, "%s() {\n    local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n"
+                     "    case \"$prev\" in\n", func);
+        for (const struct option *o = options; o->name; o++) {
+            if (o->has_arg != required_argument) continue;  /* optional values need --opt=value */
+            const char *choices = completion_choices(o->name);
+            if (choices) {
+                fprintf(out, "        --%s) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")); return ;;\n",
+                        o->name, choices);
+            } else if (completes_files(o->name)) {
+                fprintf(out, "        --%s) COMPREPLY=($(compgen -f -- \"$cur\")); return ;;\n", o->name);
+            } else {
+                fprintf(out, "        --%s) return ;;\n", o->name);
+            }
+        }
+        fprintf(out, "    esac\n    COMPREPLY=($(compgen -W \"");
+        for (const struct option *o = options; o->name; o++) {
+            fprintf(out, "%s--%s", o == options ? "" : " ", o->name);
+        }
+        fprintf(out, "\" -- \"$cur\"))\n}\ncomplete -F %s %s\n", func, name);
+    } else if (strcmp(shell, "zsh") == 0) {
+        fprintf(out, "#compdef %s\n%s() {\n    _arguments \\\n", name, func);
+        for (const struct option *o = options; o->name; o++) {
+            if (o->has_arg == no_argument) {
+                fprintf(out, "        '--%s' \\\n", o->name);
+                continue;
+            }
+            const char *choices = completion_choices(o->name);
+            if (o->has_arg == optional_argument) {
+                fprintf(out, "        '--%s=-::%s:(%s)' \\\n", o->name, o->name, choices ? choices : "");
+            } else if (choices) {
+                fprintf(out, "        '--%s:%s:(%s)' \\\n", o->name, o->name, choices);
+            } else if (completes_files(o->name)) {
+                fprintf(out, "        '--%s:file:_files' \\\n", o->name);
+            } else {
+                fprintf(out, "        '--%s:%s:' \\\n", o->name, o->name);
+            }
+        }
+        fprintf(out, "        '*:file:_files'\n}\ncompdef %s %s\n", func, name);
+    } else if (strcmp(shell, "fish") == 0) {
+        for (const struct option *o = options; o->name; o++) {
+            fprintf(out, "complete -c %s -l %s", name, o->name);
+            if (o->val < 256 && isalpha(o->val)) fprintf(out, " -s %c", o->val);
+            if (o->has_arg != no_argument) {
+                const char *choices = completion_choices(o->name);
+                if (choices) fprintf(out, " -x -a '%s'", choices);
+                else if (completes_files(o->name)) fprintf(out, " -r -F");
+                else fprintf(out, " -x");
+            }
+            fprintf(out, "\n");
+        }
+    } else {
+        return false;
+    }
+    return true;
+}
+
+/*
+ * Usage - options grouped by what they are for, then a few examples.
+ * Modes come first: each replaces the default suite run.
+ */
+static void print_usage(FILE *out, const char *prog) {
+    fprintf(out, "SonicSV Benchmark Suite\n\n");
+    fprintf(out, "Usage: %s [options]\n", prog);
+    fprintf(out, "\nRun modes (each replaces the default suite run):\n");
+    fprintf(out, "  -X, --selftest       Check the harness against a reference parser, then exit\n");
+    fprintf(out, "      --golden[=PATH]  Check every harness's row/field counts against PATH\n");
+    fprintf(out, "                       (default " GOLDEN_FILE " of the binary's source tree)\n");
+    fprintf(out, "      --write-golden[=PATH]\n");
+    fprintf(out, "                       Regenerate the golden file (only if all harnesses agree)\n");
+    fprintf(out, "  -G, --bench-generator\n");
+    fprintf(out, "                       Measure single-threaded data generation speed only, then exit\n");
+    fprintf(out, "  -S, --scaling        Fit runtime growth over doubling sizes (base: --size or 1 MB)\n");
+    fprintf(out, "  -N, --range N:M      Time parsing only rows N to M-1 of each file (0 = header)\n");
+    fprintf(out, "      --in-memory N    Load each file once and time N parses of the buffer vs e2e\n");
+    fprintf(out, "  -J, --project COLS   Time materializing only columns COLS (e.g. 2,7) vs all\n");
+    fprintf(out, "  -V, --filter PRED    Time counting rows matching PRED (3=foo, 2>=100) vs parsing\n");
+    fprintf(out, "  -d, --group-by COL   Time a count-per-key aggregate, zero-copy keys vs copies\n");
+    fprintf(out, "      --convert json   Time transcoding each file to JSON lines vs parsing\n");
+    fprintf(out, "      --validate       Time checking schema tests' fields against their types\n");
+    fprintf(out, "      --round-trip     Check each parser re-parses its own fields written back as CSV\n");
+    fprintf(out, "      --limits         Probe each parser with fields around 64 KiB, 1 MiB and SonicSV's limit\n");
+    fprintf(out, "      --churn N        Time N create/parse/destroy cycles on a tiny input\n");
+    fprintf(out, "      --hammer N       Parse every test file from N threads at once and check results\n");
+    fprintf(out, "      --soak T         Parse the test files round-robin for T per parser (30m, 1h);\n"
+                 "                       track throughput and RSS over time\n");
+    fprintf(out, "  -R, --report FILE    Summarize a saved --benchstat file instead of running\n");
+    fprintf(out, "  -p, --parser GLOB    With --report: only parsers matching GLOB (e.g. 'sonicsv*')\n");
+    fprintf(out, "  -n, --scenario GLOB  With --report: only tests matching GLOB (e.g. 'tsv_*')\n");
+    fprintf(out, "  -m, --metric UNIT    With --report: unit to summarize (default: MB/s)\n");
+    fprintf(out, "  -M, --merge OUT FILE...\n");
+    fprintf(out, "                       Pool several --benchstat files into OUT and summarize it\n");
+    fprintf(out, "  -Z, --share OUT FILE Export a --benchstat file without host details for sharing\n");
+    fprintf(out, "  -L, --aggregate FILE...\n");
+    fprintf(out, "                       Median SonicSV MB/s per CPU model across --share bundles\n");
+    fprintf(out, "  -Y, --lock           Record this build's parser sources in " LOCK_FILE " and exit\n");
+    fprintf(out, "\nTest data:\n");
+    fprintf(out, "  -s, --size MIB       Scale every test file to MIB (2^20 bytes) instead of its row count\n");
+    fprintf(out, "      --nul-rate P     Put a NUL byte in a share P of generated text fields\n");
+    fprintf(out, "      --formula-rate P Replace a share P of generated text fields with formulas (=SUM(...), @cmd)\n");
+    fprintf(out, "      --number-locale de|fr|ch\n");
+    fprintf(out, "                       Write schema numbers with that locale's separators\n");
+    fprintf(out, "      --reshuffle      Regenerate each file with a new seed before every timed iteration\n");
+    fprintf(out, "  -g, --gen-mmap       Write generated files through a preallocated mmap\n");
+    fprintf(out, "  -a, --hash           Report the SHA-256 of each generated file\n");
+    fprintf(out, "  -k, --keep-files DIR Move generated files to DIR with a manifest instead of deleting\n");
+    fprintf(out, "  -z, --compress       With --keep-files: zstd-compress each kept file\n");
+    fprintf(out, "  -W, --workdir DIR    Generate test files under DIR (local disk or tmpfs) instead of /tmp\n");
+    fprintf(out, "\nMeasurement:\n");
+    fprintf(out, "  -i, --iterations N   Timed iterations per test (default: %d)\n", DEFAULT_ITERATIONS);
+    fprintf(out, "  -w, --warmup N       Warmup iterations per test (default: %d)\n", DEFAULT_WARMUP);
+    fprintf(out, "  -r, --repeat N       Parse files under 1 MB N times per timed sample (default: 1)\n");
+    fprintf(out, "  -O, --subtract-overhead\n");
+    fprintf(out, "                       Subtract each parser's empty-file time from its timings\n");
+    fprintf(out, "  -f, --prefetch       Read each input into the page cache just before its timed runs\n");
+    fprintf(out, "  -K, --stripes K      Sample files under 1 MB on K cores at once (falls back on contention)\n");
+    fprintf(out, "  -x, --sandbox        Run each parser from its own scratch directory\n");
+    fprintf(out, "  -q, --quarantine FILE\n");
+    fprintf(out, "                       Skip parser/test pairs that crashed or failed in earlier runs\n");
+    fprintf(out, "  -Q, --include-quarantined\n");
+    fprintf(out, "                       Retry quarantined pairs; successes leave the quarantine\n");
+    fprintf(out, "  -E, --sample-env     Add load, free memory and swap activity to benchstat lines\n");
+    fprintf(out, "  -u, --time-budget T  Fit the run into T (90s, 30m, 2h) using --history timings\n");
+    fprintf(out, "  -H, --history FILE   Earlier --benchstat file used to plan --time-budget\n");
+    fprintf(out, "  -I, --isa LEVEL      Pin SonicSV to avx512, avx2, sse4.2, neon or scalar\n");
+    fprintf(out, "  -e, --core-class CLASS Run on performance or efficiency cores (macOS)\n");
+    fprintf(out, "\nMachine setup (root):\n");
+    fprintf(out, "  -P, --performance-governor\n");
+    fprintf(out, "                       Set every core to the performance governor (root)\n");
+    fprintf(out, "  -T, --no-turbo       Disable turbo boost during the run (root)\n");
+    fprintf(out, "  -C, --physical-cores-only\n");
+    fprintf(out, "                       Run only on the first SMT thread of each core\n");
+    fprintf(out, "\nComparison and checks:\n");
+    fprintf(out, "  -c, --compare FILE   Compare with an earlier --benchstat file from this machine\n");
+    fprintf(out, "  -F, --force-compare  Compare even if the baseline's machine fingerprint differs\n");
+    fprintf(out, "  -y, --regression-budget FILE\n");
+    fprintf(out, "                       With --compare: exit 4 when a test regresses past its\n");
+    fprintf(out, "                       \"GLOB PERCENT\" line in FILE\n");
+    fprintf(out, "  -j, --cross-arch FILE Set results beside a benchstat file from another architecture\n");
+    fprintf(out, "  -A, --assert SPEC    Exit 4 unless e.g. sonicsv>=2000MB/s@csv_* holds (repeatable)\n");
+    fprintf(out, "  -l, --locked         Refuse to run unless the parsers match " LOCK_FILE "\n");
+    fprintf(out, "  -D, --allow-dirty    Write --benchstat/--bundle results from an uncommitted tree\n");
+    fprintf(out, "                       (any benchstat file may become a --history/--compare baseline)\n");
+    fprintf(out, "      --fail-fast[=PHASES]\n");
+    fprintf(out, "                       Stop the suite at the first failure in PHASES (generate,parse,\n");
+    fprintf(out, "                       verify; default all), e.g. for CI gating\n");
+    fprintf(out, "      --keep-going[=PHASES]\n");
+    fprintf(out, "                       Carry on past failures in PHASES (the default for all)\n");
+    fprintf(out, "\nOutput:\n");
+    fprintf(out, "  -o, --output FILE    Write report to file (default: stdout)\n");
+    fprintf(out, "  -b, --benchstat FILE Write per-iteration results in benchstat format\n");
+    fprintf(out, "  -t, --trace FILE     Write per-phase timings of the suite itself\n");
+    fprintf(out, "  -B, --bundle         Write report, benchstat and trace files under runs/<timestamp>/\n");
+    fprintf(out, "  -U, --units UNITS    Report tables in mib (default, 2^20), mb (10^6) or auto (MB/s, GB/s)\n");
+    fprintf(out, "      --color WHEN     Color --compare deltas: auto (terminals, default), always or never\n");
+    fprintf(out, "      --weights W      Overall score weights, e.g. throughput=4,memory=2,stability=2,reliability=2\n");
+    fprintf(out, "      --pareto-data FILE\n");
+    fprintf(out, "                       Write each test's MB/s vs. peak RSS points for plotting\n");
+    fprintf(out, "\nOther:\n");
+    fprintf(out, "      --completion SHELL\n");
+    fprintf(out, "                       Print a bash, zsh or fish completion script\n");
+    fprintf(out, "  -h, --help           Show this help message\n");
+    fprintf(out, "\nExamples:\n");
+    fprintf(out, "  Baseline, then a later run against it:\n");
+    fprintf(out, "    %s --iterations 10 --benchstat base.txt\n", prog);
+    fprintf(out, "    %s --iterations 10 --compare base.txt\n", prog);
+    fprintf(out, "  One workload on bigger files:\n");
+    fprintf(out, "    %s --size 64 --filter '2>=100'\n", prog);
+    fprintf(out, "  Summarize saved results for some tests:\n");
+    fprintf(out, "    %s --report base.txt --scenario 'tsv_*'\n", prog);
+    fprintf(out, "  Publish results without host details, then compare machines:\n");
+    fprintf(out, "    %s --share shared.txt base.txt\n", prog);
+    fprintf(out, "    %s --aggregate shared-*.txt\n", prog);
+    fprintf(out, "  Correctness probes:\n");
+    fprintf(out, "    %s --selftest\n", prog);
+    fprintf(out, "    %s --limits\n", prog);
+    fprintf(out, "    %s --hammer 8        (make benchmark-tsan runs it under ThreadSanitizer)\n", prog);
+    fprintf(out, "\nExit status:\n");
+    fprintf(out, "  0  success\n");
+    fprintf(out, "  1  bad arguments or unreadable input\n");
+    fprintf(out, "  %d  build failure (invalid test table, --isa level this CPU lacks, binary rebuilt mid-run)\n",
+            EXIT_BUILD_FAILURE);
+    fprintf(out, "  %d  benchmark failure (data generation or a parse failed, selftest harness checks)\n",
+            EXIT_BENCH_FAILURE);
+    fprintf(out, "  %d  regression (--regression-budget exceeded or an --assert failed)\n", EXIT_REGRESSION);
+    fprintf(out, "  %d  verification mismatch (wrong row/field counts, parsers disagree, incl. selftest)\n",
+            EXIT_MISMATCH);
+    fprintf(out, "\nThis tool generates CSV test data, parses it with both SonicSV and\n");
+    fprintf(out, "libcsv under identical conditions, and produces a detailed comparison.\n");
+}
+
+/*
+ * Entry point
+ */
+int main(int argc, char **argv) {
+    int iterations = DEFAULT_ITERATIONS;
+    int warmup = DEFAULT_WARMUP;
+    const char *output_file = NULL;
+    const char *benchstat_file = NULL;
+    const char *trace_file = NULL;
+    bool bench_generator = false;
+    bool selftest = false;
+    bool scaling = false;
+    size_t range_first = 0, range_last = 0;
+    const char *projection_arg = NULL;
+    uint64_t projection = 0;
+    size_t projection_max_col = 0;
+    const char *filter_arg = NULL;
+    struct filter_predicate filter = {0};
+    size_t group_col = SIZE_MAX;
+    bool subtract_overhead = false;
+    int repeat = 1;
+    const char *baseline_path = NULL;
+    bool force_compare = false;
+    bool performance_governor = false;
+    bool disable_turbo = false;
+    bool physical_cores_only = false;
+    bool sandbox = false;
+    bool bundle = false;
+    const char *quarantine_path = NULL;
+    bool include_quarantined = false;
+    bool sample_env = false;
+    const char *report_path = NULL;
+    const char *parser_glob = NULL;
+    const char *scenario_glob = NULL;
+    const char *metric = "MB/s";
+    const char *merge_path = NULL;
+    double time_budget = 0;
+    const char *history_path = NULL;
+    bool gen_mmap = false;
+    bool gen_hash = false;
+    const char *keep_dir = NULL;
+    bool compress = false;
+    bool allow_dirty = false;
+    bool prefetch = false;
+    bool reshuffle = false;
+    const char *workdir = NULL;
+    int stripes = 1;
+    const char *budget_path = NULL;
+    assertion_t assertions[MAX_ASSERTIONS];
+    const char *isa = NULL;
+    const char *cross_arch_path = NULL;
+    const char *core_class = NULL;
+    const char *share_path = NULL;
+    bool aggregate = false;
+    bool write_lock = false;
+    bool locked = false;
+    int num_assertions = 0;
+    double target_mb = 0;
+
+    /* Options without a short form, numbered past any char */
+    enum { OPT_CONVERT = 256, OPT_VALIDATE, OPT_LIMITS, OPT_NUL_RATE, OPT_CHURN, OPT_HAMMER, OPT_NUMBER_LOCALE,
+           OPT_WEIGHTS, OPT_PARETO_DATA, OPT_COMPLETION, OPT_FAIL_FAST, OPT_KEEP_GOING,
+           OPT_FORMULA_RATE, OPT_ROUND_TRIP, OPT_GOLDEN, OPT_WRITE_GOLDEN, OPT_IN_MEMORY,
+           OPT_RESHUFFLE, OPT_SOAK, OPT_COLOR };
+    const char *convert_format = NULL;
+    bool validate = false;
+    bool round_trip = false;
+    bool golden = false, write_golden = false;
+    const char *golden_path = NULL;
+    bool limits = false;
+    double nul_rate = 0;
+    double formula_rate = 0;
+    size_t churn_cycles = 0;
+    int in_memory_passes = 0;
+    int hammer_threads = 0;
+    double soak_seconds = 0;
+    const char *number_locale = NULL;
+    double weights[SCORE_CRITERIA] = {4, 2, 2, 2};
+    unsigned fail_fast = 0;
+    const char *pareto_path = NULL;
+
+    static struct option long_options[] = {
+        {"iterations", required_argument, 0, 'i'},
+        {"warmup",     required_argument, 0, 'w'},
+        {"output",     required_argument, 0, 'o'},
+        {"benchstat",  required_argument, 0, 'b'},
+        {"trace",      required_argument, 0, 't'},
+        {"bench-generator", no_argument,  0, 'G'},
+        {"size",       required_argument, 0, 's'},
+        {"scaling",    no_argument,       0, 'S'},
+        {"range",      required_argument, 0, 'N'},
+        {"project",    required_argument, 0, 'J'},
+        {"filter",     required_argument, 0, 'V'},
+        {"group-by",   required_argument, 0, 'd'},
+        {"convert",    required_argument, 0, OPT_CONVERT},
+        {"round-trip", no_argument,       0, OPT_ROUND_TRIP},
+        {"validate",   no_argument,       0, OPT_VALIDATE},
+        {"limits",     no_argument,       0, OPT_LIMITS},
+        {"nul-rate",   required_argument, 0, OPT_NUL_RATE},
+        {"formula-rate", required_argument, 0, OPT_FORMULA_RATE},
+        {"churn",      required_argument, 0, OPT_CHURN},
+        {"in-memory",  required_argument, 0, OPT_IN_MEMORY},
+        {"hammer",     required_argument, 0, OPT_HAMMER},
+        {"number-locale", required_argument, 0, OPT_NUMBER_LOCALE},
+        {"weights",    required_argument, 0, OPT_WEIGHTS},
+        {"pareto-data", required_argument, 0, OPT_PARETO_DATA},
+        {"completion", required_argument, 0, OPT_COMPLETION},
+        {"fail-fast",  optional_argument, 0, OPT_FAIL_FAST},
+        {"keep-going", optional_argument, 0, OPT_KEEP_GOING},
+        {"subtract-overhead", no_argument, 0, 'O'},
+        {"repeat",     required_argument, 0, 'r'},
+        {"compare",    required_argument, 0, 'c'},
+        {"force-compare", no_argument,    0, 'F'},
+        {"performance-governor", no_argument, 0, 'P'},
+        {"no-turbo",   no_argument,       0, 'T'},
+        {"physical-cores-only", no_argument, 0, 'C'},
+        {"sandbox",    no_argument,       0, 'x'},
+        {"bundle",     no_argument,       0, 'B'},
+        {"quarantine", required_argument, 0, 'q'},
+        {"include-quarantined", no_argument, 0, 'Q'},
+        {"sample-env", no_argument,       0, 'E'},
+        {"report",     required_argument, 0, 'R'},
+        {"parser",     required_argument, 0, 'p'},
+        {"scenario",   required_argument, 0, 'n'},
+        {"metric",     required_argument, 0, 'm'},
+        {"merge",      required_argument, 0, 'M'},
+        {"time-budget", required_argument, 0, 'u'},
+        {"history",    required_argument, 0, 'H'},
+        {"gen-mmap",   no_argument,       0, 'g'},
+        {"reshuffle",  no_argument,       0, OPT_RESHUFFLE},
+        {"soak",       required_argument, 0, OPT_SOAK},
+        {"hash",       no_argument,       0, 'a'},
+        {"keep-files", required_argument, 0, 'k'},
+        {"compress",   no_argument,       0, 'z'},
+        {"allow-dirty", no_argument,      0, 'D'},
+        {"units",      required_argument, 0, 'U'},
+        {"color",      required_argument, 0, OPT_COLOR},
+        {"prefetch",   no_argument,       0, 'f'},
+        {"workdir",    required_argument, 0, 'W'},
+        {"stripes",    required_argument, 0, 'K'},
+        {"regression-budget", required_argument, 0, 'y'},
+        {"assert",     required_argument, 0, 'A'},
+        {"selftest",   no_argument,       0, 'X'},
+        {"golden",     optional_argument, 0, OPT_GOLDEN},
+        {"write-golden", optional_argument, 0, OPT_WRITE_GOLDEN},
+        {"isa",        required_argument, 0, 'I'},
+        {"cross-arch", required_argument, 0, 'j'},
+        {"core-class", required_argument, 0, 'e'},
+        {"share",      required_argument, 0, 'Z'},
+        {"aggregate",  no_argument,       0, 'L'},
+        {"lock",       no_argument,       0, 'Y'},
+        {"locked",     no_argument,       0, 'l'},
+        {"help",       no_argument,       0, 'h'},
+        {0, 0, 0, 0}
+    };
+
+    int opt;
+    while ((opt = getopt_long(argc, argv, "i:w:o:b:t:Gs:SOr:c:FPTCxBq:QER:p:n:m:M:u:H:gak:zDU:fW:K:y:A:XI:j:e:Z:LYlN:J:V:d:h", long_options, NULL)) != -1) {
+        switch (opt) {
+            case 'i':
+                iterations = atoi(optarg);
+                if (iterations < 1) iterations = 1;
+                break;
+            case 'w':
+                warmup = atoi(optarg);
+                if (warmup < 0) warmup = 0;
+                break;
+            case 'o':
+                output_file = optarg;
+                break;
+            case 'b':
+                benchstat_file = optarg;
+                break;
+            case 't':
+                trace_file = optarg;
+                break;
+            case 'G':
+                bench_generator = true;
+                break;
+            case 'S':
+                scaling = true;
+                break;
+            case 'O':
+                subtract_overhead = true;
+                break;
+            case 'r':
+                repeat = atoi(optarg);
+                if (repeat < 1) repeat = 1;
+                break;
+            case 'c':
+                baseline_path = optarg;
+                break;
+            case 'F':
+                force_compare = true;
+                break;
+            case 'P':
+                performance_governor = true;
+                break;
+            case 'T':
+                disable_turbo = true;
+                break;
+            case 'C':
+                physical_cores_only = true;
+                break;
+            case 'x':
+                sandbox = true;
+                break;
+            case 'B':
+                bundle = true;
+                break;
+            case 'q':
+                quarantine_path = optarg;
+                break;
+            case 'Q':
+                include_quarantined = true;
+                break;
+            case 'E':
+                sample_env = true;
+                break;
+            case 'R':
+                report_path = optarg;
+                break;
+            case 'p':
+                parser_glob = optarg;
+                break;
+            case 'n':
+                scenario_glob = optarg;
+                break;
+            case 'm':
+                metric = optarg;
+                break;
+            case 'M':
+                merge_path = optarg;
+                break;
+            case 'u':
+                time_budget = parse_duration(optarg);
+                if (time_budget < 0) {
+                    fprintf(stderr, "Error: invalid --time-budget '%s' (use e.g. 90s, 30m, 2h)\n", optarg);
+                    return 1;
+                }
+                break;
+            case 'H':
+                history_path = optarg;
+                break;
+            case 'g':
+                gen_mmap = true;
+                break;
+            case 'a':
+                gen_hash = true;
+                break;
+            case 'k':
+                keep_dir = optarg;
+                break;
+            case 'z':
+                compress = true;
+                break;
+            case 'D':
+                allow_dirty = true;
+                break;
+            case 'f':
+                prefetch = true;
+                break;
+            case 'W':
+                workdir = optarg;
+                break;
+            case 'N':
+                if (sscanf(optarg, "%zu:%zu", &range_first, &range_last) != 2 ||
+                    range_last <= range_first) {
+                    fprintf(stderr, "Error: --range must be N:M with N < M (rows N to M-1)\n");
+                    return 1;
+                }
+                break;
+            case OPT_SOAK:
+                soak_seconds = parse_duration(optarg);
+                if (soak_seconds <= 0) {
+                    fprintf(stderr, "Error: invalid --soak '%s' (use e.g. 90s, 30m, 1h)\n", optarg);
+                    return 1;
+                }
+                break;
+            case OPT_RESHUFFLE:
+                reshuffle = true;
+                break;
+            case OPT_IN_MEMORY:
+                in_memory_passes = atoi(optarg);
+                if (in_memory_passes < 1) {
+                    fprintf(stderr, "Error: --in-memory takes a pass count, e.g. 20\n");
+                    return 1;
+                }
+                break;
+            case OPT_LIMITS:
+                limits = true;
+                break;
+            case OPT_CHURN:
+                churn_cycles = strtoull(optarg, NULL, 10);
+                if (churn_cycles == 0) {
+                    fprintf(stderr, "Error: --churn takes a cycle count, e.g. 100000\n");
+                    return 1;
+                }
+                break;
+            case OPT_FAIL_FAST:
+            case OPT_KEEP_GOING:
+                if (!parse_fail_phases(optarg, &fail_fast, opt == OPT_FAIL_FAST)) {
+                    fprintf(stderr, "Error: --%s takes a comma-separated list of generate, parse "
+                                    "and verify, or all\n", opt == OPT_FAIL_FAST ? "fail-fast" : "keep-going");
+                    return 1;
+                }
+                break;
+            case OPT_COMPLETION:
+                if (!print_completion(stdout, optarg, argv[0], long_options)) {
+                    fprintf(stderr, "Error: --completion takes bash, zsh or fish\n");
+                    return 1;
+                }
+                return 0;
+            case OPT_PARETO_DATA:
+                pareto_path = optarg;
+                break;
+            case OPT_WEIGHTS:
+                if (!parse_weights(optarg, weights)) {
+                    fprintf(stderr, "Error: --weights takes NAME=W pairs, e.g. throughput=1,memory=3 "
+                                    "(throughput, memory, stability, reliability)\n");
+                    return 1;
+                }
+                break;
+            case OPT_NUMBER_LOCALE:
+                number_locale = optarg;
+                if (!find_number_locale(number_locale)) {
+                    fprintf(stderr, "Error: --number-locale takes de, fr or ch\n");
+                    return 1;
+                }
+                break;
+            case OPT_HAMMER:
+                hammer_threads = atoi(optarg);
+                if (hammer_threads < 1 || hammer_threads > HAMMER_MAX_THREADS) {
+                    fprintf(stderr, "Error: --hammer takes 1 to %d threads\n", HAMMER_MAX_THREADS);
+                    return 1;
+                }
+                break;
+            case OPT_FORMULA_RATE:
+                formula_rate = atof(optarg);
+                if (formula_rate < 0 || formula_rate > 1) {
+                    fprintf(stderr, "Error: --formula-rate takes a fraction from 0 to 1\n");
+                    return 1;
+                }
+                break;
+            case OPT_NUL_RATE:
+                nul_rate = atof(optarg);
+                if (nul_rate < 0 || nul_rate > 1) {
+                    fprintf(stderr, "Error: --nul-rate takes a fraction from 0 to 1\n");
+                    return 1;
+                }
+                break;
+            case OPT_VALIDATE:
+                validate = true;
+                break;
+            case OPT_ROUND_TRIP:
+                round_trip = true;
+                break;
+            case OPT_GOLDEN:
+                golden = true;
+                if (optarg) golden_path = optarg;
+                break;
+            case OPT_WRITE_GOLDEN:
+                write_golden = true;
+                if (optarg) golden_path = optarg;
+                break;
+            case OPT_CONVERT:
+                if (strcmp(optarg, "json") != 0) {
+                    fprintf(stderr, "Error: --convert supports json only (parquet needs a writer library)\n");
+                    return 1;
+                }
+                convert_format = optarg;
+                break;
+            case 'd': {
+                char *end;
+                long col = strtol(optarg, &end, 10);
+                if (end == optarg || *end != '\0' || col < 1) {
+                    fprintf(stderr, "Error: --group-by takes a column number (1-based)\n");
+                    return 1;
+                }
+                group_col = (size_t)col - 1;
+                break;
+            }
+            case 'V':
+                if (!parse_filter(optarg, &filter)) return 1;
+                filter_arg = optarg;
+                break;
+            case 'J':
+                if (!parse_projection(optarg, &projection, &projection_max_col)) return 1;
+                projection_arg = optarg;
+                break;
+            case 'Y':
+                write_lock = true;
+                break;
+            case 'l':
+                locked = true;
+                break;
+            case 'L':
+                aggregate = true;
+                break;
+            case 'Z':
+                share_path = optarg;
+                break;
+            case 'e':
+                core_class = optarg;
+                break;
+            case 'j':
+                cross_arch_path = optarg;
+                break;
+            case 'I':
+                if (!find_simd_level(optarg)) {
+                    fprintf(stderr, "Error: --isa must be avx512, avx2, sse4.2, neon or scalar\n");
+                    return 1;
+                }
+                isa = optarg;
+                break;
+            case 'X':
+                selftest = true;
+                break;
+            case 'A':
+                if (num_assertions == MAX_ASSERTIONS) {
+                    fprintf(stderr, "Error: at most %d --assert options\n", MAX_ASSERTIONS);
+                    return 1;
+                }
+                if (!parse_assertion(optarg, &assertions[num_assertions++])) {
+                    fprintf(stderr, "Error: --assert expects PARSER>=N UNIT@TEST, e.g. sonicsv>=2000MB/s@csv_*\n");
+                    return 1;
+                }
+                break;
+            case 'y':
+                budget_path = optarg;
+                break;
+            case 'K':
+                stripes = atoi(optarg);
+                if (stripes < 1) stripes = 1;
+                break;
+            case 'U':
+                if (!parse_units(optarg, &g_units)) {
+                    fprintf(stderr, "Error: --units must be mib, mb or auto\n");
+                    return 1;
+                }
+                break;
+            case OPT_COLOR:
+                if (!parse_color_mode(optarg, &g_color)) {
+                    fprintf(stderr, "Error: --color must be auto, always or never\n");
+                    return 1;
+                }
+                break;
+            case 's':
+                target_mb = atof(optarg);
+                if (target_mb < 0) target_mb = 0;
+                break;
+            case 'h':
+            default:
+                print_usage(opt == 'h' ? stdout : stderr, argv[0]);
+                return opt == 'h' ? 0 : 1;
+        }
+    }
+
+    if (budget_path) {
+        if (!baseline_path) {
+            fprintf(stderr, "Error: --regression-budget needs --compare\n");
+            return 1;
+        }
+        if (!load_regression_budget(budget_path)) {
+            fprintf(stderr, "Error: Cannot read regression budget %s\n", budget_path);
+            return 1;
+        }
+    }
+
+    if (merge_path && optind >= argc) {
+        fprintf(stderr, "Error: --merge needs at least one input file\n");
+        return 1;
+    }
+    if (aggregate && optind >= argc) {
+        fprintf(stderr, "Error: --aggregate needs at least one bundle\n");
+        return 1;
+    }
+
+    /* Any benchstat file, including the one a bundle holds, can later be
+     * fed back as a --history or --compare baseline, so all of them count
+     * as history and must name the exact source they measured */
+    if ((benchstat_file || bundle) && source_tree_dirty() && !allow_dirty) {
+        fprintf(stderr, "Error: built from a dirty tree (%s); commit first or pass --allow-dirty\n",
+                SONICSV_GIT_DESCRIBE);
+        return 1;
+    }
+
+    if (write_lock) {
+        if (!write_lock_file(LOCK_FILE)) return 1;
+        fprintf(stderr, "Wrote %s\n", LOCK_FILE);
+        return 0;
+    }
+    if (locked && !check_lock_file(LOCK_FILE)) return 1;
+
+    char bundle_dir[64] = "";
+    char report_buf[192], benchstat_buf[192], trace_buf[192];
+    if (bundle) {
+        if (!create_run_bundle(bundle_dir, sizeof(bundle_dir))) return 1;
+        output_file = bundle_path(report_buf, sizeof(report_buf), bundle_dir,
+                                  output_file ? output_file : "report.txt");
+        benchstat_file = bundle_path(benchstat_buf, sizeof(benchstat_buf), bundle_dir,
+                                     benchstat_file ? benchstat_file : "benchstat.txt");
+        trace_file = bundle_path(trace_buf, sizeof(trace_buf), bundle_dir,
+                                 trace_file ? trace_file : "trace.txt");
+        write_run_command(bundle_dir, argc, argv);
+        char lock_buf[192];
+        write_lock_file(bundle_path(lock_buf, sizeof(lock_buf), bundle_dir, LOCK_FILE));
+    }
+
+    FILE *report_out = stdout;
+    if (output_file) {
+        report_out = fopen(output_file, "w");
+        if (!report_out) {
+            fprintf(stderr, "Error: Cannot open output file %s: %s\n", output_file, strerror(errno));
+            return 1;
+        }
+    }
+
+    FILE *benchstat_out = NULL;
+    if (benchstat_file) {
+        benchstat_out = fopen(benchstat_file, "w");
+        if (!benchstat_out) {
+            fprintf(stderr, "Error: Cannot open benchstat file %s: %s\n", benchstat_file, strerror(errno));
+            if (output_file) fclose(report_out);
+            return 1;
+        }
+    }
+
+    FILE *trace_out = NULL;
+    if (trace_file) {
+        trace_out = fopen(trace_file, "w");
+        if (!trace_out) {
+            fprintf(stderr, "Error: Cannot open trace file %s: %s\n", trace_file, strerror(errno));
+            if (benchstat_out) fclose(benchstat_out);
+            if (output_file) fclose(report_out);
+            return 1;
+        }
+    }
+
+    bench_options_t opts = {
+        .iterations = iterations,
+        .warmup = warmup,
+        .report_out = report_out,
+        .benchstat_out = benchstat_out,
+        .trace_out = trace_out,
+        .target_bytes = (size_t)(target_mb * 1024.0 * 1024.0),
+        .subtract_overhead = subtract_overhead,
+        .repeat = repeat,
+        .baseline_path = baseline_path,
+        .force_compare = force_compare,
+        .sandbox = sandbox,
+        .quarantine_path = quarantine_path,
+        .include_quarantined = include_quarantined,
+        .sample_env = sample_env,
+        .report_path = report_path,
+        .parser_glob = parser_glob,
+        .scenario_glob = scenario_glob,
+        .metric = metric,
+        .merge_path = merge_path,
+        .time_budget = time_budget,
+        .history_path = history_path,
+        .golden_path = golden_path,
+        .keep_dir = keep_dir,
+        .compress = compress,
+        .prefetch = prefetch,
+        .reshuffle = reshuffle,
+        .stripes = stripes,
+        .assertions = assertions,
+        .cross_arch_path = cross_arch_path,
+        .num_assertions = num_assertions,
+        .merge_inputs = argv + optind,
+        .num_merge_inputs = argc - optind,
+        .range_first = range_first,
+        .range_last = range_last,
+        .projection_arg = projection_arg,
+        .projection = projection,
+        .projection_max_col = projection_max_col,
+        .filter_arg = filter_arg,
+        .filter = filter,
+        .group_col = group_col,
+        .share_path = share_path,
+        .share_input = optind < argc ? argv[optind] : NULL,
+        .aggregate = aggregate,
+        .churn_cycles = churn_cycles,
+        .in_memory_passes = in_memory_passes,
+        .weights = {weights[0], weights[1], weights[2], weights[3]},
+        .pareto_path = pareto_path,
+        .hammer_threads = hammer_threads,
+        .soak_seconds = soak_seconds,
+        .fail_fast = fail_fast,
+    };
+
+    if (!validate_test_configs()) return EXIT_BUILD_FAILURE;
+    if (isa && !pin_simd_level(isa)) return EXIT_BUILD_FAILURE;
+    if (core_class && !apply_core_class(core_class)) return 1;
+
+    /* Reports, benchstat files and --compare all use '.' decimals whatever
+     * the user's locale; pin it in case a linked library called setlocale() */
+    setlocale(LC_NUMERIC, "C");
+
+    /* Before any run mode, so the fingerprint records the tuned state */
+    apply_cpu_tuning(performance_governor, disable_turbo);
+    if (physical_cores_only) restrict_to_physical_cores();
+
+    if (quarantine_path) quarantine_load(quarantine_path);
+    g_gen_mmap = gen_mmap;
+    g_gen_hash = gen_hash;
+    g_gen_nul_rate = nul_rate;
+    g_gen_formula_rate = formula_rate;
+    g_gen_number_locale = number_locale ? find_number_locale(number_locale) : NULL;
+    if (keep_dir && mkdir(keep_dir, 0755) != 0 && errno != EEXIST) {
+        fprintf(stderr, "Error: Cannot create %s: %s\n", keep_dir, strerror(errno));
+        return 1;
+    }
+
+    /* One test file exists at a time; --scaling's largest is 2^(steps-1) x --size */
+    double need_bytes = opts.target_bytes > 0 ? opts.target_bytes * 1.1 : WORK_DIR_MIN_FREE;
+    if (scaling) need_bytes *= 1 << (SCALING_STEPS - 1);
+    if (!merge_path && !report_path && !share_path && !aggregate && !churn_cycles && !setup_work_dir(workdir, need_bytes)) return 1;
+
+    int result = aggregate       ? run_aggregate(&opts)
+               : share_path      ? run_share(&opts)
+               : merge_path      ? run_merge(&opts)
+               : report_path     ? run_report(&opts)
+               : selftest        ? run_selftest(&opts)
+               : golden || write_golden ? run_golden(&opts, write_golden)
+               : bench_generator ? run_generator_benchmark(&opts)
+               : scaling         ? run_scaling_analysis(&opts)
+               : range_last > 0  ? run_range_analysis(&opts)
+               : in_memory_passes ? run_in_memory_analysis(&opts)
+               : projection_arg  ? run_projection_analysis(&opts)
+               : filter_arg      ? run_filter_analysis(&opts)
+               : group_col != SIZE_MAX ? run_group_analysis(&opts)
+               : convert_format  ? run_convert_analysis(&opts)
+               : round_trip      ? run_round_trip(&opts)
+               : validate        ? run_validate_analysis(&opts)
+               : limits          ? run_limits_probe(&opts)
+               : churn_cycles    ? run_churn_benchmark(&opts)
+               : hammer_threads  ? run_hammer(&opts)
+               : soak_seconds > 0 ? run_soak(&opts)
+                                 : run_benchmark_suite(&opts);
+
+    if (output_file) {
+        fclose(report_out);
+        fprintf(stderr, "Report written to: %s\n", output_file);
+    }
+    if (benchstat_out) {
+        fclose(benchstat_out);
+        fprintf(stderr, "benchstat results written to: %s\n", benchstat_file);
+    }
+    if (trace_out) {
+        fclose(trace_out);
+        fprintf(stderr, "Phase trace written to: %s\n", trace_file);
+    }
+    if (bundle) {
+        fprintf(stderr, "Run bundle: %s\n", bundle_dir);
+    }
+
+    return result;
+}
@@ -0,0 +1,34 @@
+#!/bin/sh
+# One `git bisect run` step for `make benchmark-bisect`: builds the
+# checked-out sonicsv.h against the saved benchmark_suite.c, runs the
+# suite and marks the revision good when SonicSV's mean MB/s on $TEST is
+# at least $THRESHOLD. Build or run failures skip the revision (125).
+#
+# Expects: BISECT_DIR and BUILD_LOG_DIR (absolute), CC, CFLAGS, LDFLAGS,
+# TEST, THRESHOLD, BENCH_ARGS. Each step's build log is
+# $BUILD_LOG_DIR/bisect-<rev>.log. $BISECT_DIR/sonicsv.h links to the bisect worktree's header,
+# which is where $BISECT_DIR/bench/benchmark_suite.c finds "../sonicsv.h".
+
+rev=$(git rev-parse --short HEAD)
+commit=$(git rev-parse HEAD)
+describe=$(git describe --tags --always --dirty)
+sha=$({ sha256sum sonicsv.h 2>/dev/null || shasum -a 256 sonicsv.h; } | cut -d' ' -f1)
+
+# The revision under test goes into the binary, so each step-*.txt names it
+mkdir -p "$BUILD_LOG_DIR"
+log="$BUILD_LOG_DIR/bisect-$rev.log"
+(set -x; $CC $CFLAGS -DSONICSV_GIT_COMMIT="\"$commit\"" -DSONICSV_GIT_DESCRIBE="\"$describe\"" \
+    -DSONICSV_SOURCE_SHA256="\"$sha\"" -DSONICSV_BUILD_LOG="\"$log\"" \
+    -o "$BISECT_DIR/bench/benchmark_suite" "$BISECT_DIR/bench/benchmark_suite.c" \
+    -lcsv $LDFLAGS) > "$log" 2>&1 || { echo "bisect-$rev $log" >> "$BUILD_LOG_DIR/failures.txt"; exit 125; }
+
+"$BISECT_DIR/bench/benchmark_suite" $BENCH_ARGS --benchstat "$BISECT_DIR/step-$rev.txt" \
+    > /dev/null 2>&1 || exit 125
+
+awk -v name="BenchmarkSonicSV/$TEST" -v min="$THRESHOLD" -v rev="$rev" '
+    $1 == name { sum += $5; n++ }
+    END {
+        if (n == 0) { print rev ": no results for " name; exit 125 }
+        printf "%s: %.1f MB/s (threshold %s)\n", rev, sum / n, min
+        exit (sum / n >= min) ? 0 : 1
+    }' "$BISECT_DIR/step-$rev.txt"